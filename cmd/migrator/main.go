@@ -1,49 +1,177 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strconv"
 
-	"github.com/golang-migrate/migrate"
-	_ "github.com/golang-migrate/migrate/database/sqlite3"
-	_ "github.com/golang-migrate/migrate/source/file"
+	"url-shorter/internal/config"
+	"url-shorter/internal/migrator"
 )
 
-// go run ./cmd/migrator --storage-path=./storage/storage.db --migrations-path=./migrations
+// CONFIG_PATH=./config/local.yaml go run ./cmd/migrator up
+// Storage path comes from the same config as the server. Migrations are
+// embedded unless migrations_path is set.
 
 func main() {
-	var storagePath, migrationsPath, migrationsTable string
+	var jsonOutput bool
 
-	flag.StringVar(&storagePath, "storage-path", "", "path to storage")
-	flag.StringVar(&migrationsPath, "migrations-path", "", "path to migrations")
-	flag.StringVar(&migrationsTable, "migrations-table", "migrations", "name of migrations table")
+	flag.BoolVar(&jsonOutput, "json", false, "print version and status as json")
+	flag.Usage = usage
 	flag.Parse()
 
-	if storagePath == "" {
-		panic("storage-path is required")
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
 	}
 
-	if migrationsPath == "" {
-		panic("migrations-path is required")
-	}
+	cfg := config.MustLoad()
 
-	m, err := migrate.New(
-		"file://"+migrationsPath,
-		fmt.Sprintf("sqlite3://%s", storagePath),
+	var (
+		m   *migrator.Migrator
+		err error
 	)
-
+	if cfg.MigrationsPath != "" {
+		m, err = migrator.New("file://"+cfg.MigrationsPath, cfg.StoragePath)
+	} else {
+		m, err = migrator.NewEmbedded(cfg.StoragePath)
+	}
 	if err != nil {
-		panic(err)
+		fail(err)
 	}
-	if err := m.Up(); err != nil {
-		if errors.Is(err, migrate.ErrNoChange) {
-			fmt.Println("no migrations to apply")
+	defer m.Close()
+
+	switch cmd, rest := args[0], args[1:]; cmd {
+	case "up":
+		n := optionalInt(rest)
+		report(m.Up(n), "migrations applied successful")
+	case "down":
+		// A bare down rolls back one migration, dropping every table
+		// has to be asked for with -all.
+		downFlags := flag.NewFlagSet("down", flag.ExitOnError)
+		all := downFlags.Bool("all", false, "roll back all migrations")
+		downFlags.Usage = usage
+		downFlags.Parse(rest)
+
+		if *all {
+			if downFlags.NArg() > 0 {
+				fail(errors.New("down -all takes no number of migrations"))
+			}
+			report(m.DownAll(), "all migrations rolled back successful")
 			return
 		}
 
-		panic(err)
+		n := optionalInt(downFlags.Args())
+		if n == 0 {
+			n = 1
+		}
+		report(m.Down(n), "migrations rolled back successful")
+	case "goto":
+		v, err := strconv.ParseUint(requiredArg(rest, "version"), 10, 64)
+		if err != nil {
+			fail(fmt.Errorf("invalid version: %w", err))
+		}
+		report(m.Goto(uint(v)), fmt.Sprintf("migrated to version %d", v))
+	case "force":
+		v, err := strconv.Atoi(requiredArg(rest, "version"))
+		if err != nil || v < -1 {
+			fail(fmt.Errorf("invalid version %q", rest[0]))
+		}
+		report(m.Force(v), fmt.Sprintf("version forced to %d", v))
+	case "version":
+		v, dirty, err := m.Version()
+		if err != nil {
+			fail(err)
+		}
+		if jsonOutput {
+			printJSON(map[string]any{"version": v, "dirty": dirty})
+			return
+		}
+		if dirty {
+			fmt.Printf("%d (dirty)\n", v)
+			return
+		}
+		fmt.Println(v)
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			fail(err)
+		}
+		if jsonOutput {
+			printJSON(statuses)
+			return
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%-8s %s\n", state, s.Name)
+		}
+	default:
+		usage()
+		os.Exit(2)
 	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: migrator [-json] <command>
+
+commands:
+  up [N]      apply N pending migrations, all by default
+  down [N]    roll back N migrations, 1 by default
+  down -all   roll back all migrations and drop every table
+  goto V      migrate up or down to version V
+  force V     set version V without running migrations, -1 for none
+  version     print the applied version
+  status      list applied and pending migrations`)
+}
+
+func report(err error, msg string) {
+	if errors.Is(err, migrator.ErrNoChange) {
+		fmt.Println("no migrations to apply")
+		return
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Println(msg)
+}
+
+func optionalInt(args []string) int {
+	if len(args) == 0 {
+		return 0
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		fail(fmt.Errorf("invalid number of migrations %q", args[0]))
+	}
+
+	return n
+}
+
+func requiredArg(args []string, name string) string {
+	if len(args) == 0 {
+		fail(fmt.Errorf("%s is required", name))
+	}
+	return args[0]
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fail(err)
+	}
+}
 
-	fmt.Println("migrations applied successful")
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
 }
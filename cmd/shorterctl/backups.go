@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/backup"
+	"url-shorter/internal/storage/sqlite"
+)
+
+func backupCreate(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("backup create", flag.ExitOnError)
+	fs.Parse(args)
+
+	snapshot, err := backup.New(st, cfg.Backup.Dir, cfg.Backup.Keep).Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(ctx, st, audit.ActionBackupCreate, snapshot.Name, snapshot)
+
+	return out.message("snapshot taken", map[string]any{
+		"name": snapshot.Name,
+		"size": snapshot.Size,
+	})
+}
+
+func backupList(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("backup list", flag.ExitOnError)
+	fs.Parse(args)
+
+	snapshots, err := backup.New(nil, cfg.Backup.Dir, cfg.Backup.Keep).List()
+	if err != nil {
+		return err
+	}
+
+	if snapshots == nil {
+		snapshots = []backup.Snapshot{}
+	}
+
+	rows := make([][]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		rows = append(rows, []string{s.Name, strconv.FormatInt(s.Size, 10), formatTime(s.CreatedAt)})
+	}
+
+	return out.print(snapshots, []string{"NAME", "SIZE", "CREATED"}, rows)
+}
+
+// backupRestore swaps the database file, so it refuses to run while the
+// server has the database open.
+func backupRestore(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("backup restore", flag.ExitOnError)
+	name := fs.String("name", "", "snapshot name from backup list")
+	file := fs.String("file", "", "path to a database file")
+	fs.Parse(args)
+
+	src := *file
+	switch {
+	case *name != "" && *file != "":
+		return errors.New("--name and --file are mutually exclusive")
+	case *name != "":
+		snapshot, err := backup.New(nil, cfg.Backup.Dir, cfg.Backup.Keep).Find(*name)
+		if err != nil {
+			return err
+		}
+		src = snapshot.Path
+	case *file == "":
+		return errors.New("--name or --file is required")
+	}
+
+	if err := backup.Restore(src, cfg.StoragePath, cfg.Migrations.LockTimeout); err != nil {
+		return err
+	}
+
+	return out.message("database restored", map[string]any{
+		"from":     src,
+		"previous": cfg.StoragePath + ".pre-restore",
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/storage"
+	"url-shorter/internal/storage/sqlite"
+)
+
+type linkView struct {
+	ID        int64      `json:"id"`
+	Alias     string     `json:"alias"`
+	URL       string     `json:"url"`
+	UserID    int64      `json:"user_id,omitempty"`
+	Clicks    int        `json:"clicks_left"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+}
+
+func linkList(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("link list", flag.ExitOnError)
+	userID := fs.Int64("user-id", 0, "only links of this user")
+	limit := fs.Int("limit", 100, "max number of links, 0 for all")
+	fs.Parse(args)
+
+	return printLinks(ctx, st, out, storage.URLFilter{UserID: *userID, Limit: *limit})
+}
+
+func linkSearch(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("link search", flag.ExitOnError)
+	query := fs.String("query", "", "substring of the alias or destination")
+	limit := fs.Int("limit", 100, "max number of links, 0 for all")
+	fs.Parse(args)
+
+	if *query == "" {
+		return errors.New("--query is required")
+	}
+
+	return printLinks(ctx, st, out, storage.URLFilter{Query: *query, Limit: *limit})
+}
+
+func printLinks(ctx context.Context, st *sqlite.Storage, out *printer, filter storage.URLFilter) error {
+	urls, err := st.ListURLs(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	views := make([]linkView, 0, len(urls))
+	rows := make([][]string, 0, len(urls))
+	for _, u := range urls {
+		view := linkView{
+			ID:     u.ID,
+			Alias:  u.Alias,
+			URL:    u.URL,
+			UserID: u.UserID,
+			Clicks: u.Clicks,
+			Tags:   u.Tags,
+		}
+		if !u.ExpiresAt.IsZero() {
+			view.ExpiresAt = &u.ExpiresAt
+		}
+		views = append(views, view)
+
+		rows = append(rows, []string{
+			strconv.FormatInt(u.ID, 10),
+			u.Alias,
+			u.URL,
+			strconv.FormatInt(u.UserID, 10),
+			strconv.Itoa(u.Clicks),
+			formatTime(u.ExpiresAt),
+			strings.Join(u.Tags, ","),
+		})
+	}
+
+	return out.print(views, []string{"ID", "ALIAS", "URL", "USER", "CLICKS LEFT", "EXPIRES", "TAGS"}, rows)
+}
+
+func linkDelete(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("link delete", flag.ExitOnError)
+	alias := fs.String("alias", "", "alias of the link")
+	fs.Parse(args)
+
+	if *alias == "" {
+		return errors.New("--alias is required")
+	}
+
+	if err := st.DeleteURLByAlias(ctx, *alias); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, st, audit.ActionLinkDelete, *alias, nil)
+
+	return out.message("link deleted", map[string]any{"alias": *alias})
+}
+
+func linkPurgeExpired(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("link purge-expired", flag.ExitOnError)
+	fs.Parse(args)
+
+	purged, err := st.PurgeExpiredURLs(ctx)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(ctx, st, audit.ActionLinkPurge, "", map[string]any{"purged": purged})
+
+	return out.message("expired links purged", map[string]any{"purged": purged})
+}
+
+func stats(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Parse(args)
+
+	s, err := st.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	view := map[string]int64{
+		"users":           s.Users,
+		"disabled_users":  s.DisabledUsers,
+		"links":           s.URLs,
+		"expired_links":   s.ExpiredURLs,
+		"exhausted_links": s.ExhaustedURLs,
+		"clicks":          s.Clicks,
+	}
+
+	rows := make([][]string, 0, len(view))
+	for _, k := range sortedKeys(view) {
+		rows = append(rows, []string{k, strconv.FormatInt(view[k], 10)})
+	}
+
+	return out.print(view, []string{"METRIC", "VALUE"}, rows)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"url-shorter/internal/config"
+	"url-shorter/internal/lib/hash_password"
+	"url-shorter/internal/lib/password_policy"
+	"url-shorter/internal/storage/sqlite"
+)
+
+// go run ./cmd/shorterctl -o json user list
+// Works directly against the storage from CONFIG_PATH, no server needed.
+
+// offline commands run without an open storage, st is nil for them.
+type command struct {
+	usage   string
+	offline bool
+	run     func(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error
+}
+
+// cfg is loaded once the command line is parsed.
+var cfg *config.Config
+
+var commands = map[string]map[string]command{
+	"user": {
+		"create":         {usage: "--username NAME --email EMAIL [--password PASS]", run: userCreate},
+		"list":           {usage: "", run: userList},
+		"disable":        {usage: "--username NAME", run: userDisable(true)},
+		"enable":         {usage: "--username NAME", run: userDisable(false)},
+		"delete":         {usage: "--username NAME", run: userDelete},
+		"set-role":       {usage: "--username NAME --role admin|member|read-only", run: userSetRole},
+		"reset-password": {usage: "--username NAME [--password PASS]", run: userResetPassword},
+	},
+	"link": {
+		"list":          {usage: "[--user-id ID] [--limit N]", run: linkList},
+		"search":        {usage: "--query TEXT [--limit N]", run: linkSearch},
+		"delete":        {usage: "--alias ALIAS", run: linkDelete},
+		"purge-expired": {usage: "", run: linkPurgeExpired},
+	},
+	"stats": {
+		"": {usage: "", run: stats},
+	},
+	"backup": {
+		"create":  {usage: "", run: backupCreate},
+		"list":    {usage: "", offline: true, run: backupList},
+		"restore": {usage: "--name SNAPSHOT | --file PATH (server must be stopped)", offline: true, run: backupRestore},
+	},
+	"audit": {
+		"list":   {usage: "[--action ACTION] [--actor ACTOR] [--target TARGET] [--limit N]", run: auditList},
+		"verify": {usage: "", run: auditVerify},
+	},
+}
+
+func main() {
+	var output string
+
+	flag.StringVar(&output, "o", "table", "output format: table or json")
+	flag.Usage = usage
+	flag.Parse()
+
+	out, err := newPrinter(os.Stdout, output)
+	if err != nil {
+		fail(err)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	group, ok := commands[args[0]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	name := ""
+	if len(args) > 1 {
+		name = args[1]
+	}
+
+	cmd, ok := group[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	rest := args[1:]
+	if name != "" {
+		rest = args[2:]
+	}
+
+	cfg = config.MustLoad()
+
+	var st *sqlite.Storage
+	if !cmd.offline {
+		st, err = sqlite.NewStorage(cfg.StoragePath, sqlite.Options(cfg.SQLite))
+		if err != nil {
+			fail(err)
+		}
+		defer st.Close()
+
+		if err := setupPasswords(st, cfg.Passwords); err != nil {
+			fail(err)
+		}
+	}
+
+	// Ctrl-C cancels the running query instead of killing it midway.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := cmd.run(ctx, st, out, rest); err != nil {
+		stop()
+		if st != nil {
+			st.Close()
+		}
+		fail(err)
+	}
+}
+
+// setupPasswords hashes and checks passwords like the server does.
+func setupPasswords(st *sqlite.Storage, cfg config.Passwords) error {
+	hasher, err := hash_password.New(hash_password.Config(cfg.Hashing))
+	if err != nil {
+		return err
+	}
+
+	policy, err := password_policy.NewPolicy(password_policy.Config(cfg.Policy))
+	if err != nil {
+		return err
+	}
+
+	st.SetPasswordHasher(hasher)
+	st.SetPasswordPolicy(policy)
+
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: shorterctl [-o table|json] <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, groupName := range []string{"user", "link", "stats", "backup", "audit"} {
+		for _, name := range sortedKeys(commands[groupName]) {
+			fmt.Fprintf(os.Stderr, "  %s %s %s\n", groupName, name, commands[groupName][name].usage)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"strconv"
+	"time"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/storage/sqlite"
+)
+
+type userView struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func userCreate(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	username := fs.String("username", "", "username")
+	email := fs.String("email", "", "email")
+	password := fs.String("password", "", "password, generated when empty")
+	fs.Parse(args)
+
+	if *username == "" || *email == "" {
+		return errors.New("--username and --email are required")
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = generatePassword()
+	}
+
+	id, err := st.SaveUser(ctx, *username, *email, *password)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(ctx, st, audit.ActionUserRegister, *username, map[string]any{"id": id, "email": *email})
+
+	fields := map[string]any{"id": id, "username": *username}
+	if generated {
+		fields["password"] = *password
+	}
+
+	return out.message("user created", fields)
+}
+
+func userList(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("user list", flag.ExitOnError)
+	fs.Parse(args)
+
+	users, err := st.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	views := make([]userView, 0, len(users))
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		views = append(views, userView{
+			ID:        u.ID,
+			Username:  u.Username,
+			Email:     u.Email,
+			Role:      u.Role,
+			Disabled:  u.Disabled,
+			CreatedAt: u.CreatedAt,
+		})
+		rows = append(rows, []string{
+			strconv.FormatInt(u.ID, 10),
+			u.Username,
+			u.Email,
+			u.Role,
+			strconv.FormatBool(u.Disabled),
+			formatTime(u.CreatedAt),
+		})
+	}
+
+	return out.print(views, []string{"ID", "USERNAME", "EMAIL", "ROLE", "DISABLED", "CREATED"}, rows)
+}
+
+func userDisable(disabled bool) func(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	return func(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+		fs := flag.NewFlagSet("user disable", flag.ExitOnError)
+		username := fs.String("username", "", "username")
+		fs.Parse(args)
+
+		if *username == "" {
+			return errors.New("--username is required")
+		}
+
+		if err := st.SetUserDisabled(ctx, *username, disabled); err != nil {
+			return err
+		}
+
+		msg, action := "user enabled", audit.ActionUserEnable
+		if disabled {
+			msg, action = "user disabled", audit.ActionUserDisable
+		}
+
+		recordAudit(ctx, st, action, *username, nil)
+
+		return out.message(msg, map[string]any{"username": *username})
+	}
+}
+
+func userSetRole(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("user set-role", flag.ExitOnError)
+	username := fs.String("username", "", "username")
+	role := fs.String("role", "", "admin, member or read-only")
+	fs.Parse(args)
+
+	if *username == "" || *role == "" {
+		return errors.New("--username and --role are required")
+	}
+
+	user, err := st.GetUser(ctx, *username)
+	if err != nil {
+		return err
+	}
+
+	if err := st.SetUserRole(ctx, *username, *role); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, st, audit.ActionUserRoleChange, *username, audit.Change{Old: user.Role, New: *role})
+
+	return out.message("role changed", map[string]any{"username": *username, "role": *role})
+}
+
+func userDelete(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("user delete", flag.ExitOnError)
+	username := fs.String("username", "", "username")
+	fs.Parse(args)
+
+	if *username == "" {
+		return errors.New("--username is required")
+	}
+
+	if err := st.DeleteUser(ctx, *username); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, st, audit.ActionUserDelete, *username, nil)
+
+	return out.message("user deleted", map[string]any{"username": *username})
+}
+
+func userResetPassword(ctx context.Context, st *sqlite.Storage, out *printer, args []string) error {
+	fs := flag.NewFlagSet("user reset-password", flag.ExitOnError)
+	username := fs.String("username", "", "username")
+	password := fs.String("password", "", "new password, generated when empty")
+	fs.Parse(args)
+
+	if *username == "" {
+		return errors.New("--username is required")
+	}
+
+	generated := *password == ""
+	if generated {
+		*password = generatePassword()
+	}
+
+	if err := st.SetPassword(ctx, *username, *password); err != nil {
+		return err
+	}
+
+	recordAudit(ctx, st, audit.ActionPasswordChange, *username, nil)
+
+	fields := map[string]any{"username": *username}
+	if generated {
+		fields["password"] = *password
+	}
+
+	return out.message("password reset", fields)
+}
+
+func generatePassword() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		fail(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
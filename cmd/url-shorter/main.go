@@ -1,100 +1,529 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"url-shorter/internal/account"
+	"url-shorter/internal/audit"
+	"url-shorter/internal/backup"
 	"url-shorter/internal/config"
+	accountExport "url-shorter/internal/http-server/handlers/account/export"
+	"url-shorter/internal/http-server/handlers/account/password"
+	"url-shorter/internal/http-server/handlers/account/profile"
+	"url-shorter/internal/http-server/handlers/account/remove"
+	accountTwoFactor "url-shorter/internal/http-server/handlers/account/twofactor"
+	"url-shorter/internal/http-server/handlers/account/update"
+	"url-shorter/internal/http-server/handlers/account/verify"
+	"url-shorter/internal/http-server/handlers/admin/auditlog"
+	adminBackup "url-shorter/internal/http-server/handlers/admin/backup"
+	adminLinks "url-shorter/internal/http-server/handlers/admin/links"
+	"url-shorter/internal/http-server/handlers/admin/loglevel"
+	adminUsers "url-shorter/internal/http-server/handlers/admin/users"
+	"url-shorter/internal/http-server/handlers/auth/login"
 	"url-shorter/internal/http-server/handlers/auth/register"
 	"url-shorter/internal/http-server/handlers/delete"
+	"url-shorter/internal/http-server/handlers/health"
+	"url-shorter/internal/http-server/handlers/orgs"
+	"url-shorter/internal/http-server/handlers/orgs/invites"
+	orgLinks "url-shorter/internal/http-server/handlers/orgs/links"
+	"url-shorter/internal/http-server/handlers/orgs/members"
 	"url-shorter/internal/http-server/handlers/redirect"
+	"url-shorter/internal/http-server/handlers/url/batchdelete"
+	"url-shorter/internal/http-server/handlers/url/batchsave"
+	"url-shorter/internal/http-server/handlers/url/exporter"
+	"url-shorter/internal/http-server/handlers/url/importer"
 	"url-shorter/internal/http-server/handlers/url/save"
+	"url-shorter/internal/http-server/handlers/version"
+	mwAdmin "url-shorter/internal/http-server/middleware/admin"
 	myMiddleware "url-shorter/internal/http-server/middleware/authentication"
+	mwAuthz "url-shorter/internal/http-server/middleware/authorization"
 	mwLogger "url-shorter/internal/http-server/middleware/logger"
+	mwTracing "url-shorter/internal/http-server/middleware/tracing"
 	mwUserInfo "url-shorter/internal/http-server/middleware/uinfo"
+	"url-shorter/internal/lib/alias_validation"
+	"url-shorter/internal/lib/hash_password"
+	"url-shorter/internal/lib/logger"
+	"url-shorter/internal/lib/logger/redact"
 	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/password_policy"
+	"url-shorter/internal/lib/token"
+	"url-shorter/internal/lib/tracing"
+	"url-shorter/internal/lib/url_validation"
+	"url-shorter/internal/mailer"
+	"url-shorter/internal/migrator"
+	models "url-shorter/internal/storage"
 	"url-shorter/internal/storage/sqlite"
-)
-
-const (
-	envLocal = "local"
-	envDev   = "dev"
-	envProd  = "prod"
+	"url-shorter/internal/twofactor"
+	workerUInfo "url-shorter/internal/worker/uinfo"
 )
 
 func main() {
 	cfg := config.MustLoad()
 
-	log := setupLogger(cfg.Env)
+	log, logLevel, closeLog, err := logger.Setup(logger.Config{
+		Level:     cfg.Logging.Level,
+		Format:    cfg.Logging.Format,
+		Output:    cfg.Logging.Output,
+		FilePath:  cfg.Logging.FilePath,
+		AddSource: cfg.Logging.AddSource,
+		Redact:    redact.Options(cfg.Logging.Redact),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to init logger: %s\n", err)
+		os.Exit(1)
+	}
+	defer closeLog()
 
 	log.Info("starting url shorter", slog.String("env", cfg.Env))
 	log.Debug("debug message are enabled")
 
-	storage, err := sqlite.NewStorage(cfg.StoragePath)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		FilePath:    cfg.Tracing.FilePath,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
+	// Held while the server runs, so that a backup restore does not swap
+	// the database from under it.
+	unlockStorage, err := migrator.LockShared(cfg.StoragePath+".lock", cfg.Migrations.LockTimeout)
+	if err != nil {
+		log.Error("failed to lock storage", sl.Err(err))
+		os.Exit(1)
+	}
+	defer unlockStorage()
+
+	if err := migrateStorage(log, cfg); err != nil {
+		log.Error("failed to check storage schema", sl.Err(err))
+		os.Exit(1)
+	}
+
+	storage, err := sqlite.NewStorage(cfg.StoragePath, sqlite.Options(cfg.SQLite))
 	if err != nil {
 		log.Error("failed to init storage", sl.Err(err))
 		os.Exit(1)
 	}
 
+	if err := setupPasswords(storage, cfg.Passwords); err != nil {
+		log.Error("failed to init password hashing", sl.Err(err))
+		os.Exit(1)
+	}
+
+	expectedSchema, err := migrator.EmbeddedLatest()
+	if err != nil {
+		log.Error("failed to read embedded migrations", sl.Err(err))
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	aliasPolicy, err := alias_validation.NewPolicy(alias_validation.Config{
+		MinLength:     cfg.Alias.MinLength,
+		MaxLength:     cfg.Alias.MaxLength,
+		Charset:       cfg.Alias.Charset,
+		CaseFold:      cfg.Alias.CaseFold,
+		Reserved:      cfg.Alias.Reserved,
+		BlocklistPath: cfg.Alias.BlocklistPath,
+	})
+	if err != nil {
+		log.Error("failed to init alias policy", sl.Err(err))
+		os.Exit(1)
+	}
+
+	ownHosts := cfg.URLPolicy.OwnHosts
+	if host, _, err := net.SplitHostPort(cfg.Address); err == nil && host != "" {
+		ownHosts = append(ownHosts, host)
+	}
+
+	urlPolicy, err := url_validation.NewPolicy(url_validation.PolicyConfig{
+		AllowedSchemes:     cfg.URLPolicy.AllowedSchemes,
+		AllowDomains:       cfg.URLPolicy.AllowDomains,
+		DenyDomains:        cfg.URLPolicy.DenyDomains,
+		BlockPrivateIPs:    cfg.URLPolicy.BlockPrivateIPs,
+		OwnHosts:           ownHosts,
+		MaliciousHostsPath: cfg.URLPolicy.MaliciousHostsPath,
+		SortQuery:          cfg.URLPolicy.SortQuery,
+	})
+	if err != nil {
+		log.Error("failed to init url policy", sl.Err(err))
+		os.Exit(1)
+	}
+
+	go reloadOnSIGHUP(log, aliasPolicy, urlPolicy)
+
+	auditor := audit.New(log, storage)
+
+	if err := seedAdmin(ctx, log, storage, auditor, cfg.Admin.Seed); err != nil {
+		log.Error("failed to seed admin user", sl.Err(err))
+		os.Exit(1)
+	}
+
+	mail, err := mailer.New(log, mailer.Config{
+		Transport: cfg.Mail.Transport,
+		From:      cfg.Mail.From,
+		FilePath:  cfg.Mail.FilePath,
+		SMTP:      mailer.SMTPConfig(cfg.Mail.SMTP),
+	})
+	if err != nil {
+		log.Error("failed to init mailer", sl.Err(err))
+		os.Exit(1)
+	}
+
+	if cfg.Account.TokenSecret == "" {
+		log.Warn("account token secret is not set, reset and verification links stop working on restart")
+	}
+	signer, err := token.New([]byte(cfg.Account.TokenSecret))
+	if err != nil {
+		log.Error("failed to init token signer", sl.Err(err))
+		os.Exit(1)
+	}
+
+	accounts := account.New(storage, signer, mail, account.Config{
+		BaseURL:    cfg.Account.BaseURL,
+		VerifyTTL:  cfg.Account.VerifyTTL,
+		ResetTTL:   cfg.Account.ResetTTL,
+		SessionTTL: cfg.Account.SessionTTL,
+	})
+
+	secondFactor := twofactor.New(storage, twofactor.Config{
+		Issuer:        cfg.TwoFactor.Issuer,
+		RecoveryCodes: cfg.TwoFactor.RecoveryCodes,
+	})
+
+	snapshots := backup.New(storage, cfg.Backup.Dir, cfg.Backup.Keep)
+	if cfg.Backup.Interval > 0 {
+		go snapshots.Run(ctx, log, cfg.Backup.Interval)
+	}
+
 	router := chi.NewRouter()
 
 	router.Use(middleware.RequestID)
+	router.Use(mwTracing.New())
 	router.Use(mwLogger.New(log))
 	router.Use(mwUserInfo.GetUserInfo(log))
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
 
-	router.Get("/url/{alias}", redirect.New(log, storage))
+	router.Get("/url/{alias}", redirect.New(log, storage, workerUInfo.NewRecorder(log, storage)))
 
-	authMiddleware := myMiddleware.BasicAuthMiddleware(log, storage)
+	authMiddleware := myMiddleware.BasicAuthMiddleware(log, storage, accounts, auditor)
 	router.Route("/url", func(r chi.Router) {
 		r.Use(authMiddleware)
-		r.Post("/", save.New(log, storage))
-		r.Delete("/{id}", delete.New(log, storage))
+		r.Use(mwAuthz.RequireWriter(log))
+		r.Post("/", save.New(log, storage, aliasPolicy, urlPolicy, auditor))
+		r.Post("/batch", batchsave.New(log, storage, aliasPolicy, urlPolicy, auditor, cfg.Batch.MaxItems, cfg.Batch.MaxBytes))
+		r.Delete("/batch", batchdelete.New(log, storage, auditor, cfg.Batch.MaxItems, cfg.Batch.MaxBytes))
+		r.Post("/import", importer.New(log, storage, aliasPolicy, urlPolicy, auditor, cfg.Import.MaxRows, cfg.Import.MaxBytes))
+		r.Delete("/{id}", delete.New(log, storage, auditor))
+	})
+	// Registered next to the redirect route, a static segment wins over {alias}.
+	router.With(authMiddleware).Get("/url/export", exporter.New(log, storage))
+
+	router.Route("/account", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", profile.New())
+		r.With(mwAuthz.RequireWriter(log)).Patch("/", update.New(log, storage, accounts, auditor))
+		r.With(mwAuthz.RequireWriter(log)).Delete("/", remove.New(log, storage, auditor))
+		r.Get("/export", accountExport.New(log, storage))
+		r.Post("/password", password.New(log, storage, auditor))
+		r.Post("/verify-email", verify.NewResend(log, accounts))
+
+		r.Route("/2fa", func(r chi.Router) {
+			r.Get("/", accountTwoFactor.New(log, secondFactor))
+			r.Post("/", accountTwoFactor.NewEnroll(log, secondFactor))
+			r.Delete("/", accountTwoFactor.NewDisable(log, secondFactor, auditor))
+			r.Post("/verify", accountTwoFactor.NewConfirm(log, secondFactor, auditor))
+			r.Post("/recovery-codes", accountTwoFactor.NewRecoveryCodes(log, secondFactor, auditor))
+		})
 	})
 
-	router.Post("/register", register.New(log, storage))
+	router.Post("/register", register.New(log, storage, accounts, auditor))
+	router.Post("/login", login.New(log, storage, secondFactor, accounts, auditor))
+	router.Post("/password/forgot", password.NewForgot(log, storage, accounts))
+	router.Post("/password/reset", password.NewReset(log, accounts, storage, auditor))
+	router.Get("/verify-email", verify.New(log, accounts, storage, auditor))
+	router.Post("/verify-email", verify.New(log, accounts, storage, auditor))
+
+	router.Route("/orgs", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", orgs.NewList(log, storage))
+		r.With(mwAuthz.RequireWriter(log)).Post("/", orgs.New(log, storage, auditor))
+
+		r.Route("/{org}", func(r chi.Router) {
+			r.Use(mwAuthz.RequireOrgMember(log, storage))
+			r.Get("/", orgs.NewGet())
+			r.Get("/members", members.New(log, storage))
+			r.Get("/links", orgLinks.New(log, storage))
+			r.Get("/links/{alias}/stats", orgLinks.NewStats(log, storage))
+
+			r.Group(func(r chi.Router) {
+				r.Use(mwAuthz.RequireWriter(log))
+				r.Post("/links", orgLinks.NewSave(log, storage, aliasPolicy, urlPolicy, auditor))
+				r.Patch("/links/{alias}", orgLinks.NewUpdate(log, storage, urlPolicy, auditor))
+				r.Delete("/links/{alias}", orgLinks.NewDelete(log, storage, auditor))
+				r.Delete("/members/{username}", members.NewRemove(log, storage, auditor))
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(mwAuthz.RequireWriter(log))
+				r.Use(mwAuthz.RequireOrgAdmin(log, storage))
+				r.Patch("/", orgs.NewUpdate(log, storage, auditor))
+				r.Patch("/members/{username}", members.NewUpdate(log, storage, auditor))
+				r.Get("/invites", invites.NewList(log, storage))
+				r.Post("/invites", invites.New(log, storage, cfg.Orgs.InviteTTL, auditor))
+				r.Delete("/invites/{id}", invites.NewRevoke(log, storage, auditor))
+			})
+
+			r.With(mwAuthz.RequireWriter(log), mwAuthz.RequireOrgRole(log, storage, models.OrgRoleOwner)).
+				Delete("/", orgs.NewDelete(log, storage, auditor))
+		})
+	})
+	router.With(authMiddleware).Post("/invites/accept", invites.NewAccept(log, storage, auditor))
+
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(mwAdmin.TokenMiddleware(log, cfg.Admin.Token, func(h http.Handler) http.Handler {
+			return authMiddleware(mwAuthz.RequireAdmin(log)(h))
+		}))
+		r.Post("/backups", adminBackup.New(log, snapshots, auditor))
+		r.Get("/backups", adminBackup.NewList(log, snapshots))
+		r.Get("/log-level", loglevel.New(logLevel))
+		r.Put("/log-level", loglevel.NewSet(log, logLevel, auditor))
+		r.Get("/audit", auditlog.New(log, storage))
+		r.Get("/audit/export", auditlog.NewExport(log, storage))
+		r.Get("/audit/verify", auditlog.NewVerify(log, storage))
+		r.Get("/users", adminUsers.New(log, storage))
+		r.Patch("/users/{username}", adminUsers.NewUpdate(log, storage, auditor))
+		r.Get("/links", adminLinks.New(log, storage))
+		r.Put("/links/{alias}/owner", adminLinks.NewTransfer(log, storage, auditor))
+	})
+
+	var shuttingDown atomic.Bool
+
+	// Probes and build info bypass the router middlewares, so orchestrator
+	// polling neither floods the request log nor the click pipeline.
+	mux := http.NewServeMux()
+	mux.Handle("GET /healthz", health.NewLiveness())
+	mux.Handle("GET /readyz", health.NewReadiness(log, &shuttingDown,
+		health.Check{Name: "storage", Func: storage.Ping},
+		health.Check{Name: "migrations", Func: schemaCheck(storage, expectedSchema)},
+		health.Check{Name: "click_pipeline", Func: clickPipelineCheck},
+	))
+	mux.Handle("GET /version", version.New())
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("/", router)
 
 	log.Info("starting server", slog.String("address", cfg.Address))
 
 	srv := &http.Server{
 		Addr:         cfg.Address,
-		Handler:      router,
+		Handler:      mux,
 		ReadTimeout:  cfg.HTTPServer.Timeout,
 		WriteTimeout: cfg.HTTPServer.Timeout,
 		IdleTimeout:  cfg.HTTPServer.Idle_timeout,
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start server", sl.Err(err))
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	shuttingDown.Store(true)
+	log.Info("shutting down", slog.Duration("delay", cfg.ShutdownDelay))
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to shut down server", sl.Err(err))
+	}
+
+	if err := storage.Close(); err != nil {
+		log.Error("failed to close storage", sl.Err(err))
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error("failed to flush traces", sl.Err(err))
+	}
+
+	log.Info("server stopped")
+}
+
+// schemaCheck fails readiness when the schema is not the one this binary
+// was built for, e.g. after cmd/migrator ran against a live server.
+func schemaCheck(storage *sqlite.Storage, want uint) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		version, dirty, err := storage.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case dirty:
+			return fmt.Errorf("version %d: %w", version, migrator.ErrDirty)
+		case version > want:
+			return fmt.Errorf("version %d, want %d: %w", version, want, migrator.ErrSchemaTooNew)
+		case version < want:
+			return fmt.Errorf("version %d, want %d: %w", version, want, migrator.ErrSchemaOutdated)
+		}
+
+		return nil
+	}
+}
+
+var errClickPipelineSaturated = errors.New("click queue is full")
+
+func clickPipelineCheck(context.Context) error {
+	if workerUInfo.Saturated() {
+		return errClickPipelineSaturated
+	}
+	return nil
+}
+
+// migrateStorage applies pending embedded migrations when auto_apply is
+// on and refuses a schema the binary does not understand. Without
+// auto_apply an outdated schema is refused too: the storage prepares its
+// statements against the newest columns and could not start on it.
+func migrateStorage(log *slog.Logger, cfg *config.Config) error {
+	m, err := migrator.NewEmbedded(cfg.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if cfg.Migrations.AutoApply {
+		unlock, err := migrator.Lock(cfg.StoragePath+".migrate.lock", cfg.Migrations.LockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		// Another instance may have migrated while we waited for the lock,
+		// check again so a newer schema is never touched.
+		if err := m.Check(); !errors.Is(err, migrator.ErrSchemaOutdated) {
+			return err
+		}
+
+		if err := m.Up(0); err != nil && !errors.Is(err, migrator.ErrNoChange) {
+			return err
+		}
+
+		version, _, _ := m.Version()
+		log.Info("migrations applied", slog.Uint64("version", uint64(version)))
+	}
+
+	err = m.Check()
+	if errors.Is(err, migrator.ErrSchemaOutdated) {
+		return fmt.Errorf("storage schema is outdated, run the migrator or set migrations.auto_apply: %w", err)
+	}
+
+	return err
+}
+
+// seedAdmin creates the admin account from the config unless a user with
+// that username exists. An existing user is left alone, promoting it
+// would hand admin rights to whoever registered the name first.
+func seedAdmin(ctx context.Context, log *slog.Logger, storage *sqlite.Storage, auditor *audit.Recorder, seed config.AdminSeed) error {
+	if seed.Username == "" {
+		return nil
+	}
+
+	user, err := storage.GetUser(ctx, seed.Username)
+	if err == nil {
+		if user.Role != models.RoleAdmin {
+			log.Warn("seeded admin exists but is not an admin", slog.String("username", seed.Username), slog.String("role", user.Role))
+		}
+		return nil
+	}
+	if !errors.Is(err, models.ErrUserNotFound) {
+		return err
+	}
+
+	if seed.Email == "" || seed.Password == "" {
+		return errors.New("admin seed needs email and password")
+	}
+
+	id, err := storage.SaveUser(ctx, seed.Username, seed.Email, seed.Password)
+	if err != nil {
+		return err
+	}
+	if err := storage.SetUserRole(ctx, seed.Username, models.RoleAdmin); err != nil {
+		return err
+	}
+
+	auditor.Append(ctx, models.AuditEntry{
+		ActorID: id,
+		Actor:   "config",
+		Action:  audit.ActionUserRegister,
+		Target:  seed.Username,
+	}, map[string]string{"email": seed.Email, "role": models.RoleAdmin})
+
+	log.Info("admin user seeded", slog.String("username", seed.Username))
+
+	return nil
+}
+
+// setupPasswords makes storage hash and check passwords as configured.
+func setupPasswords(storage *sqlite.Storage, cfg config.Passwords) error {
+	hasher, err := hash_password.New(hash_password.Config(cfg.Hashing))
+	if err != nil {
+		return err
+	}
+
+	policy, err := password_policy.NewPolicy(password_policy.Config(cfg.Policy))
+	if err != nil {
+		return err
 	}
 
-	log.Error("server stopped")
+	storage.SetPasswordHasher(hasher)
+	storage.SetPasswordPolicy(policy)
 
+	return nil
 }
 
-func setupLogger(env string) *slog.Logger {
-	var log *slog.Logger
-
-	switch env {
-	case envLocal:
-		log = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
-		)
-	case envDev:
-		log = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
-		)
-	case envProd:
-		log = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
-		)
-	}
-
-	return log
+// reloadOnSIGHUP rereads the alias blocklist and the malicious hosts list
+// every time the process gets SIGHUP.
+func reloadOnSIGHUP(log *slog.Logger, aliasPolicy *alias_validation.Policy, urlPolicy *url_validation.Policy) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	for range sighup {
+		if err := aliasPolicy.ReloadBlocklist(); err != nil {
+			log.Error("failed to reload alias blocklist", sl.Err(err))
+		} else {
+			log.Info("alias blocklist reloaded")
+		}
+
+		if err := urlPolicy.ReloadMaliciousHosts(); err != nil {
+			log.Error("failed to reload malicious hosts", sl.Err(err))
+		} else {
+			log.Info("malicious hosts reloaded")
+		}
+	}
 }
@@ -0,0 +1,203 @@
+// Package account sends the emails of the password reset and email
+// verification flows and checks the tokens they carry. It also issues the
+// session tokens handed out at login.
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"url-shorter/internal/lib/token"
+	"url-shorter/internal/mailer"
+	"url-shorter/internal/storage"
+)
+
+const (
+	purposeVerify  = "verify_email"
+	purposeReset   = "reset_password"
+	purposeSession = "session"
+)
+
+// ErrAlreadyVerified is returned for a verification token of an email
+// that has been verified since.
+var ErrAlreadyVerified = errors.New("email is already verified")
+
+type UserGetter interface {
+	GetUserByID(ctx context.Context, id int64) (storage.User, error)
+	PasswordHash(ctx context.Context, id int64) (string, error)
+}
+
+type Config struct {
+	// BaseURL is where the links in emails point, e.g. the frontend that
+	// calls the API with the token.
+	BaseURL    string
+	VerifyTTL  time.Duration
+	ResetTTL   time.Duration
+	SessionTTL time.Duration
+}
+
+type Service struct {
+	users  UserGetter
+	signer *token.Signer
+	mailer mailer.Mailer
+	cfg    Config
+}
+
+func New(users UserGetter, signer *token.Signer, m mailer.Mailer, cfg Config) *Service {
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	return &Service{users: users, signer: signer, mailer: m, cfg: cfg}
+}
+
+// SendVerification mails the user a link proving they own their email.
+// The token stops working when the email changes or gets verified.
+func (s *Service) SendVerification(ctx context.Context, user storage.User) error {
+	const fn = "account.SendVerification"
+
+	tok := s.signer.Sign(purposeVerify, user.ID, user.Email, s.cfg.VerifyTTL)
+
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hi %s,\n\nconfirm your email by opening\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, s.link("/verify-email", tok), s.cfg.VerifyTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// CheckVerification returns the user whose email tok verifies.
+func (s *Service) CheckVerification(ctx context.Context, tok string) (storage.User, error) {
+	const fn = "account.CheckVerification"
+
+	var user storage.User
+
+	_, err := s.signer.Verify(tok, purposeVerify, func(id int64) (string, error) {
+		var err error
+		user, err = s.users.GetUserByID(ctx, id)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", token.ErrInvalid
+		}
+		return user.Email, err
+	})
+	if err != nil {
+		return storage.User{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if user.EmailVerified {
+		return storage.User{}, fmt.Errorf("%s: %w", fn, ErrAlreadyVerified)
+	}
+
+	return user, nil
+}
+
+// SendPasswordReset mails the user a link to choose a new password. The
+// token stops working once the password changes, so it is used at most
+// once.
+func (s *Service) SendPasswordReset(ctx context.Context, user storage.User) error {
+	const fn = "account.SendPasswordReset"
+
+	hash, err := s.users.PasswordHash(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	tok := s.signer.Sign(purposeReset, user.ID, hash, s.cfg.ResetTTL)
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset the password of your account. Choose a new one at\n\n%s\n\n"+
+			"The link expires in %s. If it was not you, ignore this email.\n",
+			user.Username, s.link("/password/reset", tok), s.cfg.ResetTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// CheckPasswordReset returns the user whose password tok may reset.
+func (s *Service) CheckPasswordReset(ctx context.Context, tok string) (storage.User, error) {
+	const fn = "account.CheckPasswordReset"
+
+	id, err := s.signer.Verify(tok, purposeReset, func(id int64) (string, error) {
+		hash, err := s.users.PasswordHash(ctx, id)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", token.ErrInvalid
+		}
+		return hash, err
+	})
+	if err != nil {
+		return storage.User{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	user, err := s.users.GetUserByID(ctx, id)
+	if err != nil {
+		return storage.User{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return user, nil
+}
+
+// IssueSession returns a bearer token for the user and when it expires.
+// Sessions are bound to the password hash and the two-factor state,
+// changing either ends all of them.
+func (s *Service) IssueSession(ctx context.Context, user storage.User) (string, time.Time, error) {
+	const fn = "account.IssueSession"
+
+	hash, err := s.users.PasswordHash(ctx, user.ID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	expiresAt := time.Now().Add(s.cfg.SessionTTL)
+	tok := s.signer.Sign(purposeSession, user.ID, sessionState(hash, user), s.cfg.SessionTTL)
+
+	return tok, expiresAt, nil
+}
+
+// CheckSession returns the user tok was issued for.
+func (s *Service) CheckSession(ctx context.Context, tok string) (storage.User, error) {
+	const fn = "account.CheckSession"
+
+	var user storage.User
+
+	_, err := s.signer.Verify(tok, purposeSession, func(id int64) (string, error) {
+		var err error
+		user, err = s.users.GetUserByID(ctx, id)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", token.ErrInvalid
+		}
+		if err != nil {
+			return "", err
+		}
+
+		hash, err := s.users.PasswordHash(ctx, id)
+		if err != nil {
+			return "", err
+		}
+
+		return sessionState(hash, user), nil
+	})
+	if err != nil {
+		return storage.User{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return user, nil
+}
+
+func sessionState(passwordHash string, user storage.User) string {
+	return fmt.Sprintf("%s|%t", passwordHash, user.TOTPEnabled)
+}
+
+func (s *Service) link(path, tok string) string {
+	return s.cfg.BaseURL + path + "?token=" + url.QueryEscape(tok)
+}
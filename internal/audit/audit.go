@@ -0,0 +1,161 @@
+// Package audit records security and administrative events into the
+// hash-chained audit log kept by the storage.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/storage"
+)
+
+const (
+	ActionUserRegister   = "user.register"
+	ActionUserUpdate     = "user.update"
+	ActionUserDisable    = "user.disable"
+	ActionUserEnable     = "user.enable"
+	ActionUserDelete     = "user.delete"
+	ActionUserRoleChange = "user.role_change"
+	ActionPasswordChange = "user.password_change"
+	ActionPasswordReset  = "user.password_reset"
+	ActionEmailVerify    = "user.email_verify"
+	ActionTOTPEnable     = "user.2fa_enable"
+	ActionTOTPDisable    = "user.2fa_disable"
+	ActionRecoveryRenew  = "user.2fa_recovery_codes"
+	ActionLogin          = "auth.login"
+	ActionLoginFailed    = "auth.login_failed"
+	ActionLinkCreate     = "link.create"
+	ActionLinkUpdate     = "link.update"
+	ActionLinkDelete     = "link.delete"
+	ActionLinkTransfer   = "link.transfer"
+	ActionLinkPurge      = "link.purge"
+	ActionBackupCreate   = "admin.backup_create"
+	ActionLogLevelChange = "admin.log_level_change"
+
+	ActionOrgCreate           = "org.create"
+	ActionOrgUpdate           = "org.update"
+	ActionOrgDelete           = "org.delete"
+	ActionOrgInviteCreate     = "org.invite_create"
+	ActionOrgInviteRevoke     = "org.invite_revoke"
+	ActionOrgMemberJoin       = "org.member_join"
+	ActionOrgMemberRoleChange = "org.member_role_change"
+	ActionOrgMemberRemove     = "org.member_remove"
+)
+
+// ActorAdmin is the actor of requests authenticated with the admin token.
+const ActorAdmin = "admin"
+
+type Appender interface {
+	AppendAudit(ctx context.Context, e storage.AuditEntry) (storage.AuditEntry, error)
+}
+
+// Event is what the caller knows about an action; Recorder adds the time,
+// the request metadata and the chain hashes. Details is marshalled to
+// JSON, Change fits most of them.
+type Event struct {
+	Action  string
+	ActorID int64
+	Actor   string
+	Target  string
+	Details any
+}
+
+// Change holds the values before and after an action.
+type Change struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+// Link is how links appear in event details. Clicks is the number of
+// redirects left.
+type Link struct {
+	ID        int64      `json:"id,omitempty"`
+	Alias     string     `json:"alias"`
+	URL       string     `json:"url"`
+	UserID    int64      `json:"user_id,omitempty"`
+	OrgID     int64      `json:"org_id,omitempty"`
+	Clicks    int        `json:"clicks"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+}
+
+func LinkOf(u storage.URL) Link {
+	l := Link{
+		ID:     u.ID,
+		Alias:  u.Alias,
+		URL:    u.URL,
+		UserID: u.UserID,
+		OrgID:  u.OrgID,
+		Clicks: u.Clicks,
+		Tags:   u.Tags,
+	}
+	if !u.ExpiresAt.IsZero() {
+		l.ExpiresAt = &u.ExpiresAt
+	}
+	return l
+}
+
+// Auditor records an event of the request. Handlers take it instead of
+// the Recorder.
+type Auditor interface {
+	Record(r *http.Request, e Event)
+}
+
+type Recorder struct {
+	log      *slog.Logger
+	appender Appender
+}
+
+func New(log *slog.Logger, appender Appender) *Recorder {
+	return &Recorder{log: log, appender: appender}
+}
+
+// Record appends e to the audit log. Failures are logged and counted but
+// not returned: the action already happened and an audit outage must not
+// take the API down with it.
+func (rec *Recorder) Record(r *http.Request, e Event) {
+	// Written even if the client went away in the meantime.
+	ctx := context.WithoutCancel(r.Context())
+
+	rec.Append(ctx, storage.AuditEntry{
+		ActorID:    e.ActorID,
+		Actor:      e.Actor,
+		Action:     e.Action,
+		Target:     e.Target,
+		RemoteAddr: r.RemoteAddr,
+		RequestID:  middleware.GetReqID(ctx),
+	}, e.Details)
+}
+
+// Append is Record for callers without a request, like shorterctl.
+func (rec *Recorder) Append(ctx context.Context, entry storage.AuditEntry, details any) {
+	const fn = "audit.Append"
+
+	log := rec.log.With(
+		slog.String("fn", fn),
+		slog.String("action", entry.Action),
+		sl.Trace(ctx),
+	)
+
+	if details != nil {
+		b, err := json.Marshal(details)
+		if err != nil {
+			log.Error("failed to marshal audit details", sl.Err(err))
+			metrics.AuditFailures.Inc()
+			return
+		}
+		entry.Details = b
+	}
+
+	if _, err := rec.appender.AppendAudit(ctx, entry); err != nil {
+		log.Error("failed to record audit event", sl.Err(err))
+		metrics.AuditFailures.Inc()
+	}
+}
@@ -0,0 +1,383 @@
+// Package backup takes snapshots of the SQLite database into a directory,
+// keeps the newest of them and restores the database from one.
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/migrator"
+)
+
+const (
+	filePrefix = "snapshot-"
+	fileSuffix = ".db"
+	timeLayout = "20060102T150405Z"
+
+	// nameLayout keeps nanoseconds so that two snapshots taken within the
+	// same second get different names. timeLayout still parses them, as
+	// well as the names of older snapshots without the fraction.
+	nameLayout = "20060102T150405.000000000Z"
+)
+
+var (
+	ErrNotFound  = errors.New("snapshot not found")
+	ErrExists    = errors.New("snapshot already exists")
+	ErrCorrupted = errors.New("snapshot failed the integrity check")
+	ErrInUse     = errors.New("database is in use, stop the server first")
+)
+
+type Backuper interface {
+	Backup(ctx context.Context, path string) error
+}
+
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"-"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Manager writes snapshots named snapshot-<UTC time>.db to dir and removes
+// all but the newest keep of them. keep <= 0 keeps every snapshot.
+type Manager struct {
+	storage Backuper
+	dir     string
+	keep    int
+
+	// mu serializes snapshots, so scheduled and manual ones do not race
+	// over the same file name or the pruning.
+	mu sync.Mutex
+}
+
+func New(storage Backuper, dir string, keep int) *Manager {
+	return &Manager{storage: storage, dir: dir, keep: keep}
+}
+
+// Snapshot backs the database up into a new file and prunes old snapshots.
+func (m *Manager) Snapshot(ctx context.Context) (Snapshot, error) {
+	const fn = "backup.Snapshot"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return Snapshot{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	name := filePrefix + time.Now().UTC().Format(nameLayout) + fileSuffix
+	path := filepath.Join(m.dir, name)
+
+	// Written under a temporary name so that List never sees a half
+	// written snapshot.
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	if err := m.storage.Backup(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return Snapshot{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	// Linked rather than renamed: a rename would silently replace an
+	// existing snapshot of the same name.
+	err := os.Link(tmp, path)
+	os.Remove(tmp)
+	if errors.Is(err, os.ErrExist) {
+		return Snapshot{}, fmt.Errorf("%s: %s: %w", fn, name, ErrExists)
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	snapshot, err := stat(path)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := m.prune(); err != nil {
+		return snapshot, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return snapshot, nil
+}
+
+// List returns the snapshots in dir, newest first.
+func (m *Manager) List() ([]Snapshot, error) {
+	const fn = "backup.List"
+
+	entries, err := os.ReadDir(m.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	var snapshots []Snapshot
+	for _, e := range entries {
+		if e.IsDir() || !isSnapshotName(e.Name()) {
+			continue
+		}
+
+		snapshot, err := stat(filepath.Join(m.dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].CreatedAt.Equal(snapshots[j].CreatedAt) {
+			return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+		}
+		return snapshots[i].Name > snapshots[j].Name
+	})
+
+	return snapshots, nil
+}
+
+// Find returns the snapshot with the given file name.
+func (m *Manager) Find(name string) (Snapshot, error) {
+	const fn = "backup.Find"
+
+	if !isSnapshotName(name) || filepath.Base(name) != name {
+		return Snapshot{}, fmt.Errorf("%s: %w", fn, ErrNotFound)
+	}
+
+	snapshot, err := stat(filepath.Join(m.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, fmt.Errorf("%s: %w", fn, ErrNotFound)
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return snapshot, nil
+}
+
+// Run takes a snapshot every interval until ctx is done.
+func (m *Manager) Run(ctx context.Context, log *slog.Logger, interval time.Duration) {
+	const fn = "backup.Run"
+
+	log = log.With(slog.String("fn", fn))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snapshot, err := m.Snapshot(ctx)
+			if err != nil {
+				log.Error("scheduled snapshot failed", sl.Err(err))
+				continue
+			}
+			log.Info("scheduled snapshot taken", slog.String("name", snapshot.Name), slog.Int64("size", snapshot.Size))
+		}
+	}
+}
+
+func (m *Manager) prune() error {
+	if m.keep <= 0 {
+		return nil
+	}
+
+	snapshots, err := m.List()
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) <= m.keep {
+		return nil
+	}
+
+	var errs []error
+	for _, snapshot := range snapshots[m.keep:] {
+		errs = append(errs, os.Remove(snapshot.Path))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Restore replaces the database at dbPath with the snapshot at src. The
+// server must be stopped. The snapshot is copied next to the database and
+// checked there: it must pass the integrity check and carry a clean schema
+// this binary understands. Only then the current database is moved aside
+// to dbPath.pre-restore and the copy takes its place.
+//
+// Restore holds the migration lock, waiting up to lockTimeout for it, and
+// fails with ErrInUse while a server runs on the database or another
+// process has it open.
+func Restore(src, dbPath string, lockTimeout time.Duration) error {
+	const fn = "backup.Restore"
+
+	unlock, err := migrator.Lock(dbPath+".migrate.lock", lockTimeout)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	defer unlock()
+
+	// Servers hold a shared lock on it for as long as they run.
+	unlockStorage, err := migrator.Lock(dbPath+".lock", 0)
+	if errors.Is(err, migrator.ErrLockTimeout) {
+		return fmt.Errorf("%s: %w", fn, ErrInUse)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	defer unlockStorage()
+
+	if err := checkNotInUse(dbPath); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	tmp := dbPath + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := validate(tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	// The WAL moves along with the old database: it holds its latest
+	// changes and must not be replayed into the restored one.
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err := os.Rename(dbPath+suffix, dbPath+".pre-restore"+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmp)
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// checkNotInUse takes an exclusive lock on the database and lets it go
+// right away. In WAL mode every open connection holds a shared lock on the
+// database file, so the lock is only granted when no other process, a
+// shell or a server on a platform without flock, has it open. A missing
+// database is not in use.
+func checkNotInUse(dbPath string) error {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_locking_mode=EXCLUSIVE&_busy_timeout=0")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var sqliteErr sqlite3.Error
+	_, err = db.Exec("BEGIN EXCLUSIVE; ROLLBACK")
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrBusy {
+		return ErrInUse
+	}
+
+	return err
+}
+
+// validate refuses dirty schemas and schemas newer than the binary. An
+// outdated schema is fine, the migrator brings it up to date.
+func validate(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+
+	var result string
+	err = db.QueryRow("PRAGMA integrity_check").Scan(&result)
+	db.Close()
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: %s", ErrCorrupted, result)
+	}
+
+	m, err := migrator.NewEmbedded(path)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Check(); err != nil && !errors.Is(err, migrator.ErrSchemaOutdated) {
+		return err
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return out.Close()
+}
+
+func isSnapshotName(name string) bool {
+	if !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+		return false
+	}
+
+	_, err := time.Parse(timeLayout, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+	return err == nil
+}
+
+func stat(path string) (Snapshot, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	name := info.Name()
+	createdAt, _ := time.Parse(timeLayout, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+
+	return Snapshot{
+		Name:      name,
+		Path:      path,
+		Size:      info.Size(),
+		CreatedAt: createdAt,
+	}, nil
+}
@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shorter/internal/migrator"
+	"url-shorter/internal/storage"
+	"url-shorter/internal/storage/sqlite"
+	"url-shorter/internal/storage/sqlite/sqlitetest"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+
+	s := sqlitetest.New(t, dbPath)
+	if _, err := s.SaveURL(ctx, storage.URL{Alias: "kept", URL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(s, filepath.Join(dir, "backups"), 1)
+
+	snapshot, err := m.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	// Pretend an older snapshot exists, retention must remove it.
+	old := filepath.Join(dir, "backups", "snapshot-20000101T000000Z.db")
+	if err := os.WriteFile(old, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Snapshot(ctx); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if _, err := os.Stat(old); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("old snapshot was not pruned: %v", err)
+	}
+
+	snapshots, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("List() returned %d snapshots; want 1", len(snapshots))
+	}
+	snapshot = snapshots[0]
+
+	if _, err := s.SaveURL(ctx, storage.URL{Alias: "lost", URL: "https://example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if err := Restore(snapshot.Path, dbPath, time.Second); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	restored, err := sqlite.NewStorage(dbPath, sqlite.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	for alias, want := range map[string]bool{"kept": true, "lost": false} {
+		exists, err := restored.IsAliasExists(ctx, alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != want {
+			t.Errorf("alias %q exists = %v after restore; want %v", alias, exists, want)
+		}
+	}
+}
+
+func TestRestoreRejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+	src := filepath.Join(dir, "newer.db")
+
+	sqlitetest.New(t, dbPath)
+	sqlitetest.New(t, src).Close()
+
+	db, err := sql.Open("sqlite3", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE schema_migrations SET version = 1000"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	err = Restore(src, dbPath, time.Second)
+	if !errors.Is(err, migrator.ErrSchemaTooNew) {
+		t.Fatalf("Restore() error = %v; want %v", err, migrator.ErrSchemaTooNew)
+	}
+
+	if _, err := os.Stat(dbPath + ".pre-restore"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("database was moved aside although restore failed")
+	}
+}
+
+func TestSnapshotsWithinOneSecond(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	m := New(sqlitetest.New(t, filepath.Join(dir, "data.db")), filepath.Join(dir, "backups"), 0)
+
+	for i := 0; i < 3; i++ {
+		if _, err := m.Snapshot(ctx); err != nil {
+			t.Fatalf("Snapshot() error = %v", err)
+		}
+	}
+
+	snapshots, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 3 {
+		t.Fatalf("List() returned %d snapshots; want 3", len(snapshots))
+	}
+}
+
+func TestRestoreRefusesOpenDatabase(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+	src := filepath.Join(dir, "other.db")
+
+	sqlitetest.New(t, src).Close()
+	s := sqlitetest.New(t, dbPath)
+	if _, err := s.SaveURL(context.Background(), storage.URL{Alias: "kept", URL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Restore(src, dbPath, time.Second)
+	if !errors.Is(err, ErrInUse) {
+		t.Fatalf("Restore() error = %v; want %v", err, ErrInUse)
+	}
+
+	if _, err := os.Stat(dbPath + ".pre-restore"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("database was moved aside while it was in use")
+	}
+	if exists, err := s.IsAliasExists(context.Background(), "kept"); err != nil || !exists {
+		t.Errorf("IsAliasExists() = %v, %v after refused restore; want true", exists, err)
+	}
+}
+
+func TestRestoreRefusesRunningServer(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+	src := filepath.Join(dir, "other.db")
+
+	sqlitetest.New(t, src).Close()
+	sqlitetest.New(t, dbPath).Close()
+
+	unlock, err := migrator.LockShared(dbPath+".lock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(src, dbPath, time.Second); !errors.Is(err, ErrInUse) {
+		t.Fatalf("Restore() error = %v; want %v", err, ErrInUse)
+	}
+
+	unlock()
+	if err := Restore(src, dbPath, time.Second); err != nil {
+		t.Fatalf("Restore() after the server stopped error = %v", err)
+	}
+}
@@ -3,21 +3,248 @@ package config
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+const (
+	EnvLocal = "local"
+	EnvDev   = "dev"
+	EnvProd  = "prod"
+)
+
 type Config struct {
-	Env         string `yaml:"env" env-default:"local" env-required:"true"`
+	Env string `yaml:"env" env-default:"local" env-required:"true"`
+	// StoragePath is resolved relative to the directory of the config file
+	// unless it is absolute.
 	StoragePath string `yaml:"storage_path" env-required:"true"`
-	HTTPServer  `yaml:"http_server"`
+	SQLite      SQLite `yaml:"sqlite"`
+	// MigrationsPath makes cmd/migrator read migrations from disk instead of
+	// the ones embedded into the binary.
+	MigrationsPath string     `yaml:"migrations_path"`
+	Migrations     Migrations `yaml:"migrations"`
+	HTTPServer     `yaml:"http_server"`
+	Alias          Alias     `yaml:"alias"`
+	URLPolicy      URLPolicy `yaml:"url_policy"`
+	Batch          Batch     `yaml:"batch"`
+	Import         Import    `yaml:"import"`
+	Backup         Backup    `yaml:"backup"`
+	Admin          Admin     `yaml:"admin"`
+	Orgs           Orgs      `yaml:"orgs"`
+	Mail           Mail      `yaml:"mail"`
+	Account        Account   `yaml:"account"`
+	TwoFactor      TwoFactor `yaml:"two_factor"`
+	Passwords      Passwords `yaml:"passwords"`
+	Tracing        Tracing   `yaml:"tracing"`
+	Logging        Logging   `yaml:"logging"`
 }
 
 type HTTPServer struct {
 	Address      string        `yaml:"address" env-default:"localhost:8000"`
 	Timeout      time.Duration `yaml:"timeout" env-default:"4s"`
 	Idle_timeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// On SIGINT or SIGTERM /readyz starts failing, the server keeps serving
+	// for ShutdownDelay so balancers can notice and then waits up to
+	// ShutdownTimeout for in-flight requests.
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env-default:"0s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+}
+
+// Alias describes which custom aliases users are allowed to choose.
+// Charset is the body of a regexp character class.
+type Alias struct {
+	MinLength     int      `yaml:"min_length" env-default:"3"`
+	MaxLength     int      `yaml:"max_length" env-default:"32"`
+	Charset       string   `yaml:"charset" env-default:"a-zA-Z0-9_-"`
+	CaseFold      bool     `yaml:"case_fold" env-default:"false"`
+	Reserved      []string `yaml:"reserved" env-default:"url,register,admin,api,account,login,logout,batch,import,export"`
+	BlocklistPath string   `yaml:"blocklist_path"`
+}
+
+// URLPolicy restricts which destinations can be shortened. Domain patterns
+// support wildcards ("*.example.com"). OwnHosts are the hosts the shortener
+// is served from; the http_server address host is always added to them.
+// SortQuery makes the stored normalized url sort query parameters by key.
+type URLPolicy struct {
+	AllowedSchemes     []string `yaml:"allowed_schemes" env-default:"http,https"`
+	AllowDomains       []string `yaml:"allow_domains"`
+	DenyDomains        []string `yaml:"deny_domains" env-default:"localhost"`
+	BlockPrivateIPs    bool     `yaml:"block_private_ips" env-default:"true"`
+	OwnHosts           []string `yaml:"own_hosts"`
+	MaliciousHostsPath string   `yaml:"malicious_hosts_path"`
+	SortQuery          bool     `yaml:"sort_query"`
+}
+
+// SQLite holds the pragmas applied to every connection, the pool limits
+// and the query timeouts. Zero pool values keep the database/sql defaults,
+// a zero timeout disables it.
+type SQLite struct {
+	JournalMode     string        `yaml:"journal_mode" env-default:"WAL"`
+	BusyTimeout     time.Duration `yaml:"busy_timeout" env-default:"5s"`
+	Synchronous     string        `yaml:"synchronous" env-default:"NORMAL"`
+	ForeignKeys     bool          `yaml:"foreign_keys" env-default:"true"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env-default:"0"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env-default:"0"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env-default:"0s"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env-default:"0s"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env-default:"2s"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env-default:"5s"`
+	BulkTimeout     time.Duration `yaml:"bulk_timeout" env-default:"60s"`
+}
+
+// Migrations controls what the server does with the schema at startup.
+// It always refuses to start on a dirty schema or one newer than the
+// binary. With AutoApply it applies pending migrations, holding a lock
+// file next to the database so that concurrent instances wait; without
+// it an outdated schema is refused as well.
+type Migrations struct {
+	AutoApply   bool          `yaml:"auto_apply" env-default:"false"`
+	LockTimeout time.Duration `yaml:"lock_timeout" env-default:"30s"`
+}
+
+// Batch limits the batch endpoints. MaxBytes caps the request body so
+// that an oversized batch is refused before it is decoded.
+type Batch struct {
+	MaxItems int   `yaml:"max_items" env-default:"500"`
+	MaxBytes int64 `yaml:"max_bytes" env-default:"1048576"`
+}
+
+type Import struct {
+	MaxRows  int   `yaml:"max_rows" env-default:"100000"`
+	MaxBytes int64 `yaml:"max_bytes" env-default:"33554432"`
+}
+
+// Backup configures database snapshots. Dir defaults to "backups" next to
+// the database, a relative Dir is resolved like storage_path. A zero
+// Interval disables scheduled snapshots; Keep <= 0 never removes any.
+type Backup struct {
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval" env-default:"0s"`
+	Keep     int           `yaml:"keep" env-default:"7"`
+}
+
+// Admin configures access to the /admin endpoints. Users with the admin
+// role reach them with Basic Auth, Token additionally lets in requests
+// with "Authorization: Bearer <token>"; empty disables it. Seed creates
+// an admin account at startup if no user with its username exists yet.
+type Admin struct {
+	Token string    `yaml:"token" env:"ADMIN_TOKEN"`
+	Seed  AdminSeed `yaml:"seed"`
+}
+
+type AdminSeed struct {
+	Username string `yaml:"username" env:"ADMIN_SEED_USERNAME"`
+	Email    string `yaml:"email" env:"ADMIN_SEED_EMAIL"`
+	Password string `yaml:"password" env:"ADMIN_SEED_PASSWORD"`
+}
+
+// Orgs configures organizations. InviteTTL is how long an invite token
+// can be redeemed.
+type Orgs struct {
+	InviteTTL time.Duration `yaml:"invite_ttl" env-default:"168h"`
+}
+
+// Mail selects how the emails of the account flows are sent: "smtp",
+// "file" (appended to FilePath, resolved like storage_path) or "log".
+// File and log keep the links with their tokens locally, use them for
+// development only. Only local and dev fall back to log, prod must set the
+// transport.
+type Mail struct {
+	Transport string `yaml:"transport"`
+	From      string `yaml:"from" env-default:"url-shorter@localhost"`
+	FilePath  string `yaml:"file_path" env-default:"mail.log"`
+	SMTP      SMTP   `yaml:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+}
+
+// Account configures password reset, email verification and login
+// sessions. BaseURL is where the links in the emails point to.
+// TokenSecret signs their tokens and the session tokens; when empty a
+// random one is used and both stop working on restart.
+type Account struct {
+	BaseURL     string        `yaml:"base_url" env-default:"http://localhost:8000"`
+	TokenSecret string        `yaml:"token_secret" env:"ACCOUNT_TOKEN_SECRET"`
+	VerifyTTL   time.Duration `yaml:"verify_ttl" env-default:"48h"`
+	ResetTTL    time.Duration `yaml:"reset_ttl" env-default:"1h"`
+	SessionTTL  time.Duration `yaml:"session_ttl" env-default:"24h"`
+}
+
+// TwoFactor configures TOTP. Issuer names the service in authenticator
+// apps, RecoveryCodes is how many one-time codes a user gets.
+type TwoFactor struct {
+	Issuer        string `yaml:"issuer" env-default:"url-shorter"`
+	RecoveryCodes int    `yaml:"recovery_codes" env-default:"10"`
+}
+
+// Passwords configures how passwords are hashed and which are accepted.
+type Passwords struct {
+	Hashing PasswordHashing `yaml:"hashing"`
+	Policy  PasswordPolicy  `yaml:"policy"`
+}
+
+// PasswordHashing selects "bcrypt" or "argon2id" and its parameters,
+// Argon2Memory is in KiB. Hashes made with other settings keep working
+// and are rehashed on the next successful login. Keep this struct in sync
+// with hash_password.Config.
+type PasswordHashing struct {
+	Algorithm     string `yaml:"algorithm" env-default:"bcrypt"`
+	BcryptCost    int    `yaml:"bcrypt_cost" env-default:"14"`
+	Argon2Time    uint32 `yaml:"argon2_time" env-default:"3"`
+	Argon2Memory  uint32 `yaml:"argon2_memory" env-default:"65536"`
+	Argon2Threads uint8  `yaml:"argon2_threads" env-default:"2"`
+}
+
+// PasswordPolicy is checked whenever a password is set. BreachedListPath
+// is the Pwned Passwords SHA-1 list ordered by hash ("HASH:COUNT" lines),
+// resolved like storage_path; empty skips the check. Keep this struct in
+// sync with password_policy.Config.
+type PasswordPolicy struct {
+	MinLength        int    `yaml:"min_length" env-default:"8"`
+	MaxLength        int    `yaml:"max_length" env-default:"72"`
+	BreachedListPath string `yaml:"breached_list_path"`
+}
+
+// Tracing selects where spans go: "none", "otlp" (HTTP, Endpoint is
+// host:port, empty falls back to OTEL_EXPORTER_OTLP_ENDPOINT) or "file"
+// (JSON spans appended to FilePath, resolved like storage_path).
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure" env-default:"false"`
+	FilePath    string  `yaml:"file_path" env-default:"traces.jsonl"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
+
+// Logging configures the application logger. Empty Level and Format take
+// the env defaults: debug and pretty for local, debug and json for dev,
+// info and json for prod. Output is "stdout" or "file", in which case
+// records are appended to FilePath, resolved like storage_path. The level
+// can be changed at runtime through /admin/log-level.
+type Logging struct {
+	Level     string `yaml:"level"`
+	Format    string `yaml:"format"`
+	Output    string `yaml:"output" env-default:"stdout"`
+	FilePath  string `yaml:"file_path" env-default:"url-shorter.log"`
+	AddSource bool   `yaml:"add_source" env-default:"false"`
+	Redact    Redact `yaml:"redact"`
+}
+
+// Redact masks sensitive values in every log record. Values of attributes
+// and struct fields named like one of Keys are always replaced, URLs masks
+// query values and passwords of logged URLs, IPs truncates addresses to
+// their network. Keep this struct in sync with redact.Options.
+type Redact struct {
+	Keys []string `yaml:"keys" env-default:"password,password_re,api_key,authorization,token,secret"`
+	URLs bool     `yaml:"urls" env-default:"false"`
+	IPs  bool     `yaml:"ips" env-default:"false"`
 }
 
 func MustLoad() *Config {
@@ -37,6 +264,60 @@ func MustLoad() *Config {
 		log.Fatalf("cannot read config: %s", err)
 	}
 
+	var level, format string
+	switch cfg.Env {
+	case EnvLocal:
+		level, format = "debug", "pretty"
+	case EnvDev:
+		level, format = "debug", "json"
+	case EnvProd:
+		level, format = "info", "json"
+	default:
+		log.Fatalf("unknown env %q, want %s, %s or %s", cfg.Env, EnvLocal, EnvDev, EnvProd)
+	}
+
+	if cfg.Logging.Level == "" {
+		cfg.Logging.Level = level
+	}
+	if cfg.Logging.Format == "" {
+		cfg.Logging.Format = format
+	}
+
+	// The log transport writes live reset tokens into the application log.
+	if cfg.Mail.Transport == "" && cfg.Env != EnvProd {
+		cfg.Mail.Transport = "log"
+	}
+
+	if cfg.StoragePath != ":memory:" {
+		cfg.StoragePath = mustResolvePath(configPath, cfg.StoragePath)
+	}
+
+	if cfg.Backup.Dir == "" {
+		cfg.Backup.Dir = filepath.Join(filepath.Dir(cfg.StoragePath), "backups")
+	}
+	cfg.Backup.Dir = mustResolvePath(configPath, cfg.Backup.Dir)
+	cfg.Tracing.FilePath = mustResolvePath(configPath, cfg.Tracing.FilePath)
+	cfg.Logging.FilePath = mustResolvePath(configPath, cfg.Logging.FilePath)
+	cfg.Mail.FilePath = mustResolvePath(configPath, cfg.Mail.FilePath)
+	if cfg.Passwords.Policy.BreachedListPath != "" {
+		cfg.Passwords.Policy.BreachedListPath = mustResolvePath(configPath, cfg.Passwords.Policy.BreachedListPath)
+	}
+
 	return &cfg
 
 }
+
+// mustResolvePath makes a path from the config relative to the directory
+// of the config file.
+func mustResolvePath(configPath, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	abs, err := filepath.Abs(filepath.Join(filepath.Dir(configPath), path))
+	if err != nil {
+		log.Fatalf("cannot resolve path %s: %s", path, err)
+	}
+
+	return abs
+}
@@ -0,0 +1,201 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/http-server/handlers/account/profile"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+type DataLister interface {
+	ListUserOrgs(ctx context.Context, userID int64) ([]storage.OrgMembership, error)
+	ListUserURLs(ctx context.Context, userID int64, withClickCount bool, yield func(storage.URL) error) error
+	ListUserClicks(ctx context.Context, userID int64, yield func(storage.Click) error) error
+}
+
+type Membership struct {
+	OrgID int64  `json:"org_id"`
+	Org   string `json:"org"`
+	Role  string `json:"role"`
+}
+
+type Link struct {
+	Alias      string     `json:"alias"`
+	URL        string     `json:"url"`
+	OrgID      int64      `json:"org_id,omitempty"`
+	ClicksLeft int        `json:"clicks_left"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	ClickCount int64      `json:"click_count"`
+}
+
+type Click struct {
+	Alias     string    `json:"alias"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	Device    string    `json:"device,omitempty"`
+	Browser   string    `json:"browser,omitempty"`
+	Referrer  string    `json:"referrer,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// New streams a ZIP with everything stored about the authenticated user:
+// profile.json, orgs.json, links.json and clicks.json.
+func New(log *slog.Logger, lister DataLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.export.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		orgs, err := lister.ListUserOrgs(r.Context(), user.ID)
+		if err != nil {
+			log.Error("failed to list orgs", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to export account"))
+			return
+		}
+
+		memberships := make([]Membership, 0, len(orgs))
+		for _, m := range orgs {
+			memberships = append(memberships, Membership{OrgID: m.Org.ID, Org: m.Org.Name, Role: m.Role})
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="account-`+user.Username+`.zip"`)
+
+		archive := zip.NewWriter(w)
+		now := time.Now()
+		var links, clicks int
+
+		err = writeFile(archive, now, "profile.json", func(enc *json.Encoder) error {
+			return enc.Encode(profile.FromUser(user))
+		})
+		if err == nil {
+			err = writeFile(archive, now, "orgs.json", func(enc *json.Encoder) error {
+				return enc.Encode(memberships)
+			})
+		}
+		if err == nil {
+			err = writeArray(archive, now, "links.json", func(add func(any) error) error {
+				return lister.ListUserURLs(r.Context(), user.ID, true, func(u storage.URL) error {
+					link := Link{
+						Alias:      u.Alias,
+						URL:        u.URL,
+						OrgID:      u.OrgID,
+						ClicksLeft: u.Clicks,
+						Tags:       u.Tags,
+						ClickCount: u.ClickCount,
+					}
+					if !u.ExpiresAt.IsZero() {
+						link.ExpiresAt = &u.ExpiresAt
+					}
+					links++
+					return add(link)
+				})
+			})
+		}
+		if err == nil {
+			err = writeArray(archive, now, "clicks.json", func(add func(any) error) error {
+				return lister.ListUserClicks(r.Context(), user.ID, func(c storage.Click) error {
+					clicks++
+					return add(Click{
+						Alias:     c.Alias,
+						IP:        c.IP,
+						UserAgent: c.UserAgent,
+						Country:   c.Country,
+						Device:    c.Device,
+						Browser:   c.Browser,
+						Referrer:  c.Referrer,
+						CreatedAt: c.CreatedAt,
+					})
+				})
+			})
+		}
+		if err == nil {
+			err = archive.Close()
+		}
+		if err != nil {
+			// Headers are already sent, the client sees a broken archive.
+			log.Error("export interrupted", slog.Int("links", links), slog.Int("clicks", clicks), sl.Err(err))
+			return
+		}
+
+		log.Info("account exported",
+			slog.String("username", user.Username),
+			slog.Int("links", links),
+			slog.Int("clicks", clicks),
+		)
+	}
+}
+
+func writeFile(archive *zip.Writer, modified time.Time, name string, write func(enc *json.Encoder) error) error {
+	f, err := create(archive, modified, name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+
+	return write(enc)
+}
+
+// writeArray writes a JSON array element by element, so links and clicks
+// are never all held in memory.
+func writeArray(archive *zip.Writer, modified time.Time, name string, fill func(add func(any) error) error) error {
+	f, err := create(archive, modified, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(f, "["); err != nil {
+		return err
+	}
+
+	sep := "\n  "
+	err = fill(func(v any) error {
+		b, err := json.MarshalIndent(v, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, sep); err != nil {
+			return err
+		}
+		sep = ",\n  "
+		_, err = f.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(f, "\n]\n")
+	return err
+}
+
+func create(archive *zip.Writer, modified time.Time, name string) (io.Writer, error) {
+	return archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+}
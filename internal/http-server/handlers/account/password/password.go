@@ -0,0 +1,264 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/password_policy"
+	"url-shorter/internal/storage"
+)
+
+type PasswordChanger interface {
+	ValidateUser(ctx context.Context, username, password string) (storage.User, error)
+	SetPassword(ctx context.Context, username, password string) error
+}
+
+type UserFinder interface {
+	GetUserByEmail(ctx context.Context, email string) (storage.User, error)
+}
+
+type ResetSender interface {
+	SendPasswordReset(ctx context.Context, user storage.User) error
+}
+
+type ResetChecker interface {
+	CheckPasswordReset(ctx context.Context, token string) (storage.User, error)
+}
+
+type PasswordSetter interface {
+	SetPassword(ctx context.Context, username, password string) error
+}
+
+type ChangeRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required" log:"redact"`
+	NewPassword     string `json:"new_password" validate:"required,min=8" log:"redact"`
+}
+
+type ForgotRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetRequest struct {
+	Token       string `json:"token" validate:"required" log:"redact"`
+	NewPassword string `json:"new_password" validate:"required,min=8" log:"redact"`
+}
+
+type ForgotResponse struct {
+	resp.Response
+	Message string `json:"message"`
+}
+
+// forgotReply is the same whether the email is known or not, so the
+// endpoint can not be used to find out who has an account.
+const forgotReply = "if the email belongs to an account, a reset link has been sent to it"
+
+// sendTimeout bounds a reset mail sent after the response went out.
+const sendTimeout = time.Minute
+
+// New changes the password of the authenticated user. The current
+// password is asked for again, a stolen session alone must not be enough
+// to take the account over.
+func New(log *slog.Logger, changer PasswordChanger, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.password.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		var req ChangeRequest
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		if _, err := changer.ValidateUser(r.Context(), user.Username, req.CurrentPassword); err != nil {
+			if errors.Is(err, storage.ErrWrongPassword) {
+				log.Info("wrong current password", slog.String("username", user.Username))
+				w.WriteHeader(http.StatusForbidden)
+				render.JSON(w, r, resp.Error("current password is wrong"))
+				return
+			}
+			log.Error("failed to check current password", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to change password"))
+			return
+		}
+
+		err := changer.SetPassword(r.Context(), user.Username, req.NewPassword)
+		if errors.Is(err, storage.ErrInvalidPassword) {
+			log.Info("new password refused by the policy", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(policyMessage(err)))
+			return
+		}
+		if err != nil {
+			log.Error("failed to set password", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to change password"))
+			return
+		}
+
+		log.Info("password changed", slog.String("username", user.Username))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionPasswordChange,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  user.Username,
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// NewForgot mails a password reset link to the account with the given
+// email, if there is one. The mail is sent in the background: waiting for
+// the mail server would make known emails answer slower than unknown ones.
+func NewForgot(log *slog.Logger, finder UserFinder, sender ResetSender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.password.NewForgot"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		var req ForgotRequest
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		user, err := finder.GetUserByEmail(r.Context(), req.Email)
+		switch {
+		case errors.Is(err, storage.ErrUserNotFound):
+			log.Info("password reset for unknown email")
+		case err != nil:
+			log.Error("failed to look up user", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to send reset link"))
+			return
+		case user.Disabled:
+			log.Info("password reset for disabled user", slog.String("username", user.Username))
+		default:
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), sendTimeout)
+			go func() {
+				defer cancel()
+
+				if err := sender.SendPasswordReset(ctx, user); err != nil {
+					log.Error("failed to send reset link", sl.Err(err))
+					return
+				}
+				log.Info("reset link sent", slog.String("username", user.Username))
+			}()
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		render.JSON(w, r, ForgotResponse{
+			Response: resp.OK(),
+			Message:  forgotReply,
+		})
+	}
+}
+
+// NewReset sets a new password with the token of a reset link.
+func NewReset(log *slog.Logger, checker ResetChecker, setter PasswordSetter, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.password.NewReset"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		var req ResetRequest
+		if !decode(w, r, log, &req) {
+			return
+		}
+
+		user, err := checker.CheckPasswordReset(r.Context(), req.Token)
+		if err == nil && user.Disabled {
+			err = storage.ErrUserDisabled
+		}
+		if err != nil {
+			log.Info("invalid reset token", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("token is invalid or expired"))
+			return
+		}
+
+		err = setter.SetPassword(r.Context(), user.Username, req.NewPassword)
+		if errors.Is(err, storage.ErrInvalidPassword) {
+			log.Info("new password refused by the policy", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(policyMessage(err)))
+			return
+		}
+		if err != nil {
+			log.Error("failed to set password", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to reset password"))
+			return
+		}
+
+		log.Info("password reset", slog.String("username", user.Username))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionPasswordReset,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  user.Username,
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// policyMessage tells the user which rule of the password policy err
+// reports.
+func policyMessage(err error) string {
+	var policyErr *password_policy.ValidationError
+	if errors.As(err, &policyErr) {
+		return policyErr.Message
+	}
+	return storage.ErrInvalidPassword.Error()
+}
+
+// decode reads and validates the request body into req, writing the error
+// response if it fails.
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger, req any) bool {
+	if err := render.DecodeJSON(r.Body, req); err != nil {
+		log.Error("failed to decode request body", sl.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, resp.Error("failed to decode request"))
+		return false
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		log.Info("invalid request", sl.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		var validatorErr validator.ValidationErrors
+		if errors.As(err, &validatorErr) {
+			render.JSON(w, r, resp.ValidationError(validatorErr))
+			return false
+		}
+		render.JSON(w, r, resp.Error("invalid request"))
+		return false
+	}
+
+	return true
+}
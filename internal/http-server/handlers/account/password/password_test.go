@@ -0,0 +1,74 @@
+package password
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shorter/internal/storage"
+)
+
+type finderFunc func(ctx context.Context, email string) (storage.User, error)
+
+func (f finderFunc) GetUserByEmail(ctx context.Context, email string) (storage.User, error) {
+	return f(ctx, email)
+}
+
+// slowSender blocks like a mail server that takes its time.
+type slowSender struct {
+	release chan struct{}
+	sent    chan storage.User
+}
+
+func (s slowSender) SendPasswordReset(ctx context.Context, user storage.User) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.sent <- user
+	return nil
+}
+
+func TestForgotDoesNotWaitForMail(t *testing.T) {
+	sender := slowSender{release: make(chan struct{}), sent: make(chan storage.User, 1)}
+	h := NewForgot(slog.New(slog.NewTextHandler(io.Discard, nil)), finderFunc(func(_ context.Context, email string) (storage.User, error) {
+		if email != "amy@example.com" {
+			return storage.User{}, storage.ErrUserNotFound
+		}
+		return storage.User{ID: 1, Username: "amy", Email: email}, nil
+	}), sender)
+
+	for _, email := range []string{"amy@example.com", "nobody@example.com"} {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"`+email+`"}`)))
+			done <- w
+		}()
+
+		select {
+		case w := <-done:
+			if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), forgotReply) {
+				t.Errorf("%s: response = %d %s; want %d with the generic reply", email, w.Code, w.Body, http.StatusAccepted)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: response waited for the mail to be sent", email)
+		}
+	}
+
+	close(sender.release)
+	select {
+	case user := <-sender.sent:
+		if user.Username != "amy" {
+			t.Errorf("reset link sent to %q; want amy", user.Username)
+		}
+	case <-time.After(time.Second):
+		t.Error("reset link was never sent")
+	}
+}
@@ -0,0 +1,55 @@
+package profile
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/storage"
+)
+
+// Profile is the account as its owner sees it.
+type Profile struct {
+	ID               int64     `json:"id"`
+	Username         string    `json:"username"`
+	Email            string    `json:"email"`
+	EmailVerified    bool      `json:"email_verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	Role             string    `json:"role"`
+	DedupURLs        bool      `json:"dedup_urls"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type Response struct {
+	resp.Response
+	Profile
+}
+
+// FromUser is the profile of user.
+func FromUser(user storage.User) Profile {
+	return Profile{
+		ID:               user.ID,
+		Username:         user.Username,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerified,
+		TwoFactorEnabled: user.TOTPEnabled,
+		Role:             user.Role,
+		DedupURLs:        user.DedupURLs,
+		CreatedAt:        user.CreatedAt,
+	}
+}
+
+// New returns the profile of the authenticated user.
+func New() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := authentication.UserFromContext(r.Context())
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Profile:  FromUser(user),
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package remove
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+const (
+	LinksTransfer = "transfer"
+	LinksDelete   = "delete"
+)
+
+type Request struct {
+	Password   string `json:"password" validate:"required" log:"redact"`
+	Links      string `json:"links" validate:"required,oneof=transfer delete"`
+	TransferTo string `json:"transfer_to,omitempty" validate:"required_if=Links transfer"`
+}
+
+type Response struct {
+	resp.Response
+	Links int64 `json:"links"`
+}
+
+type AccountDeleter interface {
+	ValidateUser(ctx context.Context, username, password string) (storage.User, error)
+	GetUser(ctx context.Context, username string) (storage.User, error)
+	DeleteAccount(ctx context.Context, id, transferTo int64) (int64, error)
+}
+
+// New deletes the account of the authenticated user after asking for the
+// password again. The links go to another user or are deleted with their
+// click history. Sole owners of an org have to hand it over first.
+func New(log *slog.Logger, deleter AccountDeleter, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.remove.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		var req Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Info("invalid request", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			var validatorErr validator.ValidationErrors
+			if errors.As(err, &validatorErr) {
+				render.JSON(w, r, resp.ValidationError(validatorErr))
+				return
+			}
+			render.JSON(w, r, resp.Error("invalid request"))
+			return
+		}
+
+		if _, err := deleter.ValidateUser(r.Context(), user.Username, req.Password); err != nil {
+			if errors.Is(err, storage.ErrWrongPassword) {
+				log.Info("wrong password", slog.String("username", user.Username))
+				w.WriteHeader(http.StatusForbidden)
+				render.JSON(w, r, resp.Error("password is wrong"))
+				return
+			}
+			log.Error("failed to check password", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to delete account"))
+			return
+		}
+
+		var recipient storage.User
+		if req.Links == LinksTransfer {
+			var err error
+			recipient, err = deleter.GetUser(r.Context(), req.TransferTo)
+			if errors.Is(err, storage.ErrUserNotFound) || (err == nil && (recipient.Disabled || recipient.ID == user.ID)) {
+				log.Info("invalid link recipient", slog.String("transfer_to", req.TransferTo))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("transfer_to must be another active user"))
+				return
+			}
+			if err != nil {
+				log.Error("failed to look up link recipient", sl.Err(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("failed to delete account"))
+				return
+			}
+		}
+
+		links, err := deleter.DeleteAccount(r.Context(), user.ID, recipient.ID)
+		if errors.Is(err, storage.ErrLastOwner) {
+			log.Info("account owns an org alone", slog.String("username", user.Username))
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("transfer the ownership of your orgs first"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to delete account", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to delete account"))
+			return
+		}
+
+		log.Info("account deleted",
+			slog.String("username", user.Username),
+			slog.String("links", req.Links),
+			slog.Int64("count", links),
+		)
+
+		details := map[string]string{
+			"links": req.Links,
+			"count": strconv.FormatInt(links, 10),
+		}
+		if recipient.ID != 0 {
+			details["transfer_to"] = recipient.Username
+		}
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionUserDelete,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  user.Username,
+			Details: details,
+		})
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Links:    links,
+		})
+	}
+}
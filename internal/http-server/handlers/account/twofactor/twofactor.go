@@ -0,0 +1,282 @@
+package twofactor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+	"url-shorter/internal/twofactor"
+)
+
+type CodeRequest struct {
+	Code string `json:"code" log:"redact"`
+}
+
+type StatusResponse struct {
+	resp.Response
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+type EnrollResponse struct {
+	resp.Response
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+	// QRPNG is base64 encoded by encoding/json.
+	QRPNG []byte `json:"qr_png"`
+}
+
+type RecoveryCodesResponse struct {
+	resp.Response
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type StatusGetter interface {
+	Status(ctx context.Context, user storage.User) (twofactor.Status, error)
+}
+
+type Enroller interface {
+	Enroll(ctx context.Context, user storage.User) (twofactor.Enrollment, error)
+}
+
+type Confirmer interface {
+	Confirm(ctx context.Context, user storage.User, code string) ([]string, error)
+}
+
+type Disabler interface {
+	Disable(ctx context.Context, user storage.User, code string) error
+}
+
+type RecoveryCodesRenewer interface {
+	RegenerateRecoveryCodes(ctx context.Context, user storage.User, code string) ([]string, error)
+}
+
+func New(log *slog.Logger, getter StatusGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.twofactor.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		status, err := getter.Status(r.Context(), user)
+		if err != nil {
+			log.Error("failed to get two-factor status", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to get two-factor status"))
+			return
+		}
+
+		render.JSON(w, r, StatusResponse{
+			Response:          resp.OK(),
+			Enabled:           status.Enabled,
+			RecoveryCodesLeft: status.RecoveryCodesLeft,
+		})
+	}
+}
+
+// NewEnroll starts setting up two-factor authentication. It only takes
+// effect once a code from the app is sent to NewConfirm.
+func NewEnroll(log *slog.Logger, enroller Enroller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.twofactor.NewEnroll"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		enrollment, err := enroller.Enroll(r.Context(), user)
+		if errors.Is(err, twofactor.ErrNotEligible) {
+			w.WriteHeader(http.StatusForbidden)
+			render.JSON(w, r, resp.Error("two-factor authentication is available to admins and org members"))
+			return
+		}
+		if errors.Is(err, storage.ErrTOTPEnabled) {
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("two-factor authentication is already enabled"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to enroll", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to set up two-factor authentication"))
+			return
+		}
+
+		log.Info("two-factor enrollment started", slog.String("username", user.Username))
+
+		render.JSON(w, r, EnrollResponse{
+			Response: resp.OK(),
+			Secret:   enrollment.Secret,
+			URI:      enrollment.URI,
+			QRPNG:    enrollment.QR,
+		})
+	}
+}
+
+// NewConfirm enables two-factor authentication and returns the recovery
+// codes, which are not shown again.
+func NewConfirm(log *slog.Logger, confirmer Confirmer, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.twofactor.NewConfirm"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		req, ok := decode(w, r, log)
+		if !ok {
+			return
+		}
+
+		codes, err := confirmer.Confirm(r.Context(), user, req.Code)
+		if !handleCodeError(w, r, log, err) {
+			return
+		}
+
+		log.Info("two-factor authentication enabled", slog.String("username", user.Username))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionTOTPEnable,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  user.Username,
+		})
+
+		render.JSON(w, r, RecoveryCodesResponse{
+			Response:      resp.OK(),
+			RecoveryCodes: codes,
+		})
+	}
+}
+
+// NewDisable turns two-factor authentication off. A code is asked for, a
+// stolen session alone must not be enough to remove the second factor.
+func NewDisable(log *slog.Logger, disabler Disabler, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.twofactor.NewDisable"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		req, ok := decode(w, r, log)
+		if !ok {
+			return
+		}
+
+		err := disabler.Disable(r.Context(), user, req.Code)
+		if !handleCodeError(w, r, log, err) {
+			return
+		}
+
+		log.Info("two-factor authentication disabled", slog.String("username", user.Username))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionTOTPDisable,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  user.Username,
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// NewRecoveryCodes replaces the recovery codes with new ones.
+func NewRecoveryCodes(log *slog.Logger, renewer RecoveryCodesRenewer, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.twofactor.NewRecoveryCodes"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		req, ok := decode(w, r, log)
+		if !ok {
+			return
+		}
+
+		codes, err := renewer.RegenerateRecoveryCodes(r.Context(), user, req.Code)
+		if !handleCodeError(w, r, log, err) {
+			return
+		}
+
+		log.Info("recovery codes renewed", slog.String("username", user.Username))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionRecoveryRenew,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  user.Username,
+		})
+
+		render.JSON(w, r, RecoveryCodesResponse{
+			Response:      resp.OK(),
+			RecoveryCodes: codes,
+		})
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, log *slog.Logger) (CodeRequest, bool) {
+	var req CodeRequest
+
+	if err := render.DecodeJSON(r.Body, &req); err != nil || req.Code == "" {
+		log.Info("invalid request", sl.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, resp.Error("code is required"))
+		return CodeRequest{}, false
+	}
+
+	return req, true
+}
+
+// handleCodeError writes the response for an error of an action guarded
+// by a two-factor code and reports whether the action succeeded.
+func handleCodeError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, twofactor.ErrInvalidCode):
+		log.Info("invalid two-factor code", sl.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, resp.Error("invalid two-factor code"))
+	case errors.Is(err, storage.ErrTOTPEnabled):
+		w.WriteHeader(http.StatusConflict)
+		render.JSON(w, r, resp.Error("two-factor authentication is already enabled"))
+	case errors.Is(err, storage.ErrTOTPNotEnrolled):
+		w.WriteHeader(http.StatusConflict)
+		render.JSON(w, r, resp.Error("two-factor authentication is not set up"))
+	default:
+		log.Error("two-factor action failed", sl.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		render.JSON(w, r, resp.Error("internal error"))
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+type Request struct {
+	Username        *string `json:"username,omitempty" validate:"omitempty,min=3,max=50,alphanum"`
+	Email           *string `json:"email,omitempty" validate:"omitempty,email"`
+	DedupURLs       *bool   `json:"dedup_urls,omitempty"`
+	CurrentPassword string  `json:"current_password,omitempty" log:"redact"`
+}
+
+// change is what gets audited, the password never is.
+type change struct {
+	Username  *string `json:"username,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	DedupURLs *bool   `json:"dedup_urls,omitempty"`
+}
+
+type UserUpdater interface {
+	ValidateUser(ctx context.Context, username, password string) (storage.User, error)
+	UpdateUser(ctx context.Context, id int64, upd storage.UserUpdate) error
+}
+
+type VerificationSender interface {
+	SendVerification(ctx context.Context, user storage.User) error
+}
+
+// New changes the username, email or settings of the authenticated user.
+// A new email needs the current password, it is where reset links go,
+// and gets a verification link.
+func New(log *slog.Logger, userUpdater UserUpdater, verification VerificationSender, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.update.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, ok := authentication.UserFromContext(r.Context())
+		if !ok {
+			log.Error("no authenticated user in context")
+			w.WriteHeader(http.StatusUnauthorized)
+			render.JSON(w, r, resp.Error("Unauthorized"))
+			return
+		}
+
+		var req Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Info("invalid request", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			var validatorErr validator.ValidationErrors
+			if errors.As(err, &validatorErr) {
+				render.JSON(w, r, resp.ValidationError(validatorErr))
+				return
+			}
+			render.JSON(w, r, resp.Error("invalid request"))
+			return
+		}
+
+		if req.Username != nil && *req.Username == user.Username {
+			req.Username = nil
+		}
+		emailChanged := req.Email != nil && !strings.EqualFold(*req.Email, user.Email)
+		if !emailChanged {
+			req.Email = nil
+		}
+
+		if emailChanged {
+			if _, err := userUpdater.ValidateUser(r.Context(), user.Username, req.CurrentPassword); err != nil {
+				if errors.Is(err, storage.ErrWrongPassword) {
+					log.Info("wrong current password", slog.String("username", user.Username))
+					w.WriteHeader(http.StatusForbidden)
+					render.JSON(w, r, resp.Error("current password is required to change the email"))
+					return
+				}
+				log.Error("failed to check current password", sl.Err(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("failed to update account"))
+				return
+			}
+		}
+
+		err := userUpdater.UpdateUser(r.Context(), user.ID, storage.UserUpdate{
+			Username:  req.Username,
+			Email:     req.Email,
+			DedupURLs: req.DedupURLs,
+		})
+		if errors.Is(err, storage.ErrUsernamelExists) {
+			log.Info("username already exists", slog.String("username", *req.Username))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("username already exists"))
+			return
+		}
+		if errors.Is(err, storage.ErrEmailExists) {
+			log.Info("email already exists", slog.String("email", *req.Email))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("email already exists"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to update account", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to update account"))
+			return
+		}
+
+		log.Info("account updated", slog.Int64("user_id", user.ID))
+
+		old := change{DedupURLs: &user.DedupURLs}
+		updated := user
+		if req.Username != nil {
+			old.Username = &user.Username
+			updated.Username = *req.Username
+		}
+		if req.Email != nil {
+			old.Email = &user.Email
+			updated.Email = *req.Email
+			updated.EmailVerified = false
+		}
+
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionUserUpdate,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  updated.Username,
+			Details: audit.Change{
+				Old: old,
+				New: change{Username: req.Username, Email: req.Email, DedupURLs: req.DedupURLs},
+			},
+		})
+
+		if emailChanged {
+			// As on registration, a failed send leaves the user to ask
+			// for another link.
+			if err := verification.SendVerification(r.Context(), updated); err != nil {
+				log.Error("failed to send verification link", sl.Err(err))
+			}
+		}
+
+		render.JSON(w, r, resp.OK())
+	}
+}
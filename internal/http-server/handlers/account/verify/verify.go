@@ -0,0 +1,135 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/account"
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+type Request struct {
+	Token string `json:"token" log:"redact"`
+}
+
+type VerificationChecker interface {
+	CheckVerification(ctx context.Context, token string) (storage.User, error)
+}
+
+type EmailVerifier interface {
+	MarkEmailVerified(ctx context.Context, id int64, email string) error
+}
+
+type VerificationSender interface {
+	SendVerification(ctx context.Context, user storage.User) error
+}
+
+// New marks the email of the user verified. The token comes from the
+// ?token= query of the link, so the link works when opened directly, or
+// from a JSON body.
+func New(log *slog.Logger, checker VerificationChecker, verifier EmailVerifier, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.verify.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		req := Request{Token: r.URL.Query().Get("token")}
+		if req.Token == "" && r.Method == http.MethodPost {
+			if err := render.DecodeJSON(r.Body, &req); err != nil {
+				log.Error("failed to decode request body", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("failed to decode request"))
+				return
+			}
+		}
+		if req.Token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("token is required"))
+			return
+		}
+
+		user, err := checker.CheckVerification(r.Context(), req.Token)
+		if errors.Is(err, account.ErrAlreadyVerified) {
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("email is already verified"))
+			return
+		}
+		if err != nil {
+			log.Info("invalid verification token", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("token is invalid or expired"))
+			return
+		}
+
+		err = verifier.MarkEmailVerified(r.Context(), user.ID, user.Email)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			// The email changed between the check and the update.
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("token is invalid or expired"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to mark email verified", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to verify email"))
+			return
+		}
+
+		log.Info("email verified", slog.String("username", user.Username))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionEmailVerify,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  user.Username,
+			Details: map[string]string{"email": user.Email},
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// NewResend mails the authenticated user a new verification link.
+func NewResend(log *slog.Logger, sender VerificationSender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.account.verify.NewResend"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		if user.EmailVerified {
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("email is already verified"))
+			return
+		}
+
+		if err := sender.SendVerification(r.Context(), user); err != nil {
+			log.Error("failed to send verification link", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to send verification link"))
+			return
+		}
+
+		log.Info("verification link sent", slog.String("username", user.Username))
+
+		w.WriteHeader(http.StatusAccepted)
+		render.JSON(w, r, resp.OK())
+	}
+}
@@ -0,0 +1,253 @@
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+
+	// flushEvery is how many entries are written between flushes to the
+	// client during an export.
+	flushEvery = 100
+)
+
+type AuditLister interface {
+	ListAudit(ctx context.Context, filter storage.AuditFilter, yield func(storage.AuditEntry) error) error
+}
+
+type AuditVerifier interface {
+	VerifyAudit(ctx context.Context) (int64, string, error)
+}
+
+type Entry struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorID    int64           `json:"actor_id,omitempty"`
+	Actor      string          `json:"actor,omitempty"`
+	Action     string          `json:"action"`
+	Target     string          `json:"target,omitempty"`
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Details    json.RawMessage `json:"details"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Entries []Entry `json:"entries"`
+	// NextAfterID is passed as after_id to get the next page; it is
+	// omitted on the last one.
+	NextAfterID int64 `json:"next_after_id,omitempty"`
+}
+
+type VerifyResponse struct {
+	resp.Response
+	Checked int64  `json:"checked"`
+	Head    string `json:"head,omitempty"`
+}
+
+// New lists audit entries, oldest first, filtered by the action, actor,
+// actor_id, target, since, until (RFC 3339) and after_id query parameters.
+// limit defaults to 100 and is capped at 1000.
+func New(log *slog.Logger, lister AuditLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.auditlog.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			log.Info("invalid filter", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		if filter.Limit <= 0 {
+			filter.Limit = defaultLimit
+		}
+		filter.Limit = min(filter.Limit, maxLimit)
+
+		entries := []Entry{}
+		err = lister.ListAudit(r.Context(), filter, func(e storage.AuditEntry) error {
+			entries = append(entries, entryOf(e))
+			return nil
+		})
+		if err != nil {
+			log.Error("failed to list audit entries", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to list audit entries"))
+			return
+		}
+
+		var next int64
+		if len(entries) == filter.Limit {
+			next = entries[len(entries)-1].ID
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response:    resp.OK(),
+			Entries:     entries,
+			NextAfterID: next,
+		})
+	}
+}
+
+// NewExport streams the entries matching the same filters as New as
+// NDJSON, without a limit unless one is given.
+func NewExport(log *slog.Logger, lister AuditLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.auditlog.NewExport"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			log.Info("invalid filter", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+
+		enc := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		rows := 0
+
+		err = lister.ListAudit(r.Context(), filter, func(e storage.AuditEntry) error {
+			if err := enc.Encode(entryOf(e)); err != nil {
+				return err
+			}
+
+			rows++
+			if rows%flushEvery == 0 && flusher != nil {
+				flusher.Flush()
+			}
+
+			return nil
+		})
+		if err != nil {
+			// Headers are already sent, the client sees a truncated file.
+			log.Error("export interrupted", slog.Int("rows", rows), sl.Err(err))
+			return
+		}
+
+		log.Info("export finished", slog.Int("rows", rows))
+	}
+}
+
+// NewVerify checks the hash chain of the whole log. A broken chain is
+// reported with 409 Conflict.
+func NewVerify(log *slog.Logger, verifier AuditVerifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.auditlog.NewVerify"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		checked, head, err := verifier.VerifyAudit(r.Context())
+		if errors.Is(err, storage.ErrAuditTampered) {
+			log.Error("audit log tampered with", slog.Int64("checked", checked), sl.Err(err))
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+		if err != nil {
+			log.Error("failed to verify audit log", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to verify audit log"))
+			return
+		}
+
+		render.JSON(w, r, VerifyResponse{
+			Response: resp.OK(),
+			Checked:  checked,
+			Head:     head,
+		})
+	}
+}
+
+func parseFilter(q url.Values) (storage.AuditFilter, error) {
+	filter := storage.AuditFilter{
+		Action: q.Get("action"),
+		Actor:  q.Get("actor"),
+		Target: q.Get("target"),
+	}
+
+	for name, dst := range map[string]*int64{"actor_id": &filter.ActorID, "after_id": &filter.AfterID} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return storage.AuditFilter{}, fmt.Errorf("invalid %s", name)
+			}
+			*dst = n
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return storage.AuditFilter{}, errors.New("invalid limit")
+		}
+		filter.Limit = n
+	}
+
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return storage.AuditFilter{}, fmt.Errorf("invalid %s, want RFC 3339", name)
+			}
+			*dst = t
+		}
+	}
+
+	return filter, nil
+}
+
+func entryOf(e storage.AuditEntry) Entry {
+	return Entry{
+		ID:         e.ID,
+		CreatedAt:  e.CreatedAt,
+		ActorID:    e.ActorID,
+		Actor:      e.Actor,
+		Action:     e.Action,
+		Target:     e.Target,
+		RemoteAddr: e.RemoteAddr,
+		RequestID:  e.RequestID,
+		Details:    e.Details,
+		PrevHash:   e.PrevHash,
+		Hash:       e.Hash,
+	}
+}
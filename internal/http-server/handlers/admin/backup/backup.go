@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/backup"
+	mwAdmin "url-shorter/internal/http-server/middleware/admin"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+)
+
+type Snapshotter interface {
+	Snapshot(ctx context.Context) (backup.Snapshot, error)
+	List() ([]backup.Snapshot, error)
+}
+
+type Response struct {
+	resp.Response
+	Snapshot backup.Snapshot `json:"snapshot"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Snapshots []backup.Snapshot `json:"snapshots"`
+}
+
+// New takes a snapshot of the database right away.
+func New(log *slog.Logger, snapshotter Snapshotter, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.backup.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		snapshot, err := snapshotter.Snapshot(r.Context())
+		if err != nil {
+			log.Error("failed to take snapshot", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to take snapshot"))
+			return
+		}
+
+		log.Info("snapshot taken", slog.String("name", snapshot.Name), slog.Int64("size", snapshot.Size))
+
+		actorID, actor := mwAdmin.Actor(r.Context())
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionBackupCreate,
+			ActorID: actorID,
+			Actor:   actor,
+			Target:  snapshot.Name,
+			Details: snapshot,
+		})
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Snapshot: snapshot,
+		})
+	}
+}
+
+// NewList lists the kept snapshots, newest first.
+func NewList(log *slog.Logger, snapshotter Snapshotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.backup.NewList"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		snapshots, err := snapshotter.List()
+		if err != nil {
+			log.Error("failed to list snapshots", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to list snapshots"))
+			return
+		}
+
+		if snapshots == nil {
+			snapshots = []backup.Snapshot{}
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response:  resp.OK(),
+			Snapshots: snapshots,
+		})
+	}
+}
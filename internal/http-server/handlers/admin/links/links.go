@@ -0,0 +1,210 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	mwAdmin "url-shorter/internal/http-server/middleware/admin"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type URLLister interface {
+	ListURLs(ctx context.Context, filter storage.URLFilter) ([]storage.URL, error)
+}
+
+type URLTransferer interface {
+	GetUser(ctx context.Context, username string) (storage.User, error)
+	TransferURL(ctx context.Context, alias string, userID int64) (storage.URL, error)
+}
+
+type Link struct {
+	ID        int64      `json:"id"`
+	Alias     string     `json:"alias"`
+	URL       string     `json:"url"`
+	UserID    int64      `json:"user_id,omitempty"`
+	OrgID     int64      `json:"org_id,omitempty"`
+	Clicks    int        `json:"clicks_left"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Links []Link `json:"links"`
+}
+
+type TransferRequest struct {
+	Username string `json:"username"`
+}
+
+// New lists the links of every user and org, newest first, narrowed by
+// the user_id, org_id and query parameters. limit defaults to 100 and is capped at
+// 1000.
+func New(log *slog.Logger, lister URLLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.links.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		filter := storage.URLFilter{
+			Query: r.URL.Query().Get("query"),
+			Limit: defaultLimit,
+		}
+
+		if v := r.URL.Query().Get("user_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id < 0 {
+				log.Info("invalid user_id", slog.String("user_id", v))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("invalid user_id"))
+				return
+			}
+			filter.UserID = id
+		}
+
+		if v := r.URL.Query().Get("org_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id < 0 {
+				log.Info("invalid org_id", slog.String("org_id", v))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("invalid org_id"))
+				return
+			}
+			filter.OrgID = id
+		}
+
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit <= 0 {
+				log.Info("invalid limit", slog.String("limit", v))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("invalid limit"))
+				return
+			}
+			filter.Limit = min(limit, maxLimit)
+		}
+
+		urls, err := lister.ListURLs(r.Context(), filter)
+		if err != nil {
+			log.Error("failed to list links", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to list links"))
+			return
+		}
+
+		links := make([]Link, 0, len(urls))
+		for _, u := range urls {
+			link := Link{
+				ID:     u.ID,
+				Alias:  u.Alias,
+				URL:    u.URL,
+				UserID: u.UserID,
+				OrgID:  u.OrgID,
+				Clicks: u.Clicks,
+				Tags:   u.Tags,
+			}
+			if !u.ExpiresAt.IsZero() {
+				link.ExpiresAt = &u.ExpiresAt
+			}
+			links = append(links, link)
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response: resp.OK(),
+			Links:    links,
+		})
+	}
+}
+
+// NewTransfer makes another user the owner of the link, org links become
+// personal links of that user.
+func NewTransfer(log *slog.Logger, transferer URLTransferer, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.links.NewTransfer"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		alias := chi.URLParam(r, "alias")
+
+		var req TransferRequest
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil || req.Username == "" {
+			log.Info("invalid request")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("username is required"))
+			return
+		}
+
+		owner, err := transferer.GetUser(r.Context(), req.Username)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("new owner not found", slog.String("username", req.Username))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("user not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to get new owner", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to transfer link"))
+			return
+		}
+
+		old, err := transferer.TransferURL(r.Context(), alias, owner.ID)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.Info("link not found", slog.String("alias", alias))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("link not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to transfer link", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to transfer link"))
+			return
+		}
+
+		log.Info("link transferred",
+			slog.String("alias", alias),
+			slog.Int64("from_user_id", old.UserID),
+			slog.Int64("to_user_id", owner.ID),
+		)
+
+		actorID, actor := mwAdmin.Actor(r.Context())
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionLinkTransfer,
+			ActorID: actorID,
+			Actor:   actor,
+			Target:  alias,
+			Details: audit.Change{
+				Old: map[string]int64{"user_id": old.UserID, "org_id": old.OrgID},
+				New: map[string]int64{"user_id": owner.ID},
+			},
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
@@ -0,0 +1,94 @@
+package loglevel
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	mwAdmin "url-shorter/internal/http-server/middleware/admin"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+)
+
+// Leveler is satisfied by *slog.LevelVar.
+type Leveler interface {
+	Level() slog.Level
+	Set(l slog.Level)
+}
+
+type Request struct {
+	Level string `json:"level"`
+}
+
+type Response struct {
+	resp.Response
+	Level string `json:"level"`
+}
+
+// New reports the current log level.
+func New(leveler Leveler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Level:    leveler.Level().String(),
+		})
+	}
+}
+
+// NewSet changes the log level until the next restart.
+func NewSet(log *slog.Logger, leveler Leveler, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.loglevel.NewSet"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		var req Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+			log.Info("invalid log level", slog.String("level", req.Level))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid level"))
+			return
+		}
+
+		previous := leveler.Level()
+		leveler.Set(level)
+
+		// Logged at warn so the change is recorded whatever the new level.
+		log.Warn("log level changed",
+			slog.String("from", previous.String()),
+			slog.String("to", level.String()),
+		)
+
+		actorID, actor := mwAdmin.Actor(r.Context())
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionLogLevelChange,
+			ActorID: actorID,
+			Actor:   actor,
+			Details: audit.Change{
+				Old: previous.String(),
+				New: level.String(),
+			},
+		})
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Level:    level.String(),
+		})
+	}
+}
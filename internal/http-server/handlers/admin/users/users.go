@@ -0,0 +1,201 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	mwAdmin "url-shorter/internal/http-server/middleware/admin"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+type UserLister interface {
+	ListUsers(ctx context.Context) ([]storage.User, error)
+}
+
+type UserManager interface {
+	GetUser(ctx context.Context, username string) (storage.User, error)
+	SetUserRole(ctx context.Context, username, role string) error
+	SetUserDisabled(ctx context.Context, username string, disabled bool) error
+}
+
+type User struct {
+	ID            int64     `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	Disabled      bool      `json:"disabled"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Users []User `json:"users"`
+}
+
+// UpdateRequest holds the fields to change; omitted ones are left as is.
+type UpdateRequest struct {
+	Role     *string `json:"role,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
+}
+
+type UpdateResponse struct {
+	resp.Response
+	User User `json:"user"`
+}
+
+// New lists every user.
+func New(log *slog.Logger, lister UserLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.users.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		users, err := lister.ListUsers(r.Context())
+		if err != nil {
+			log.Error("failed to list users", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to list users"))
+			return
+		}
+
+		views := make([]User, 0, len(users))
+		for _, u := range users {
+			views = append(views, userOf(u))
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response: resp.OK(),
+			Users:    views,
+		})
+	}
+}
+
+// NewUpdate changes the role of the user or disables them. Admins can not
+// do either to themselves, so an installation never locks out its last
+// admin by accident.
+func NewUpdate(log *slog.Logger, manager UserManager, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.admin.users.NewUpdate"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		username := chi.URLParam(r, "username")
+
+		var req UpdateRequest
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if req.Role != nil && !storage.ValidRole(*req.Role) {
+			log.Info("invalid role", slog.String("role", *req.Role))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("role must be admin, member or read-only"))
+			return
+		}
+
+		actorID, actor := mwAdmin.Actor(r.Context())
+
+		user, err := manager.GetUser(r.Context(), username)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("user not found", slog.String("username", username))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("user not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to get user", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to update user"))
+			return
+		}
+
+		if user.ID == actorID {
+			log.Info("admin tried to change themselves", slog.String("username", username))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("admins can not change their own role or disable themselves"))
+			return
+		}
+
+		if req.Role != nil && *req.Role != user.Role {
+			if err := manager.SetUserRole(r.Context(), username, *req.Role); err != nil {
+				log.Error("failed to set role", sl.Err(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("failed to update user"))
+				return
+			}
+
+			log.Info("role changed", slog.String("username", username), slog.String("role", *req.Role))
+			auditor.Record(r, audit.Event{
+				Action:  audit.ActionUserRoleChange,
+				ActorID: actorID,
+				Actor:   actor,
+				Target:  username,
+				Details: audit.Change{Old: user.Role, New: *req.Role},
+			})
+			user.Role = *req.Role
+		}
+
+		if req.Disabled != nil && *req.Disabled != user.Disabled {
+			if err := manager.SetUserDisabled(r.Context(), username, *req.Disabled); err != nil {
+				log.Error("failed to set disabled", sl.Err(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("failed to update user"))
+				return
+			}
+
+			action := audit.ActionUserEnable
+			if *req.Disabled {
+				action = audit.ActionUserDisable
+			}
+
+			log.Info("disabled changed", slog.String("username", username), slog.Bool("disabled", *req.Disabled))
+			auditor.Record(r, audit.Event{
+				Action:  action,
+				ActorID: actorID,
+				Actor:   actor,
+				Target:  username,
+			})
+			user.Disabled = *req.Disabled
+		}
+
+		render.JSON(w, r, UpdateResponse{
+			Response: resp.OK(),
+			User:     userOf(user),
+		})
+	}
+}
+
+func userOf(u storage.User) User {
+	return User{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Role:          u.Role,
+		Disabled:      u.Disabled,
+		CreatedAt:     u.CreatedAt,
+	}
+}
@@ -0,0 +1,151 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/storage"
+	"url-shorter/internal/twofactor"
+)
+
+type Request struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required" log:"redact"`
+	// Code is the code of the authenticator app or a recovery code, only
+	// needed for accounts with two-factor authentication.
+	Code string `json:"code,omitempty" log:"redact"`
+}
+
+type Response struct {
+	resp.Response
+	Token             string     `json:"token,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	TwoFactorRequired bool       `json:"two_factor_required,omitempty"`
+}
+
+type UserAuth interface {
+	ValidateUser(ctx context.Context, username, password string) (storage.User, error)
+}
+
+type SecondFactor interface {
+	Check(ctx context.Context, user storage.User, code string) (string, error)
+}
+
+type SessionIssuer interface {
+	IssueSession(ctx context.Context, user storage.User) (string, time.Time, error)
+}
+
+// New exchanges credentials for a bearer session token. Accounts with
+// two-factor authentication also have to send a code; without one the
+// response asks for it.
+func New(log *slog.Logger, userAuth UserAuth, secondFactor SecondFactor, sessions SessionIssuer, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.auth.login.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		var req Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Info("invalid request", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("username and password are required"))
+			return
+		}
+
+		fail := func(reason string, res Response) {
+			metrics.AuthFailures.WithLabelValues(reason).Inc()
+			auditor.Record(r, audit.Event{
+				Action:  audit.ActionLoginFailed,
+				Actor:   req.Username,
+				Target:  req.Username,
+				Details: map[string]string{"reason": reason},
+			})
+			w.WriteHeader(http.StatusUnauthorized)
+			render.JSON(w, r, res)
+		}
+
+		user, err := userAuth.ValidateUser(r.Context(), req.Username, req.Password)
+		if err != nil {
+			log.Warn("invalid credentials", slog.String("username", req.Username), sl.Err(err))
+			fail(authentication.FailureReason(err), Response{Response: resp.Error("invalid username or password")})
+			return
+		}
+
+		method := "password"
+
+		if user.TOTPEnabled {
+			if req.Code == "" {
+				log.Info("two-factor code required", slog.String("username", user.Username))
+				w.WriteHeader(http.StatusUnauthorized)
+				render.JSON(w, r, Response{
+					Response:          resp.Error("two-factor code required"),
+					TwoFactorRequired: true,
+				})
+				return
+			}
+
+			method, err = secondFactor.Check(r.Context(), user, req.Code)
+			if errors.Is(err, twofactor.ErrInvalidCode) {
+				log.Warn("invalid two-factor code", slog.String("username", user.Username))
+				fail("invalid_code", Response{
+					Response:          resp.Error("invalid two-factor code"),
+					TwoFactorRequired: true,
+				})
+				return
+			}
+			if err != nil {
+				log.Error("failed to check two-factor code", sl.Err(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("failed to log in"))
+				return
+			}
+		}
+
+		token, expiresAt, err := sessions.IssueSession(r.Context(), user)
+		if err != nil {
+			log.Error("failed to issue session", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to log in"))
+			return
+		}
+
+		log.Info("logged in", slog.String("username", user.Username), slog.String("method", method))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionLogin,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  user.Username,
+			Details: map[string]string{"method": method},
+		})
+
+		render.JSON(w, r, Response{
+			Response:  resp.OK(),
+			Token:     token,
+			ExpiresAt: &expiresAt,
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package login
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shorter/internal/audit"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/hash_password"
+	"url-shorter/internal/lib/totp"
+	"url-shorter/internal/storage"
+	"url-shorter/internal/storage/sqlite/sqlitetest"
+	"url-shorter/internal/twofactor"
+)
+
+type stubSessions struct{}
+
+func (stubSessions) IssueSession(context.Context, storage.User) (string, time.Time, error) {
+	return "session-token", time.Now().Add(time.Hour), nil
+}
+
+type recordingAuditor struct {
+	events []audit.Event
+}
+
+func (a *recordingAuditor) Record(_ *http.Request, e audit.Event) {
+	a.events = append(a.events, e)
+}
+
+func TestLoginWithTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	s := sqlitetest.New(t, "")
+	hasher, err := hash_password.New(hash_password.Config{Algorithm: hash_password.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPasswordHasher(hasher)
+	secondFactor := twofactor.New(s, twofactor.Config{Issuer: "url-shorter", RecoveryCodes: 2})
+
+	// The first user is an admin and may enroll.
+	if _, err := s.SaveUser(ctx, "amy", "amy@example.com", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveUser(ctx, "bob", "bob@example.com", "password2"); err != nil {
+		t.Fatal(err)
+	}
+
+	amy, err := s.ValidateUser(ctx, "amy", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollment, err := secondFactor.Enroll(ctx, amy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Confirming spends the current step, the login uses the next one.
+	step := totp.Step(time.Now())
+	code, err := totp.Code(enrollment.Secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := secondFactor.Confirm(ctx, amy, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := totp.Code(enrollment.Secret, step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditor := &recordingAuditor{}
+	h := New(slog.New(slog.NewTextHandler(io.Discard, nil)), s, secondFactor, stubSessions{}, auditor)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantCode    int
+		wantToken   bool
+		wantAskCode bool
+	}{
+		{"no two-factor", `{"username":"bob","password":"password2"}`, http.StatusOK, true, false},
+		{"code missing", `{"username":"amy","password":"password1"}`, http.StatusUnauthorized, false, true},
+		{"wrong code", `{"username":"amy","password":"password1","code":"000000"}`, http.StatusUnauthorized, false, true},
+		{"wrong password", `{"username":"amy","password":"nope","code":"` + next + `"}`, http.StatusUnauthorized, false, false},
+		{"valid code", `{"username":"amy","password":"password1","code":"` + next + `"}`, http.StatusOK, true, false},
+		{"replayed code", `{"username":"amy","password":"password1","code":"` + next + `"}`, http.StatusUnauthorized, false, true},
+		{"recovery code", `{"username":"amy","password":"password1","code":"` + recoveryCodes[0] + `"}`, http.StatusOK, true, false},
+		{"reused recovery code", `{"username":"amy","password":"password1","code":"` + recoveryCodes[0] + `"}`, http.StatusUnauthorized, false, true},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body)))
+
+		var got Response
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status = %d; want %d: %s", tt.name, w.Code, tt.wantCode, w.Body)
+		}
+		if (got.Token != "") != tt.wantToken {
+			t.Errorf("%s: token = %q; want one: %v", tt.name, got.Token, tt.wantToken)
+		}
+		if got.TwoFactorRequired != tt.wantAskCode {
+			t.Errorf("%s: two_factor_required = %v; want %v", tt.name, got.TwoFactorRequired, tt.wantAskCode)
+		}
+		if tt.wantToken && got.Status != resp.StatusOK {
+			t.Errorf("%s: status = %q; want %q", tt.name, got.Status, resp.StatusOK)
+		}
+	}
+
+	// The wrong, replayed and reused codes are audited as failed logins.
+	invalidCodes := 0
+	for _, e := range auditor.events {
+		if e.Action == audit.ActionLoginFailed && e.Details.(map[string]string)["reason"] == "invalid_code" {
+			invalidCodes++
+		}
+	}
+	if invalidCodes != 3 {
+		t.Errorf("audited %d failed logins with an invalid code; want 3", invalidCodes)
+	}
+}
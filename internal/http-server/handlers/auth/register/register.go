@@ -1,6 +1,7 @@
 package register
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
@@ -9,16 +10,18 @@ import (
 	"github.com/go-chi/render"
 	"github.com/go-playground/validator/v10"
 
+	"url-shorter/internal/audit"
 	resp "url-shorter/internal/lib/api/response"
 	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/password_policy"
 	"url-shorter/internal/storage"
 )
 
 type Request struct {
 	Username   string `json:"username" validate:"required,min=3,max=50,alphanum"`
 	Email      string `json:"email" validate:"required,email"`
-	Password   string `json:"password" validate:"required,min=8"`
-	PasswordRe string `json:"password_re" validate:"required,eqfield=Password"`
+	Password   string `json:"password" validate:"required,min=8" log:"redact"`
+	PasswordRe string `json:"password_re" validate:"required,eqfield=Password" log:"redact"`
 }
 
 type Response struct {
@@ -27,16 +30,24 @@ type Response struct {
 }
 
 type UserSaver interface {
-	SaveUser(username, email, password string) (int64, error)
+	SaveUser(ctx context.Context, username, email, password string) (int64, error)
 }
 
-func New(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
+type VerificationSender interface {
+	SendVerification(ctx context.Context, user storage.User) error
+}
+
+// New registers a user and mails them a link to verify their email. A
+// failed send does not fail the registration, the user can ask for
+// another link.
+func New(log *slog.Logger, userSaver UserSaver, verification VerificationSender, auditor audit.Auditor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const fn = "handlers.auth.register.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("fn", fn),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
 		)
 
 		var req Request
@@ -60,7 +71,7 @@ func New(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
 			return
 		}
 
-		id, err := userSaver.SaveUser(req.Username, req.Email, req.Password)
+		id, err := userSaver.SaveUser(r.Context(), req.Username, req.Email, req.Password)
 
 		if errors.Is(err, storage.ErrUsernamelExists) {
 			log.Info("username already exists", slog.String("username", req.Username))
@@ -76,6 +87,18 @@ func New(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
 			return
 		}
 
+		if errors.Is(err, storage.ErrInvalidPassword) {
+			log.Info("password refused by the policy", sl.Err(err))
+			msg := storage.ErrInvalidPassword.Error()
+			var policyErr *password_policy.ValidationError
+			if errors.As(err, &policyErr) {
+				msg = policyErr.Message
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(msg))
+			return
+		}
+
 		if err != nil {
 			log.Error("failed to add user", sl.Err(err))
 			w.WriteHeader(http.StatusBadRequest)
@@ -85,6 +108,19 @@ func New(log *slog.Logger, userSaver UserSaver) http.HandlerFunc {
 
 		log.Info("user added", slog.Int64("id", id))
 
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionUserRegister,
+			ActorID: id,
+			Actor:   req.Username,
+			Target:  req.Username,
+			Details: map[string]string{"email": req.Email},
+		})
+
+		user := storage.User{ID: id, Username: req.Username, Email: req.Email}
+		if err := verification.SendVerification(r.Context(), user); err != nil {
+			log.Error("failed to send verification link", sl.Err(err))
+		}
+
 		w.WriteHeader(http.StatusCreated)
 		render.JSON(w, r, Response{
 			Response: resp.OK(),
@@ -1,6 +1,7 @@
 package delete
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -9,21 +10,26 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
 	resp "url-shorter/internal/lib/api/response"
 	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
 )
 
+// URLDeleter deletes the link only if ownerID owns it, unless ownerID is 0.
 type URLDeleter interface {
-	DeleteURL(id int) error
+	DeleteURL(ctx context.Context, id int, ownerID int64) (storage.URL, error)
 }
 
-func New(log *slog.Logger, urlDeleter URLDeleter) http.HandlerFunc {
+func New(log *slog.Logger, urlDeleter URLDeleter, auditor audit.Auditor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const fn = "handlers.delete.New"
 
 		log := log.With(
 			slog.String("fn", fn),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
 		)
 
 		idStr := chi.URLParam(r, "id")
@@ -41,7 +47,21 @@ func New(log *slog.Logger, urlDeleter URLDeleter) http.HandlerFunc {
 			return
 		}
 
-		err = urlDeleter.DeleteURL(id)
+		// Admins may delete any link, everybody else only their own. Without
+		// a user ownerID would be 0 and let the deletion through for any link.
+		user, ok := authentication.UserFromContext(r.Context())
+		if !ok {
+			log.Error("no authenticated user in context")
+			w.WriteHeader(http.StatusUnauthorized)
+			render.JSON(w, r, resp.Error("Unauthorized"))
+			return
+		}
+		ownerID := user.ID
+		if user.Role == storage.RoleAdmin {
+			ownerID = 0
+		}
+
+		deleted, err := urlDeleter.DeleteURL(r.Context(), id, ownerID)
 
 		if err != nil {
 			log.Error("deletion not completed", slog.Int64("id", int64(id)), sl.Err(err))
@@ -50,6 +70,15 @@ func New(log *slog.Logger, urlDeleter URLDeleter) http.HandlerFunc {
 		}
 
 		log.Info("deletion completed", slog.Int64("id", int64(id)))
+
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionLinkDelete,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  deleted.Alias,
+			Details: audit.Change{Old: audit.LinkOf(deleted)},
+		})
+
 		render.JSON(w, r, resp.OK())
 	}
 }
@@ -0,0 +1,121 @@
+package delete
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/hash_password"
+	"url-shorter/internal/lib/token"
+	"url-shorter/internal/storage"
+	"url-shorter/internal/storage/sqlite/sqlitetest"
+)
+
+type noSessions struct{}
+
+func (noSessions) CheckSession(context.Context, string) (storage.User, error) {
+	return storage.User{}, token.ErrInvalid
+}
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(*http.Request, audit.Event) {}
+
+func TestDeleteIsOwnerScoped(t *testing.T) {
+	ctx := context.Background()
+	s := sqlitetest.New(t, "")
+	hasher, err := hash_password.New(hash_password.Config{Algorithm: hash_password.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPasswordHasher(hasher)
+
+	// The first user is an admin, the others members.
+	ids := make(map[string]int64)
+	for _, name := range []string{"amy", "bob", "carl"} {
+		id, err := s.SaveUser(ctx, name, name+"@example.com", "password1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = id
+	}
+
+	links := make(map[string]int64)
+	for alias, owner := range map[string]string{"bobs": "bob", "carls": "carl"} {
+		id, err := s.SaveURL(ctx, storage.URL{Alias: alias, URL: "https://example.com/" + alias, UserID: ids[owner]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		links[alias] = id
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	router := chi.NewRouter()
+	router.With(authentication.BasicAuthMiddleware(log, s, noSessions{}, nopAuditor{})).
+		Delete("/url/{id}", New(log, s, nopAuditor{}))
+
+	tests := []struct {
+		name     string
+		username string
+		alias    string
+		deleted  bool
+	}{
+		{"someone else's link", "carl", "bobs", false},
+		{"own link", "bob", "bobs", true},
+		{"admin deletes any link", "amy", "carls", true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodDelete, "/url/"+strconv.FormatInt(links[tt.alias], 10), nil)
+		r.SetBasicAuth(tt.username, "password1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		var got resp.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if ok := got.Status == resp.StatusOK; ok != tt.deleted {
+			t.Errorf("%s: response %s; want deleted %v", tt.name, w.Body, tt.deleted)
+		}
+
+		exists, err := s.IsAliasExists(ctx, tt.alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists == tt.deleted {
+			t.Errorf("%s: link %s exists = %v after the request", tt.name, tt.alias, exists)
+		}
+	}
+}
+
+func TestDeleteWithoutUser(t *testing.T) {
+	s := sqlitetest.New(t, "")
+	id, err := s.SaveURL(context.Background(), storage.URL{Alias: "kept", URL: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := chi.NewRouter()
+	router.Delete("/url/{id}", New(slog.New(slog.NewTextHandler(io.Discard, nil)), s, nopAuditor{}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/url/"+strconv.FormatInt(id, 10), nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusUnauthorized)
+	}
+	if exists, err := s.IsAliasExists(context.Background(), "kept"); err != nil || !exists {
+		t.Errorf("IsAliasExists() = %v, %v; the link must survive a request without a user", exists, err)
+	}
+}
@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/go-chi/render"
+
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+)
+
+// Check is one readiness condition; a non-nil error makes the instance
+// not ready.
+type Check struct {
+	Name string
+	Func func(ctx context.Context) error
+}
+
+type ReadinessResponse struct {
+	resp.Response
+	Checks map[string]string `json:"checks"`
+}
+
+// NewLiveness answers as long as the process serves requests.
+func NewLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// NewReadiness runs every check and answers 503 when one of them fails or
+// shuttingDown is set.
+func NewReadiness(log *slog.Logger, shuttingDown *atomic.Bool, checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.health.NewReadiness"
+
+		log := log.With(slog.String("fn", fn))
+
+		res := ReadinessResponse{
+			Response: resp.OK(),
+			Checks:   make(map[string]string, len(checks)),
+		}
+
+		if shuttingDown.Load() {
+			res.Response = resp.Error("shutting down")
+		}
+
+		for _, check := range checks {
+			if err := check.Func(r.Context()); err != nil {
+				log.Warn("readiness check failed", slog.String("check", check.Name), sl.Err(err))
+				res.Checks[check.Name] = err.Error()
+				if res.Status == resp.StatusOK {
+					res.Response = resp.Error("not ready")
+				}
+				continue
+			}
+			res.Checks[check.Name] = "ok"
+		}
+
+		if res.Status != resp.StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		render.JSON(w, r, res)
+	}
+}
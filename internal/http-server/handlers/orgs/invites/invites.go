@@ -0,0 +1,326 @@
+package invites
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	"url-shorter/internal/http-server/middleware/authorization"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+// tokenBytes is the entropy of an invite token.
+const tokenBytes = 32
+
+type InviteCreator interface {
+	CreateOrgInvite(ctx context.Context, inv storage.OrgInvite, token string) (storage.OrgInvite, error)
+}
+
+type InviteLister interface {
+	ListOrgInvites(ctx context.Context, orgID int64) ([]storage.OrgInvite, error)
+}
+
+type InviteRevoker interface {
+	RevokeOrgInvite(ctx context.Context, orgID, inviteID int64) error
+}
+
+type InviteAccepter interface {
+	AcceptOrgInvite(ctx context.Context, token string, user storage.User) (storage.Org, storage.OrgInvite, error)
+}
+
+type Request struct {
+	Email string `json:"email" validate:"required,email"`
+	// Role defaults to member; owners are appointed after joining.
+	Role string `json:"role,omitempty" validate:"omitempty,oneof=admin member"`
+}
+
+type Invite struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Response carries the token of a new invite. It is shown only here, the
+// storage keeps just its hash.
+type Response struct {
+	resp.Response
+	Invite Invite `json:"invite"`
+	Token  string `json:"token"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Invites []Invite `json:"invites"`
+}
+
+type AcceptRequest struct {
+	Token string `json:"token"`
+}
+
+type AcceptResponse struct {
+	resp.Response
+	Org  string `json:"org"`
+	Role string `json:"role"`
+}
+
+// New invites the user with the given email into the org. The returned
+// token is single use and expires after ttl.
+func New(log *slog.Logger, creator InviteCreator, ttl time.Duration, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.invites.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, actor, _ := authorization.OrgFromContext(r.Context())
+
+		var req Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Info("invalid request", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			var validatorErr validator.ValidationErrors
+			if errors.As(err, &validatorErr) {
+				render.JSON(w, r, resp.ValidationError(validatorErr))
+				return
+			}
+			render.JSON(w, r, resp.Error("invalid request"))
+			return
+		}
+
+		if req.Role == "" {
+			req.Role = storage.OrgRoleMember
+		}
+
+		token, err := newToken()
+		if err != nil {
+			log.Error("failed to generate invite token", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to create invite"))
+			return
+		}
+
+		inv, err := creator.CreateOrgInvite(r.Context(), storage.OrgInvite{
+			OrgID:     org.ID,
+			Email:     req.Email,
+			Role:      req.Role,
+			InvitedBy: actor.UserID,
+			ExpiresAt: time.Now().Add(ttl),
+		}, token)
+		if err != nil {
+			log.Error("failed to create invite", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to create invite"))
+			return
+		}
+
+		log.Info("invite created", slog.String("org", org.Name), slog.Int64("id", inv.ID))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionOrgInviteCreate,
+			ActorID: actor.UserID,
+			Actor:   actor.Username,
+			Target:  org.Name,
+			Details: inviteOf(inv),
+		})
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Invite:   inviteOf(inv),
+			Token:    token,
+		})
+	}
+}
+
+// NewList lists the invites of the org that can still be accepted.
+func NewList(log *slog.Logger, lister InviteLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.invites.NewList"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, _, _ := authorization.OrgFromContext(r.Context())
+
+		invites, err := lister.ListOrgInvites(r.Context(), org.ID)
+		if err != nil {
+			log.Error("failed to list invites", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to list invites"))
+			return
+		}
+
+		views := make([]Invite, 0, len(invites))
+		for _, inv := range invites {
+			views = append(views, inviteOf(inv))
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response: resp.OK(),
+			Invites:  views,
+		})
+	}
+}
+
+// NewRevoke deletes an invite that has not been accepted yet.
+func NewRevoke(log *slog.Logger, revoker InviteRevoker, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.invites.NewRevoke"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, actor, _ := authorization.OrgFromContext(r.Context())
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Info("invalid invite id", slog.String("id", chi.URLParam(r, "id")))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid invite id"))
+			return
+		}
+
+		err = revoker.RevokeOrgInvite(r.Context(), org.ID, id)
+		if errors.Is(err, storage.ErrInviteNotFound) {
+			log.Info("invite not found", slog.Int64("id", id))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("invite not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to revoke invite", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to revoke invite"))
+			return
+		}
+
+		log.Info("invite revoked", slog.String("org", org.Name), slog.Int64("id", id))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionOrgInviteRevoke,
+			ActorID: actor.UserID,
+			Actor:   actor.Username,
+			Target:  org.Name,
+			Details: map[string]int64{"invite_id": id},
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// NewAccept adds the authenticated user to the org of the invite. The
+// invite must be addressed to the user's email, which must be verified,
+// otherwise anyone could register with the invited address.
+func NewAccept(log *slog.Logger, accepter InviteAccepter, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.invites.NewAccept"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		if !user.EmailVerified {
+			log.Info("email not verified", slog.String("username", user.Username))
+			w.WriteHeader(http.StatusForbidden)
+			render.JSON(w, r, resp.Error("verify your email first"))
+			return
+		}
+
+		var req AcceptRequest
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil || req.Token == "" {
+			log.Info("invalid request")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("token is required"))
+			return
+		}
+
+		org, inv, err := accepter.AcceptOrgInvite(r.Context(), req.Token, user)
+		if errors.Is(err, storage.ErrInviteNotFound) {
+			log.Info("invite not found", slog.String("username", user.Username))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("invite is invalid, expired or already used"))
+			return
+		}
+		if errors.Is(err, storage.ErrMemberExists) {
+			log.Info("user already is a member", slog.String("org", org.Name), slog.String("username", user.Username))
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("already a member of the org"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to accept invite", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to accept invite"))
+			return
+		}
+
+		log.Info("invite accepted", slog.String("org", org.Name), slog.String("username", user.Username))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionOrgMemberJoin,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  org.Name + "/" + user.Username,
+			Details: map[string]any{"invite_id": inv.ID, "role": inv.Role},
+		})
+
+		render.JSON(w, r, AcceptResponse{
+			Response: resp.OK(),
+			Org:      org.Name,
+			Role:     inv.Role,
+		})
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func inviteOf(inv storage.OrgInvite) Invite {
+	return Invite{
+		ID:        inv.ID,
+		Email:     inv.Email,
+		Role:      inv.Role,
+		CreatedAt: inv.CreatedAt,
+		ExpiresAt: inv.ExpiresAt,
+	}
+}
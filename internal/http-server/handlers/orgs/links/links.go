@@ -0,0 +1,574 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/handlers/url/save"
+	"url-shorter/internal/http-server/middleware/authorization"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/lib/url_validation"
+	"url-shorter/internal/storage"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+var (
+	ErrClickBudget = errors.New("max_clicks exceeds the click budget of the org")
+	ErrLinkTTL     = errors.New("expires_at exceeds the link lifetime of the org")
+)
+
+type URLLister interface {
+	ListURLs(ctx context.Context, filter storage.URLFilter) ([]storage.URL, error)
+}
+
+type URLSaver interface {
+	SaveURL(ctx context.Context, u storage.URL) (int64, error)
+	IsAliasExists(ctx context.Context, alias string) (bool, error)
+}
+
+type URLUpdater interface {
+	UpdateOrgURL(ctx context.Context, orgID int64, alias string, upd storage.URLUpdate) (storage.URL, storage.URL, error)
+}
+
+type URLDeleter interface {
+	DeleteOrgURL(ctx context.Context, orgID int64, alias string) (storage.URL, error)
+}
+
+type StatsGetter interface {
+	GetOrgURL(ctx context.Context, orgID int64, alias string) (storage.URL, error)
+	URLClickStats(ctx context.Context, urlID int64) (storage.ClickStats, error)
+}
+
+type AliasValidator interface {
+	Validate(alias string) (string, error)
+}
+
+type URLValidator interface {
+	Check(u string) error
+	Normalize(u string) (string, error)
+}
+
+type Link struct {
+	Alias     string     `json:"alias"`
+	URL       string     `json:"url"`
+	Clicks    int        `json:"clicks_left"`
+	Redirects int64      `json:"redirects"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Links []Link `json:"links"`
+}
+
+type SaveResponse struct {
+	resp.Response
+	Alias string `json:"alias"`
+}
+
+// UpdateRequest holds the link fields to change; omitted ones are left as
+// is.
+type UpdateRequest struct {
+	URL       *string    `json:"url,omitempty" validate:"omitempty,url"`
+	MaxClicks *int       `json:"max_clicks,omitempty" validate:"omitempty,min=1"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      *[]string  `json:"tags,omitempty" validate:"omitempty,max=20,dive,min=1,max=32,excludesall=0x2C"`
+}
+
+type LinkResponse struct {
+	resp.Response
+	Link Link `json:"link"`
+}
+
+type Stats struct {
+	Clicks      int          `json:"clicks_left"`
+	Redirects   int64        `json:"redirects"`
+	LastClickAt *time.Time   `json:"last_click_at,omitempty"`
+	ByDay       []DayCount   `json:"by_day"`
+	Countries   []ValueCount `json:"countries"`
+	Referrers   []ValueCount `json:"referrers"`
+}
+
+type DayCount struct {
+	Day       string `json:"day"`
+	Redirects int64  `json:"redirects"`
+}
+
+type ValueCount struct {
+	Value     string `json:"value"`
+	Redirects int64  `json:"redirects"`
+}
+
+type StatsResponse struct {
+	resp.Response
+	Alias string `json:"alias"`
+	Stats Stats  `json:"stats"`
+}
+
+// New lists the links of the org, newest first, narrowed by the query
+// parameter. limit defaults to 100 and is capped at 1000.
+func New(log *slog.Logger, lister URLLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.links.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, _, _ := authorization.OrgFromContext(r.Context())
+
+		filter := storage.URLFilter{
+			OrgID:          org.ID,
+			Query:          r.URL.Query().Get("query"),
+			Limit:          defaultLimit,
+			WithClickCount: true,
+		}
+
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit <= 0 {
+				log.Info("invalid limit", slog.String("limit", v))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("invalid limit"))
+				return
+			}
+			filter.Limit = min(limit, maxLimit)
+		}
+
+		urls, err := lister.ListURLs(r.Context(), filter)
+		if err != nil {
+			log.Error("failed to list links", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to list links"))
+			return
+		}
+
+		links := make([]Link, 0, len(urls))
+		for _, u := range urls {
+			links = append(links, linkOf(u))
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response: resp.OK(),
+			Links:    links,
+		})
+	}
+}
+
+// NewSave creates a link owned by the org. It takes the same request as
+// save.New, the org policy fills in the click budget and the expiry
+// when they are omitted and rejects links beyond them.
+func NewSave(log *slog.Logger, saver URLSaver, aliasValidator AliasValidator, urlValidator URLValidator, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.links.NewSave"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, actor, _ := authorization.OrgFromContext(r.Context())
+
+		var req save.Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		u, err := save.Prepare(req, aliasValidator, urlValidator)
+		if err == nil {
+			err = applyPolicy(&u, org.Policy, time.Now())
+		}
+		if err != nil {
+			var reqErr *save.RequestError
+			if errors.As(err, &reqErr) {
+				log.Info("invalid request", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, reqErr.Response)
+				return
+			}
+			log.Error("failed to prepare url", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to add url"))
+			return
+		}
+
+		u.OrgID = org.ID
+
+		if exists, err := saver.IsAliasExists(r.Context(), u.Alias); err != nil {
+			log.Error("failed to check alias uniqueness", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to check alias uniqueness"))
+			return
+		} else if exists {
+			log.Info("alias already exists", slog.String("alias", u.Alias))
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("alias already exists"))
+			return
+		}
+
+		id, err := saver.SaveURL(r.Context(), u)
+		if errors.Is(err, storage.ErrURLExists) {
+			log.Info("url already exists", slog.String("alias", u.Alias))
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("url already exists"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to add url", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to add url"))
+			return
+		}
+
+		log.Info("org url added", slog.String("org", org.Name), slog.Int64("id", id))
+		metrics.LinksCreated.WithLabelValues(metrics.SourceSingle).Inc()
+
+		u.ID = id
+		if u.Clicks == 0 {
+			u.Clicks = storage.DefaultClicks
+		}
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionLinkCreate,
+			ActorID: actor.UserID,
+			Actor:   actor.Username,
+			Target:  u.Alias,
+			Details: audit.Change{New: audit.LinkOf(u)},
+		})
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, SaveResponse{
+			Response: resp.OK(),
+			Alias:    u.Alias,
+		})
+	}
+}
+
+// NewUpdate edits a link of the org. Changed fields are checked against
+// the url policy and the org policy as they would be for a new link.
+func NewUpdate(log *slog.Logger, updater URLUpdater, urlValidator URLValidator, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.links.NewUpdate"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, actor, _ := authorization.OrgFromContext(r.Context())
+		alias := chi.URLParam(r, "alias")
+
+		var req UpdateRequest
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		upd, err := prepareUpdate(req, org.Policy, urlValidator, time.Now())
+		if err != nil {
+			var reqErr *save.RequestError
+			if errors.As(err, &reqErr) {
+				log.Info("invalid request", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, reqErr.Response)
+				return
+			}
+			log.Error("failed to prepare update", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to update link"))
+			return
+		}
+
+		old, u, err := updater.UpdateOrgURL(r.Context(), org.ID, alias, upd)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.Info("link not found", slog.String("alias", alias))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("link not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to update link", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to update link"))
+			return
+		}
+
+		log.Info("org url updated", slog.String("org", org.Name), slog.String("alias", alias))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionLinkUpdate,
+			ActorID: actor.UserID,
+			Actor:   actor.Username,
+			Target:  alias,
+			Details: audit.Change{Old: audit.LinkOf(old), New: audit.LinkOf(u)},
+		})
+
+		render.JSON(w, r, LinkResponse{
+			Response: resp.OK(),
+			Link:     linkOf(u),
+		})
+	}
+}
+
+// NewDelete removes a link of the org.
+func NewDelete(log *slog.Logger, deleter URLDeleter, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.links.NewDelete"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, actor, _ := authorization.OrgFromContext(r.Context())
+		alias := chi.URLParam(r, "alias")
+
+		old, err := deleter.DeleteOrgURL(r.Context(), org.ID, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.Info("link not found", slog.String("alias", alias))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("link not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to delete link", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to delete link"))
+			return
+		}
+
+		log.Info("org url deleted", slog.String("org", org.Name), slog.String("alias", alias))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionLinkDelete,
+			ActorID: actor.UserID,
+			Actor:   actor.Username,
+			Target:  alias,
+			Details: audit.Change{Old: audit.LinkOf(old)},
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// NewStats sums up the redirects of a link of the org.
+func NewStats(log *slog.Logger, getter StatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.links.NewStats"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, _, _ := authorization.OrgFromContext(r.Context())
+		alias := chi.URLParam(r, "alias")
+
+		u, err := getter.GetOrgURL(r.Context(), org.ID, alias)
+		if errors.Is(err, storage.ErrURLNotFound) {
+			log.Info("link not found", slog.String("alias", alias))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("link not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to get link", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to get stats"))
+			return
+		}
+
+		clickStats, err := getter.URLClickStats(r.Context(), u.ID)
+		if err != nil {
+			log.Error("failed to get click stats", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to get stats"))
+			return
+		}
+
+		stats := Stats{
+			Clicks:    u.Clicks,
+			Redirects: clickStats.Total,
+			ByDay:     make([]DayCount, 0, len(clickStats.ByDay)),
+			Countries: valueCounts(clickStats.Countries),
+			Referrers: valueCounts(clickStats.Referrers),
+		}
+		if !clickStats.LastClickAt.IsZero() {
+			stats.LastClickAt = &clickStats.LastClickAt
+		}
+		for _, d := range clickStats.ByDay {
+			stats.ByDay = append(stats.ByDay, DayCount{Day: d.Day, Redirects: d.Clicks})
+		}
+
+		render.JSON(w, r, StatsResponse{
+			Response: resp.OK(),
+			Alias:    u.Alias,
+			Stats:    stats,
+		})
+	}
+}
+
+// applyPolicy fills in the defaults of the org policy and rejects a link
+// that goes beyond it.
+func applyPolicy(u *storage.URL, p storage.OrgPolicy, now time.Time) error {
+	if err := checkDomain(u.URL, p); err != nil {
+		return err
+	}
+
+	if p.ClickBudget > 0 {
+		if u.Clicks == 0 {
+			u.Clicks = p.ClickBudget
+		}
+		if err := checkClicks(u.Clicks, p); err != nil {
+			return err
+		}
+	}
+
+	if p.LinkTTL > 0 {
+		if u.ExpiresAt.IsZero() {
+			u.ExpiresAt = now.Add(p.LinkTTL).UTC()
+		}
+		if err := checkExpiry(u.ExpiresAt, p, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prepareUpdate validates the changed fields the way save.Prepare and
+// applyPolicy do for a new link.
+func prepareUpdate(req UpdateRequest, p storage.OrgPolicy, urlValidator URLValidator, now time.Time) (storage.URLUpdate, error) {
+	if err := validator.New().Struct(req); err != nil {
+		var validatorErr validator.ValidationErrors
+		if errors.As(err, &validatorErr) {
+			return storage.URLUpdate{}, &save.RequestError{Response: resp.ValidationError(validatorErr), Err: err}
+		}
+		return storage.URLUpdate{}, &save.RequestError{Response: resp.Error("invalid request"), Err: err}
+	}
+
+	upd := storage.URLUpdate{
+		Clicks: req.MaxClicks,
+		Tags:   req.Tags,
+	}
+
+	if req.URL != nil {
+		if err := url_validation.IsValidURL(*req.URL); err != nil {
+			return storage.URLUpdate{}, &save.RequestError{Response: resp.Error("url is not valid"), Err: err}
+		}
+		if err := urlValidator.Check(*req.URL); err != nil {
+			return storage.URLUpdate{}, &save.RequestError{Response: resp.Error("url is not allowed"), Err: err}
+		}
+		if err := checkDomain(*req.URL, p); err != nil {
+			return storage.URLUpdate{}, err
+		}
+
+		normalized, err := urlValidator.Normalize(*req.URL)
+		if err != nil {
+			return storage.URLUpdate{}, &save.RequestError{Response: resp.Error("url is not valid"), Err: err}
+		}
+		upd.URL = req.URL
+		upd.NormalizedURL = &normalized
+	}
+
+	if req.MaxClicks != nil {
+		if err := checkClicks(*req.MaxClicks, p); err != nil {
+			return storage.URLUpdate{}, err
+		}
+	}
+
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			return storage.URLUpdate{}, &save.RequestError{Response: resp.Error("expires_at must be in the future"), Err: save.ErrExpiresInPast}
+		}
+		if err := checkExpiry(*req.ExpiresAt, p, now); err != nil {
+			return storage.URLUpdate{}, err
+		}
+		upd.ExpiresAt = req.ExpiresAt
+	}
+
+	return upd, nil
+}
+
+func checkDomain(u string, p storage.OrgPolicy) error {
+	if err := url_validation.CheckDomain(u, p.AllowedDomains); err != nil {
+		return &save.RequestError{
+			Response: resp.FieldErrors("url is not allowed", []resp.FieldError{{
+				Field:   "url",
+				Rule:    url_validation.RuleDomain,
+				Message: "url domain is not allowed by the org",
+			}}),
+			Err: err,
+		}
+	}
+	return nil
+}
+
+func checkClicks(clicks int, p storage.OrgPolicy) error {
+	if p.ClickBudget > 0 && clicks > p.ClickBudget {
+		return &save.RequestError{
+			Response: resp.Error("max_clicks must not exceed " + strconv.Itoa(p.ClickBudget)),
+			Err:      ErrClickBudget,
+		}
+	}
+	return nil
+}
+
+func checkExpiry(expiresAt time.Time, p storage.OrgPolicy, now time.Time) error {
+	if p.LinkTTL > 0 && expiresAt.After(now.Add(p.LinkTTL)) {
+		return &save.RequestError{
+			Response: resp.Error("expires_at must be within " + p.LinkTTL.String()),
+			Err:      ErrLinkTTL,
+		}
+	}
+	return nil
+}
+
+func valueCounts(counts []storage.Count) []ValueCount {
+	views := make([]ValueCount, 0, len(counts))
+	for _, c := range counts {
+		views = append(views, ValueCount{Value: c.Value, Redirects: c.Clicks})
+	}
+	return views
+}
+
+func linkOf(u storage.URL) Link {
+	link := Link{
+		Alias:     u.Alias,
+		URL:       u.URL,
+		Clicks:    u.Clicks,
+		Redirects: u.ClickCount,
+		Tags:      u.Tags,
+	}
+	if !u.ExpiresAt.IsZero() {
+		link.ExpiresAt = &u.ExpiresAt
+	}
+	return link
+}
@@ -0,0 +1,258 @@
+package members
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authorization"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+type MemberLister interface {
+	ListOrgMembers(ctx context.Context, orgID int64) ([]storage.OrgMember, error)
+}
+
+type MemberManager interface {
+	GetUser(ctx context.Context, username string) (storage.User, error)
+	GetOrgMember(ctx context.Context, orgName string, userID int64) (storage.Org, storage.OrgMember, error)
+	SetOrgMemberRole(ctx context.Context, orgID, userID int64, role string) error
+	RemoveOrgMember(ctx context.Context, orgID, userID int64) error
+}
+
+type Member struct {
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Members []Member `json:"members"`
+}
+
+type UpdateRequest struct {
+	Role string `json:"role"`
+}
+
+// New lists the members of the org.
+func New(log *slog.Logger, lister MemberLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.members.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, _, _ := authorization.OrgFromContext(r.Context())
+
+		members, err := lister.ListOrgMembers(r.Context(), org.ID)
+		if err != nil {
+			log.Error("failed to list members", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to list members"))
+			return
+		}
+
+		views := make([]Member, 0, len(members))
+		for _, m := range members {
+			views = append(views, Member{
+				Username: m.Username,
+				Email:    m.Email,
+				Role:     m.Role,
+				JoinedAt: m.CreatedAt,
+			})
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response: resp.OK(),
+			Members:  views,
+		})
+	}
+}
+
+// NewUpdate changes the org role of a member. Only owners appoint owners
+// or change the role of one; the last owner can not step down.
+func NewUpdate(log *slog.Logger, manager MemberManager, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.members.NewUpdate"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, actor, _ := authorization.OrgFromContext(r.Context())
+
+		var req UpdateRequest
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if !storage.ValidOrgRole(req.Role) {
+			log.Info("invalid org role", slog.String("role", req.Role))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("role must be owner, admin or member"))
+			return
+		}
+
+		target, ok := findMember(w, r, log, manager, org)
+		if !ok {
+			return
+		}
+
+		if (req.Role == storage.OrgRoleOwner || target.Role == storage.OrgRoleOwner) && actor.Role != storage.OrgRoleOwner {
+			log.Warn("only owners manage owners", slog.String("username", target.Username))
+			w.WriteHeader(http.StatusForbidden)
+			render.JSON(w, r, resp.Error("only owners can appoint or change owners"))
+			return
+		}
+
+		if req.Role == target.Role {
+			render.JSON(w, r, resp.OK())
+			return
+		}
+
+		err := manager.SetOrgMemberRole(r.Context(), org.ID, target.UserID, req.Role)
+		if errors.Is(err, storage.ErrLastOwner) {
+			log.Info("last owner can not step down", slog.String("username", target.Username))
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("the org must keep at least one owner"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to set org role", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to update member"))
+			return
+		}
+
+		log.Info("org role changed", slog.String("org", org.Name), slog.String("username", target.Username), slog.String("role", req.Role))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionOrgMemberRoleChange,
+			ActorID: actor.UserID,
+			Actor:   actor.Username,
+			Target:  org.Name + "/" + target.Username,
+			Details: audit.Change{Old: target.Role, New: req.Role},
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// NewRemove takes a member out of the org. Every member may leave, admins
+// remove members and admins, owners anyone; the last owner has to stay.
+func NewRemove(log *slog.Logger, manager MemberManager, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.members.NewRemove"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, actor, _ := authorization.OrgFromContext(r.Context())
+
+		target, ok := findMember(w, r, log, manager, org)
+		if !ok {
+			return
+		}
+
+		if target.UserID != actor.UserID && !mayRemove(actor.Role, target.Role) {
+			log.Warn("insufficient org role to remove member",
+				slog.String("username", target.Username),
+				slog.String("role", actor.Role),
+			)
+			w.WriteHeader(http.StatusForbidden)
+			render.JSON(w, r, resp.Error("Forbidden"))
+			return
+		}
+
+		err := manager.RemoveOrgMember(r.Context(), org.ID, target.UserID)
+		if errors.Is(err, storage.ErrLastOwner) {
+			log.Info("last owner can not leave", slog.String("username", target.Username))
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("the org must keep at least one owner"))
+			return
+		}
+		if errors.Is(err, storage.ErrNotOrgMember) {
+			log.Info("member already left", slog.String("username", target.Username))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("member not found"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to remove member", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to remove member"))
+			return
+		}
+
+		log.Info("member removed", slog.String("org", org.Name), slog.String("username", target.Username))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionOrgMemberRemove,
+			ActorID: actor.UserID,
+			Actor:   actor.Username,
+			Target:  org.Name + "/" + target.Username,
+			Details: audit.Change{Old: target.Role},
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// findMember loads the member named by the {username} URL parameter and
+// writes the error response if there is none.
+func findMember(w http.ResponseWriter, r *http.Request, log *slog.Logger, manager MemberManager, org storage.Org) (storage.OrgMember, bool) {
+	username := chi.URLParam(r, "username")
+
+	user, err := manager.GetUser(r.Context(), username)
+	if err == nil {
+		var member storage.OrgMember
+		_, member, err = manager.GetOrgMember(r.Context(), org.Name, user.ID)
+		if err == nil {
+			member.Username = user.Username
+			return member, true
+		}
+	}
+
+	if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrNotOrgMember) {
+		log.Info("member not found", slog.String("username", username))
+		w.WriteHeader(http.StatusNotFound)
+		render.JSON(w, r, resp.Error("member not found"))
+		return storage.OrgMember{}, false
+	}
+
+	log.Error("failed to get member", sl.Err(err))
+	w.WriteHeader(http.StatusInternalServerError)
+	render.JSON(w, r, resp.Error("failed to get member"))
+	return storage.OrgMember{}, false
+}
+
+func mayRemove(actorRole, targetRole string) bool {
+	switch actorRole {
+	case storage.OrgRoleOwner:
+		return true
+	case storage.OrgRoleAdmin:
+		return targetRole != storage.OrgRoleOwner
+	}
+	return false
+}
@@ -0,0 +1,340 @@
+package orgs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	"url-shorter/internal/http-server/middleware/authorization"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+// maxDomains caps the allowed_domains of a policy.
+const maxDomains = 100
+
+// nameRe keeps org names usable as a path segment.
+var nameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{1,63}$`)
+
+type OrgCreator interface {
+	CreateOrg(ctx context.Context, name string, ownerID int64) (storage.Org, error)
+}
+
+type OrgLister interface {
+	ListUserOrgs(ctx context.Context, userID int64) ([]storage.OrgMembership, error)
+}
+
+type PolicyUpdater interface {
+	UpdateOrgPolicy(ctx context.Context, orgID int64, policy storage.OrgPolicy) error
+}
+
+type OrgDeleter interface {
+	DeleteOrg(ctx context.Context, orgID int64) error
+}
+
+// Policy is how storage.OrgPolicy appears in the API. LinkTTL is a Go
+// duration like "720h", "0s" does not limit.
+type Policy struct {
+	ClickBudget    int      `json:"click_budget"`
+	LinkTTL        string   `json:"link_ttl"`
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+type Org struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	Policy    Policy    `json:"policy"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateRequest struct {
+	Name string `json:"name"`
+}
+
+// UpdateRequest holds the policy fields to change; omitted ones are left
+// as is.
+type UpdateRequest struct {
+	ClickBudget    *int      `json:"click_budget,omitempty"`
+	LinkTTL        *string   `json:"link_ttl,omitempty"`
+	AllowedDomains *[]string `json:"allowed_domains,omitempty"`
+}
+
+type Response struct {
+	resp.Response
+	Org Org `json:"org"`
+}
+
+type ListResponse struct {
+	resp.Response
+	Orgs []Org `json:"orgs"`
+}
+
+// New creates an org with the authenticated user as its owner.
+func New(log *slog.Logger, creator OrgCreator, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		var req CreateRequest
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if !nameRe.MatchString(req.Name) {
+			log.Info("invalid org name", slog.String("name", req.Name))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("name must be 2 to 64 letters, digits, '-' or '_'"))
+			return
+		}
+
+		org, err := creator.CreateOrg(r.Context(), req.Name, user.ID)
+		if errors.Is(err, storage.ErrOrgExists) {
+			log.Info("org already exists", slog.String("name", req.Name))
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("org already exists"))
+			return
+		}
+		if err != nil {
+			log.Error("failed to create org", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to create org"))
+			return
+		}
+
+		log.Info("org created", slog.String("name", org.Name), slog.Int64("id", org.ID))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionOrgCreate,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  org.Name,
+			Details: map[string]int64{"org_id": org.ID},
+		})
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Org:      orgOf(org, storage.OrgRoleOwner),
+		})
+	}
+}
+
+// NewList lists the orgs of the authenticated user.
+func NewList(log *slog.Logger, lister OrgLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.NewList"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		memberships, err := lister.ListUserOrgs(r.Context(), user.ID)
+		if err != nil {
+			log.Error("failed to list orgs", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to list orgs"))
+			return
+		}
+
+		orgs := make([]Org, 0, len(memberships))
+		for _, m := range memberships {
+			orgs = append(orgs, orgOf(m.Org, m.Role))
+		}
+
+		render.JSON(w, r, ListResponse{
+			Response: resp.OK(),
+			Orgs:     orgs,
+		})
+	}
+}
+
+// NewGet returns the org loaded by authorization.RequireOrgRole.
+func NewGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		org, member, _ := authorization.OrgFromContext(r.Context())
+
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Org:      orgOf(org, member.Role),
+		})
+	}
+}
+
+// NewUpdate changes the default policy of the org. Existing links are
+// left as they are, the policy applies to links created or edited later.
+func NewUpdate(log *slog.Logger, updater PolicyUpdater, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.NewUpdate"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, member, _ := authorization.OrgFromContext(r.Context())
+
+		var req UpdateRequest
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		policy, err := applyUpdate(org.Policy, req)
+		if err != nil {
+			log.Info("invalid policy", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		if err := updater.UpdateOrgPolicy(r.Context(), org.ID, policy); err != nil {
+			log.Error("failed to update org policy", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to update org"))
+			return
+		}
+
+		log.Info("org policy updated", slog.String("org", org.Name))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionOrgUpdate,
+			ActorID: member.UserID,
+			Actor:   member.Username,
+			Target:  org.Name,
+			Details: audit.Change{Old: policyOf(org.Policy), New: policyOf(policy)},
+		})
+
+		org.Policy = policy
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Org:      orgOf(org, member.Role),
+		})
+	}
+}
+
+// NewDelete deletes the org and every link it owns.
+func NewDelete(log *slog.Logger, deleter OrgDeleter, auditor audit.Auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.orgs.NewDelete"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		org, member, _ := authorization.OrgFromContext(r.Context())
+
+		if err := deleter.DeleteOrg(r.Context(), org.ID); err != nil {
+			log.Error("failed to delete org", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to delete org"))
+			return
+		}
+
+		log.Info("org deleted", slog.String("org", org.Name))
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionOrgDelete,
+			ActorID: member.UserID,
+			Actor:   member.Username,
+			Target:  org.Name,
+			Details: map[string]int64{"org_id": org.ID},
+		})
+
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+var (
+	errClickBudget = errors.New("click_budget must not be negative")
+	errLinkTTL     = errors.New("link_ttl must be a non-negative duration like 720h")
+	errDomains     = errors.New("allowed_domains must hold at most 100 valid domain patterns")
+)
+
+func applyUpdate(policy storage.OrgPolicy, req UpdateRequest) (storage.OrgPolicy, error) {
+	if req.ClickBudget != nil {
+		if *req.ClickBudget < 0 {
+			return storage.OrgPolicy{}, errClickBudget
+		}
+		policy.ClickBudget = *req.ClickBudget
+	}
+
+	if req.LinkTTL != nil {
+		ttl, err := time.ParseDuration(*req.LinkTTL)
+		if err != nil || ttl < 0 {
+			return storage.OrgPolicy{}, errLinkTTL
+		}
+		policy.LinkTTL = ttl.Truncate(time.Second)
+	}
+
+	if req.AllowedDomains != nil {
+		if len(*req.AllowedDomains) > maxDomains {
+			return storage.OrgPolicy{}, errDomains
+		}
+
+		domains := make([]string, 0, len(*req.AllowedDomains))
+		for _, d := range *req.AllowedDomains {
+			d = strings.ToLower(strings.TrimSpace(d))
+			// Patterns are stored comma separated.
+			if _, err := path.Match(d, ""); d == "" || err != nil || strings.Contains(d, ",") {
+				return storage.OrgPolicy{}, errDomains
+			}
+			domains = append(domains, d)
+		}
+		policy.AllowedDomains = domains
+	}
+
+	return policy, nil
+}
+
+func policyOf(p storage.OrgPolicy) Policy {
+	domains := p.AllowedDomains
+	if domains == nil {
+		domains = []string{}
+	}
+
+	return Policy{
+		ClickBudget:    p.ClickBudget,
+		LinkTTL:        p.LinkTTL.String(),
+		AllowedDomains: domains,
+	}
+}
+
+func orgOf(org storage.Org, role string) Org {
+	return Org{
+		ID:        org.ID,
+		Name:      org.Name,
+		Role:      role,
+		Policy:    policyOf(org.Policy),
+		CreatedAt: org.CreatedAt,
+	}
+}
@@ -1,6 +1,7 @@
 package redirect
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
@@ -11,20 +12,27 @@ import (
 
 	resp "url-shorter/internal/lib/api/response"
 	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
 	"url-shorter/internal/storage"
 )
 
 type URLGetter interface {
-	GetURL(alias string) (string, error)
+	GetURL(ctx context.Context, alias string) (string, error)
 }
 
-func New(log *slog.Logger, urlGetter URLGetter) http.HandlerFunc {
+// ClickRecorder adds the redirect to the click history of the link.
+type ClickRecorder interface {
+	RecordClick(r *http.Request, alias string)
+}
+
+func New(log *slog.Logger, urlGetter URLGetter, clicks ClickRecorder) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         const fn = "handlers.redirect.New"
 
         log := log.With(
             slog.String("fn", fn),
             slog.String("request_id", middleware.GetReqID(r.Context())),
+            sl.Trace(r.Context()),
             slog.String("method", r.Method),
             slog.String("url", r.URL.String()),
         )
@@ -38,19 +46,24 @@ func New(log *slog.Logger, urlGetter URLGetter) http.HandlerFunc {
             return
         }
 
-        resURL, err := urlGetter.GetURL(alias)
+        resURL, err := urlGetter.GetURL(r.Context(), alias)
         if errors.Is(err, storage.ErrURLNotFound) {
-            log.Info("url not found", slog.String("alias", alias))
+            log.Info("url not found", slog.String("alias", alias), sl.Err(err))
+            metrics.Redirects.WithLabelValues(missOutcome(err)).Inc()
             render.JSON(w, r, resp.Error("not found"))
             return
         }
 
         if err != nil {
             log.Error("failed to get url", sl.Err(err))
+            metrics.Redirects.WithLabelValues(metrics.RedirectError).Inc()
             render.JSON(w, r, resp.Error("internal error"))
             return
         }
 
+        metrics.Redirects.WithLabelValues(metrics.RedirectHit).Inc()
+        clicks.RecordClick(r, alias)
+
         log.Info("got url", slog.String("url", resURL))
 
         // redirect to found url
@@ -58,3 +71,12 @@ func New(log *slog.Logger, urlGetter URLGetter) http.HandlerFunc {
     }
 }
 
+func missOutcome(err error) string {
+    switch {
+    case errors.Is(err, storage.ErrURLExpired):
+        return metrics.RedirectExpired
+    case errors.Is(err, storage.ErrURLExhausted):
+        return metrics.RedirectExhausted
+    }
+    return metrics.RedirectNotFound
+}
@@ -0,0 +1,127 @@
+package batchdelete
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+type URLDeleter interface {
+	DeleteURLsByAlias(ctx context.Context, userID int64, aliases []string) ([]storage.URL, error)
+}
+
+type Request struct {
+	Aliases []string `json:"aliases"`
+}
+
+type ItemResult struct {
+	resp.Response
+	Alias string `json:"alias"`
+}
+
+type Response struct {
+	resp.Response
+	Deleted int          `json:"deleted"`
+	Failed  int          `json:"failed"`
+	Results []ItemResult `json:"results"`
+}
+
+// New deletes up to maxItems of the caller's links by alias. Aliases that do
+// not exist or belong to someone else are reported as not found. Every
+// deleted link is audited like a single delete.
+func New(log *slog.Logger, urlDeleter URLDeleter, auditor audit.Auditor, maxItems int, maxBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.url.batchdelete.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+		var req Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				log.Info("batch body is too large", sl.Err(err))
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				render.JSON(w, r, resp.Error(fmt.Sprintf("batch can have at most %d bytes", maxBytes)))
+				return
+			}
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if len(req.Aliases) == 0 {
+			log.Info("empty batch")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("aliases must not be empty"))
+			return
+		}
+
+		if len(req.Aliases) > maxItems {
+			log.Info("batch is too large", slog.Int("items", len(req.Aliases)))
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			render.JSON(w, r, resp.Error(fmt.Sprintf("batch can have at most %d items", maxItems)))
+			return
+		}
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		deleted, err := urlDeleter.DeleteURLsByAlias(r.Context(), user.ID, req.Aliases)
+		if err != nil {
+			log.Error("failed to delete batch", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to delete urls"))
+			return
+		}
+
+		response := Response{
+			Response: resp.OK(),
+			Results:  make([]ItemResult, len(req.Aliases)),
+		}
+		for i, alias := range req.Aliases {
+			response.Results[i].Alias = alias
+			if deleted[i].ID != 0 {
+				response.Results[i].Response = resp.OK()
+				response.Deleted++
+				auditor.Record(r, audit.Event{
+					Action:  audit.ActionLinkDelete,
+					ActorID: user.ID,
+					Actor:   user.Username,
+					Target:  alias,
+					Details: audit.Change{Old: audit.LinkOf(deleted[i])},
+				})
+			} else {
+				response.Results[i].Response = resp.Error("not found")
+				response.Failed++
+			}
+		}
+
+		log.Info("batch deleted",
+			slog.Int("deleted", response.Deleted),
+			slog.Int("failed", response.Failed),
+		)
+
+		if response.Failed > 0 {
+			w.WriteHeader(http.StatusMultiStatus)
+		}
+		render.JSON(w, r, response)
+	}
+}
@@ -0,0 +1,228 @@
+package batchsave
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/handlers/url/save"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/storage"
+)
+
+type URLSaver interface {
+	SaveURLs(ctx context.Context, urls []storage.URL) ([]storage.SaveResult, error)
+	GetAliasByNormalizedURL(ctx context.Context, userID int64, normalizedURL string) (string, error)
+}
+
+type Request struct {
+	Items []save.Request `json:"items"`
+}
+
+type ItemResult struct {
+	resp.Response
+	Index    int    `json:"index"`
+	Alias    string `json:"alias,omitempty"`
+	Existing bool   `json:"existing,omitempty"`
+}
+
+type Response struct {
+	resp.Response
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []ItemResult `json:"results"`
+}
+
+// New saves up to maxItems links, sent in at most maxBytes, in one
+// transaction. Every item goes through the same checks as save.New and
+// every created link is audited like a single save; the response holds one
+// result per item and is 207 Multi-Status when some of them failed. Items
+// that want dedup also reuse a link created earlier in the same batch.
+func New(
+	log *slog.Logger,
+	urlSaver URLSaver,
+	aliasValidator save.AliasValidator,
+	urlValidator save.URLValidator,
+	auditor audit.Auditor,
+	maxItems int,
+	maxBytes int64,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.url.batchsave.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+		var req Request
+
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				log.Info("batch body is too large", sl.Err(err))
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				render.JSON(w, r, resp.Error(fmt.Sprintf("batch can have at most %d bytes", maxBytes)))
+				return
+			}
+			log.Error("failed to decode request body", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+			return
+		}
+
+		if len(req.Items) == 0 {
+			log.Info("empty batch")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("items must not be empty"))
+			return
+		}
+
+		if len(req.Items) > maxItems {
+			log.Info("batch is too large", slog.Int("items", len(req.Items)))
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			render.JSON(w, r, resp.Error(fmt.Sprintf("batch can have at most %d items", maxItems)))
+			return
+		}
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		results := make([]ItemResult, len(req.Items))
+		var (
+			toSave  []storage.URL
+			indexes []int
+			// byURL maps a normalized URL to the first item that creates or
+			// found a link for it, sameAs an item deduplicated against it.
+			byURL  = make(map[string]int)
+			sameAs = make(map[int]int)
+		)
+
+		for i, item := range req.Items {
+			results[i].Index = i
+
+			u, err := save.Prepare(item, aliasValidator, urlValidator)
+			if err != nil {
+				var reqErr *save.RequestError
+				if errors.As(err, &reqErr) {
+					results[i].Response = reqErr.Response
+				} else {
+					log.Error("failed to prepare url", slog.Int("index", i), sl.Err(err))
+					results[i].Response = resp.Error("failed to add url")
+				}
+				continue
+			}
+
+			if save.WantsDedup(item, user) {
+				if first, ok := byURL[u.NormalizedURL]; ok {
+					sameAs[i] = first
+					continue
+				}
+
+				existing, err := urlSaver.GetAliasByNormalizedURL(r.Context(), user.ID, u.NormalizedURL)
+				if err == nil {
+					results[i].Response = resp.OK()
+					results[i].Alias = existing
+					results[i].Existing = true
+					byURL[u.NormalizedURL] = i
+					continue
+				}
+				if !errors.Is(err, storage.ErrURLNotFound) {
+					log.Error("failed to look up existing url", slog.Int("index", i), sl.Err(err))
+					results[i].Response = resp.Error("failed to add url")
+					continue
+				}
+			}
+
+			u.UserID = user.ID
+			toSave = append(toSave, u)
+			indexes = append(indexes, i)
+			if _, ok := byURL[u.NormalizedURL]; !ok {
+				byURL[u.NormalizedURL] = i
+			}
+		}
+
+		if len(toSave) > 0 {
+			saved, err := urlSaver.SaveURLs(r.Context(), toSave)
+			if err != nil {
+				log.Error("failed to save batch", sl.Err(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("failed to add urls"))
+				return
+			}
+
+			for j, res := range saved {
+				i := indexes[j]
+				switch {
+				case errors.Is(res.Err, storage.ErrURLExists):
+					results[i].Response = resp.Error("alias already exists")
+				case res.Err != nil:
+					log.Error("failed to add url", slog.Int("index", i), sl.Err(res.Err))
+					results[i].Response = resp.Error("failed to add url")
+				default:
+					results[i].Response = resp.OK()
+					results[i].Alias = toSave[j].Alias
+
+					u := toSave[j]
+					u.ID = res.ID
+					if u.Clicks == 0 {
+						u.Clicks = storage.DefaultClicks
+					}
+					auditor.Record(r, audit.Event{
+						Action:  audit.ActionLinkCreate,
+						ActorID: user.ID,
+						Actor:   user.Username,
+						Target:  u.Alias,
+						Details: audit.Change{New: audit.LinkOf(u)},
+					})
+				}
+			}
+		}
+
+		// A duplicate shares the outcome of the item it was merged into.
+		for i, first := range sameAs {
+			results[i].Response = results[first].Response
+			if results[i].Status == resp.StatusOK {
+				results[i].Alias = results[first].Alias
+				results[i].Existing = true
+			}
+		}
+
+		response := Response{
+			Response: resp.OK(),
+			Results:  results,
+		}
+		for _, res := range results {
+			if res.Status == resp.StatusOK {
+				if !res.Existing {
+					response.Created++
+				}
+			} else {
+				response.Failed++
+			}
+		}
+
+		metrics.LinksCreated.WithLabelValues(metrics.SourceBatch).Add(float64(response.Created))
+
+		log.Info("batch processed",
+			slog.Int("created", response.Created),
+			slog.Int("failed", response.Failed),
+		)
+
+		if response.Failed > 0 {
+			w.WriteHeader(http.StatusMultiStatus)
+		}
+		render.JSON(w, r, response)
+	}
+}
@@ -0,0 +1,108 @@
+package batchsave
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	"url-shorter/internal/storage"
+)
+
+type stubSaver struct {
+	saved []storage.URL
+}
+
+func (s *stubSaver) SaveURLs(_ context.Context, urls []storage.URL) ([]storage.SaveResult, error) {
+	results := make([]storage.SaveResult, len(urls))
+	for i := range urls {
+		s.saved = append(s.saved, urls[i])
+		results[i].ID = int64(len(s.saved))
+	}
+	return results, nil
+}
+
+func (s *stubSaver) GetAliasByNormalizedURL(context.Context, int64, string) (string, error) {
+	return "", storage.ErrURLNotFound
+}
+
+type stubValidator struct{}
+
+func (stubValidator) Validate(alias string) (string, error) { return alias, nil }
+func (stubValidator) Check(string) error                    { return nil }
+func (stubValidator) Normalize(u string) (string, error)    { return strings.ToLower(u), nil }
+
+type stubAuth struct{}
+
+func (stubAuth) ValidateUser(context.Context, string, string) (storage.User, error) {
+	return storage.User{ID: 1, Username: "amy", Role: storage.RoleMember}, nil
+}
+
+func (stubAuth) CheckSession(context.Context, string) (storage.User, error) {
+	return storage.User{}, errors.New("no sessions")
+}
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(*http.Request, audit.Event) {}
+
+func serve(saver *stubSaver, maxBytes int64, body string) *httptest.ResponseRecorder {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := authentication.BasicAuthMiddleware(log, stubAuth{}, stubAuth{}, nopAuditor{})(
+		New(log, saver, stubValidator{}, stubValidator{}, nopAuditor{}, 10, maxBytes),
+	)
+
+	r := httptest.NewRequest(http.MethodPost, "/url/batch", strings.NewReader(body))
+	r.SetBasicAuth("amy", "secret123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestDedupWithinBatch(t *testing.T) {
+	saver := &stubSaver{}
+	w := serve(saver, 1<<20, `{"items":[
+		{"url":"https://example.com/a","dedup":true},
+		{"url":"https://EXAMPLE.com/a","dedup":true},
+		{"url":"https://example.com/b","dedup":true}
+	]}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var got Response
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saver.saved) != 2 {
+		t.Errorf("saved %d links; want 2", len(saver.saved))
+	}
+	if got.Created != 2 {
+		t.Errorf("created = %d; want 2", got.Created)
+	}
+	if dup := got.Results[1]; dup.Alias != got.Results[0].Alias || !dup.Existing {
+		t.Errorf("duplicate result = %+v; want the alias %q of the first item marked existing", dup, got.Results[0].Alias)
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	saver := &stubSaver{}
+	w := serve(saver, 64, `{"items":[{"url":"https://example.com/`+strings.Repeat("a", 100)+`"}]}`)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if len(saver.saved) != 0 {
+		t.Errorf("saved %d links from an oversized body", len(saver.saved))
+	}
+}
@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/linkfile"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/storage"
+)
+
+// flushEvery is how many rows are written between flushes to the client.
+const flushEvery = 100
+
+type URLLister interface {
+	ListUserURLs(ctx context.Context, userID int64, withClickCount bool, yield func(storage.URL) error) error
+}
+
+// New streams the caller's links as CSV (default) or NDJSON. With
+// clicks=true every row also gets the total number of recorded clicks.
+func New(log *slog.Logger, urlLister URLLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.url.exporter.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		formatName := r.URL.Query().Get("format")
+		if formatName == "" {
+			formatName = string(linkfile.FormatCSV)
+		}
+
+		format, err := linkfile.ParseFormat(formatName, "")
+		if err != nil {
+			log.Info("unknown export format", slog.String("format", formatName))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("format must be csv or ndjson"))
+			return
+		}
+
+		withClicks, _ := strconv.ParseBool(r.URL.Query().Get("clicks"))
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", `attachment; filename="links.`+string(format)+`"`)
+
+		writer, err := linkfile.NewWriter(format, w, withClicks)
+		if err != nil {
+			log.Error("failed to start export", sl.Err(err))
+			return
+		}
+
+		flusher, _ := w.(http.Flusher)
+		rows := 0
+
+		err = urlLister.ListUserURLs(r.Context(), user.ID, withClicks, func(u storage.URL) error {
+			rec := linkfile.Record{
+				Alias:      u.Alias,
+				URL:        u.URL,
+				ClicksLeft: &u.Clicks,
+				Tags:       u.Tags,
+			}
+			if !u.ExpiresAt.IsZero() {
+				rec.ExpiresAt = &u.ExpiresAt
+			}
+			if withClicks {
+				rec.Clicks = &u.ClickCount
+			}
+
+			if err := writer.Write(rec); err != nil {
+				return err
+			}
+
+			rows++
+			if rows%flushEvery == 0 {
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+
+			return nil
+		})
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			// Headers are already sent, the client sees a truncated file.
+			log.Error("export interrupted", slog.Int("rows", rows), sl.Err(err))
+			return
+		}
+
+		log.Info("export finished", slog.Int("rows", rows))
+	}
+}
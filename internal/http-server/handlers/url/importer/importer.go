@@ -0,0 +1,316 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/handlers/url/save"
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/linkfile"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/storage"
+)
+
+const chunkSize = 200
+
+type URLImporter interface {
+	SaveURLs(ctx context.Context, urls []storage.URL) ([]storage.SaveResult, error)
+	IsAliasExists(ctx context.Context, alias string) (bool, error)
+}
+
+type RowResult struct {
+	Line   int               `json:"line"`
+	Alias  string            `json:"alias,omitempty"`
+	Error  string            `json:"error"`
+	Errors []resp.FieldError `json:"errors,omitempty"`
+}
+
+type Response struct {
+	resp.Response
+	DryRun    bool        `json:"dry_run"`
+	Total     int         `json:"total"`
+	Imported  int         `json:"imported"`
+	Conflicts []RowResult `json:"conflicts"`
+	Invalid   []RowResult `json:"invalid"`
+}
+
+type pending struct {
+	line int
+	url  storage.URL
+}
+
+// New imports links from a CSV or NDJSON body, or from the "file" part of a
+// multipart form. The format comes from the "format" query parameter or the
+// content type. Rows are validated like save.New and saved in chunks, every
+// imported link is audited like a single save; with dry_run=true nothing
+// is saved and only the report is built.
+func New(
+	log *slog.Logger,
+	urlImporter URLImporter,
+	aliasValidator save.AliasValidator,
+	urlValidator save.URLValidator,
+	auditor audit.Auditor,
+	maxRows int,
+	maxBytes int64,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const fn = "handlers.url.importer.New"
+
+		log := log.With(
+			slog.String("fn", fn),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
+		)
+
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+		body, format, err := openFile(w, r, maxBytes)
+		if err != nil {
+			log.Info("failed to open import file", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("expected a csv or ndjson file"))
+			return
+		}
+
+		reader, err := linkfile.NewReader(format, body)
+		if err != nil {
+			log.Info("failed to read import file", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		user, _ := authentication.UserFromContext(r.Context())
+
+		report := Response{
+			DryRun:    dryRun,
+			Conflicts: []RowResult{},
+			Invalid:   []RowResult{},
+		}
+		seen := make(map[string]int)
+		var chunk []pending
+
+		flush := func() error {
+			if len(chunk) == 0 {
+				return nil
+			}
+
+			urls := make([]storage.URL, len(chunk))
+			for i, p := range chunk {
+				urls[i] = p.url
+			}
+
+			results, err := urlImporter.SaveURLs(r.Context(), urls)
+			if err != nil {
+				return err
+			}
+
+			for i, res := range results {
+				switch {
+				case errors.Is(res.Err, storage.ErrURLExists):
+					report.Conflicts = append(report.Conflicts, RowResult{
+						Line:  chunk[i].line,
+						Alias: chunk[i].url.Alias,
+						Error: "alias already exists",
+					})
+				case res.Err != nil:
+					log.Error("failed to import row", slog.Int("line", chunk[i].line), sl.Err(res.Err))
+					report.Invalid = append(report.Invalid, RowResult{
+						Line:  chunk[i].line,
+						Alias: chunk[i].url.Alias,
+						Error: "failed to add url",
+					})
+				default:
+					report.Imported++
+					metrics.LinksCreated.WithLabelValues(metrics.SourceImport).Inc()
+
+					u := chunk[i].url
+					u.ID = res.ID
+					switch u.Clicks {
+					case 0:
+						u.Clicks = storage.DefaultClicks
+					case storage.NoClicksLeft:
+						u.Clicks = 0
+					}
+					auditor.Record(r, audit.Event{
+						Action:  audit.ActionLinkCreate,
+						ActorID: user.ID,
+						Actor:   user.Username,
+						Target:  u.Alias,
+						Details: audit.Change{New: audit.LinkOf(u)},
+					})
+				}
+			}
+
+			chunk = chunk[:0]
+			return nil
+		}
+
+		for {
+			rec, line, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			var rowErr *linkfile.RowError
+			if errors.As(err, &rowErr) {
+				report.Total++
+				report.Invalid = append(report.Invalid, RowResult{Line: line, Error: rowErr.Err.Error()})
+				continue
+			}
+			if err != nil {
+				log.Info("failed to read import file", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("failed to read file"))
+				return
+			}
+
+			report.Total++
+			if report.Total > maxRows {
+				log.Info("import file is too large")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				render.JSON(w, r, resp.Error(fmt.Sprintf("file can have at most %d rows", maxRows)))
+				return
+			}
+
+			// Clicks left and expiry are restored as exported: used up
+			// and expired links come back dead, not with fresh defaults.
+			u, err := save.Prepare(save.Request{
+				URL:   rec.URL,
+				Alias: rec.Alias,
+				Tags:  rec.Tags,
+			}, aliasValidator, urlValidator)
+			if err != nil {
+				var reqErr *save.RequestError
+				if !errors.As(err, &reqErr) {
+					log.Error("failed to prepare row", slog.Int("line", line), sl.Err(err))
+					reqErr = &save.RequestError{Response: resp.Error("failed to add url")}
+				}
+				report.Invalid = append(report.Invalid, RowResult{
+					Line:   line,
+					Alias:  rec.Alias,
+					Error:  reqErr.Response.Error,
+					Errors: reqErr.Response.Errors,
+				})
+				continue
+			}
+			u.UserID = user.ID
+			if rec.ClicksLeft != nil {
+				u.Clicks = *rec.ClicksLeft
+				if u.Clicks == 0 {
+					u.Clicks = storage.NoClicksLeft
+				}
+			}
+			if rec.ExpiresAt != nil {
+				u.ExpiresAt = rec.ExpiresAt.UTC()
+			}
+
+			if firstLine, ok := seen[u.Alias]; ok {
+				report.Conflicts = append(report.Conflicts, RowResult{
+					Line:  line,
+					Alias: u.Alias,
+					Error: fmt.Sprintf("alias duplicates line %d", firstLine),
+				})
+				continue
+			}
+			seen[u.Alias] = line
+
+			if dryRun {
+				exists, err := urlImporter.IsAliasExists(r.Context(), u.Alias)
+				if err != nil {
+					log.Error("failed to check alias uniqueness", sl.Err(err))
+					w.WriteHeader(http.StatusInternalServerError)
+					render.JSON(w, r, resp.Error("failed to check alias uniqueness"))
+					return
+				}
+				if exists {
+					report.Conflicts = append(report.Conflicts, RowResult{
+						Line:  line,
+						Alias: u.Alias,
+						Error: "alias already exists",
+					})
+					continue
+				}
+				report.Imported++
+				continue
+			}
+
+			chunk = append(chunk, pending{line: line, url: u})
+			if len(chunk) >= chunkSize {
+				if err := flush(); err != nil {
+					log.Error("failed to save chunk", sl.Err(err))
+					w.WriteHeader(http.StatusInternalServerError)
+					render.JSON(w, r, resp.Error("failed to import urls"))
+					return
+				}
+			}
+		}
+
+		if err := flush(); err != nil {
+			log.Error("failed to save chunk", sl.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("failed to import urls"))
+			return
+		}
+
+		log.Info("import finished",
+			slog.Bool("dry_run", dryRun),
+			slog.Int("total", report.Total),
+			slog.Int("imported", report.Imported),
+			slog.Int("conflicts", len(report.Conflicts)),
+			slog.Int("invalid", len(report.Invalid)),
+		)
+
+		report.Response = resp.OK()
+		render.JSON(w, r, report)
+	}
+}
+
+// openFile returns the uploaded file and its format.
+func openFile(w http.ResponseWriter, r *http.Request, maxBytes int64) (io.Reader, linkfile.Format, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	formatName := r.URL.Query().Get("format")
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		format, err := linkfile.ParseFormat(formatName, r.Header.Get("Content-Type"))
+		return r.Body, format, err
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		if formatName == "" {
+			if ext := filepath.Ext(part.FileName()); ext != "" {
+				formatName = ext[1:]
+			}
+		}
+
+		format, err := linkfile.ParseFormat(formatName, part.Header.Get("Content-Type"))
+		return part, format, err
+	}
+}
@@ -0,0 +1,133 @@
+package save
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"url-shorter/internal/lib/alias_validation"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/random"
+	"url-shorter/internal/lib/url_validation"
+	"url-shorter/internal/storage"
+)
+
+var ErrExpiresInPast = errors.New("expires_at is in the past")
+
+// RequestError is returned by Prepare when the request is rejected before
+// reaching storage. Response is what the client should get.
+type RequestError struct {
+	Response resp.Response
+	Err      error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Prepare runs every check New does before touching storage and returns the
+// link to save. A random alias is generated when req has none.
+func Prepare(req Request, aliasValidator AliasValidator, urlValidator URLValidator) (storage.URL, error) {
+	if err := validator.New().Struct(req); err != nil {
+		var validatorErr validator.ValidationErrors
+		if errors.As(err, &validatorErr) {
+			return storage.URL{}, &RequestError{Response: resp.ValidationError(validatorErr), Err: err}
+		}
+		return storage.URL{}, &RequestError{Response: resp.Error("invalid request"), Err: err}
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return storage.URL{}, &RequestError{Response: resp.Error("expires_at must be in the future"), Err: ErrExpiresInPast}
+		}
+		expiresAt = req.ExpiresAt.UTC()
+	}
+
+	if err := url_validation.IsValidURL(req.URL); err != nil {
+		switch {
+		case errors.Is(err, url_validation.ErrContainsSpace):
+			return storage.URL{}, &RequestError{Response: resp.Error("url contains a space"), Err: err}
+		case errors.Is(err, url_validation.ErrEmpty):
+			return storage.URL{}, &RequestError{Response: resp.Error("url is empty"), Err: err}
+		default:
+			return storage.URL{}, &RequestError{Response: resp.Error("url is not valid"), Err: err}
+		}
+	}
+
+	if err := urlValidator.Check(req.URL); err != nil {
+		return storage.URL{}, &RequestError{Response: urlPolicyError(err), Err: err}
+	}
+
+	normalizedURL, err := urlValidator.Normalize(req.URL)
+	if err != nil {
+		return storage.URL{}, &RequestError{Response: resp.Error("url is not valid"), Err: err}
+	}
+
+	alias := req.Alias
+	if alias == "" {
+		alias = random.NewRandomString(aliasLength)
+	} else if alias, err = aliasValidator.Validate(alias); err != nil {
+		return storage.URL{}, &RequestError{Response: aliasValidationError(err), Err: err}
+	}
+
+	return storage.URL{
+		Alias:         alias,
+		URL:           req.URL,
+		NormalizedURL: normalizedURL,
+		Clicks:        req.MaxClicks,
+		ExpiresAt:     expiresAt,
+		Tags:          req.Tags,
+	}, nil
+}
+
+// WantsDedup reports whether req should reuse an alias the user already has
+// for the same destination. A request naming its alias never does, it
+// would silently get another one.
+func WantsDedup(req Request, user storage.User) bool {
+	if user.ID == 0 || req.Alias != "" {
+		return false
+	}
+
+	if req.Dedup != nil {
+		return *req.Dedup
+	}
+
+	return user.DedupURLs
+}
+
+func aliasValidationError(err error) resp.Response {
+	var validationErr *alias_validation.ValidationError
+	if !errors.As(err, &validationErr) {
+		return resp.Error("alias is not valid")
+	}
+
+	errs := make([]resp.FieldError, 0, len(validationErr.Violations))
+	for _, v := range validationErr.Violations {
+		errs = append(errs, resp.FieldError{
+			Field:   "alias",
+			Rule:    v.Rule,
+			Message: v.Message,
+		})
+	}
+
+	return resp.FieldErrors("alias is not valid", errs)
+}
+
+func urlPolicyError(err error) resp.Response {
+	var violation *url_validation.PolicyViolation
+	if !errors.As(err, &violation) {
+		return resp.Error("url is not valid")
+	}
+
+	return resp.FieldErrors("url is not allowed", []resp.FieldError{{
+		Field:   "url",
+		Rule:    violation.Rule,
+		Message: violation.Error(),
+	}})
+}
@@ -0,0 +1,32 @@
+package save
+
+import (
+	"testing"
+
+	"url-shorter/internal/storage"
+)
+
+func TestWantsDedup(t *testing.T) {
+	yes, no := true, false
+	user := storage.User{ID: 1, DedupURLs: true}
+
+	tests := []struct {
+		name string
+		req  Request
+		user storage.User
+		want bool
+	}{
+		{"account setting", Request{}, user, true},
+		{"account setting off", Request{}, storage.User{ID: 1}, false},
+		{"request opts in", Request{Dedup: &yes}, storage.User{ID: 1}, true},
+		{"request opts out", Request{Dedup: &no}, user, false},
+		{"explicit alias", Request{Alias: "mine", Dedup: &yes}, user, false},
+		{"anonymous", Request{Dedup: &yes}, storage.User{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := WantsDedup(tt.req, tt.user); got != tt.want {
+			t.Errorf("%s: WantsDedup() = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
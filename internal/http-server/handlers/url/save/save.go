@@ -1,47 +1,69 @@
 package save
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
 	resp "url-shorter/internal/lib/api/response"
 	"url-shorter/internal/lib/logger/sl"
-	"url-shorter/internal/lib/random"
-	"url-shorter/internal/lib/url_validation"
+	"url-shorter/internal/lib/metrics"
 	"url-shorter/internal/storage"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
-	"github.com/go-playground/validator/v10"
 )
 
 type URLSaver interface {
-	SaveURL(urlToSave string, alias string) (int64, error) 
-	IsAliasExists(alias string) (bool, error)
+	SaveURL(ctx context.Context, u storage.URL) (int64, error)
+	IsAliasExists(ctx context.Context, alias string) (bool, error)
+	GetAliasByNormalizedURL(ctx context.Context, userID int64, normalizedURL string) (string, error)
+}
+
+type AliasValidator interface {
+	Validate(alias string) (string, error)
+}
+
+type URLValidator interface {
+	Check(u string) error
+	Normalize(u string) (string, error)
 }
 
 type Request struct {
-	URL string `json:"url" validate:"required,url"`
+	URL   string `json:"url" validate:"required,url"`
 	Alias string `json:"alias,omitempty"`
+	// Dedup overrides the account setting: when true an already shortened
+	// destination returns its existing alias instead of a new one.
+	Dedup *bool `json:"dedup,omitempty"`
+	// MaxClicks limits the number of redirects, storage.DefaultClicks if
+	// omitted.
+	MaxClicks int        `json:"max_clicks,omitempty" validate:"omitempty,min=1"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty" validate:"omitempty,max=20,dive,min=1,max=32,excludesall=0x2C"`
 }
 
 type Response struct {
 	resp.Response
-	Alias string `json:"alias,omitempty"`
+	Alias    string `json:"alias,omitempty"`
+	Existing bool   `json:"existing,omitempty"`
 }
 
 const aliasLength = 8
 
-func New(log *slog.Logger, URLSaver URLSaver) http.HandlerFunc {
+func New(log *slog.Logger, URLSaver URLSaver, aliasValidator AliasValidator, urlValidator URLValidator, auditor audit.Auditor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const fn = "handlers.url.save.New"
 
-		log = log.With(
+		log := log.With(
 			slog.String("fn", fn),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.Trace(r.Context()),
 		)
-		
+
 		var req Request
 
 		err := render.DecodeJSON(r.Body, &req)
@@ -49,55 +71,60 @@ func New(log *slog.Logger, URLSaver URLSaver) http.HandlerFunc {
 		if err != nil {
 			log.Error("failed to decode request body", sl.Err(err))
 
-			render.JSON(w,r, resp.Error("failed to decode request"))
+			render.JSON(w, r, resp.Error("failed to decode request"))
 
 			return
 		}
-		
+
 		log.Info("request body decoded", slog.Any("request", req))
 
-		if err := validator.New().Struct(req); err != nil {
-			log.Error("invalid request", sl.Err(err))
-			validatorErr := err.(validator.ValidationErrors)
-			render.JSON(w,r, resp.ValidationError(validatorErr))
+		u, err := Prepare(req, aliasValidator, urlValidator)
+		if err != nil {
+			var reqErr *RequestError
+			if errors.As(err, &reqErr) {
+				log.Info("invalid request", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, reqErr.Response)
+				return
+			}
+			log.Error("failed to prepare url", sl.Err(err))
+			render.JSON(w, r, resp.Error("failed to add url"))
 			return
 		}
 
-		if err := url_validation.IsValidURL(req.URL); err != nil {
-			if errors.Is(err, url_validation.ErrContainsSpace) {
-				log.Info("%w", sl.Err(err))
-				w.WriteHeader(http.StatusBadRequest)
-				render.JSON(w, r, resp.Error("url contains a space"))
-				return
-			} else if errors.Is(err, url_validation.ErrEmpty) {
-				log.Info("%w", sl.Err(err))
-				w.WriteHeader(http.StatusBadRequest)
-				render.JSON(w, r, resp.Error("url is empty"))
+		user, _ := authentication.UserFromContext(r.Context())
+
+		if WantsDedup(req, user) {
+			existing, err := URLSaver.GetAliasByNormalizedURL(r.Context(), user.ID, u.NormalizedURL)
+			if err == nil {
+				log.Info("url already shortened by user", slog.String("alias", existing))
+				render.JSON(w, r, Response{
+					Response: resp.OK(),
+					Alias:    existing,
+					Existing: true,
+				})
 				return
-			} else {
-				log.Info("%w", sl.Err(err))
-				w.WriteHeader(http.StatusBadRequest)
-				render.JSON(w, r, resp.Error("url is not valid"))
+			}
+			if !errors.Is(err, storage.ErrURLNotFound) {
+				log.Error("failed to look up existing url", sl.Err(err))
+				render.JSON(w, r, resp.Error("failed to add url"))
 				return
 			}
 		}
-		
-		alias := req.Alias
-		if alias == "" {
-			alias = random.NewRandomString(aliasLength)
-		}
 
-		if exists, err := URLSaver.IsAliasExists(alias); err != nil {
+		u.UserID = user.ID
+
+		if exists, err := URLSaver.IsAliasExists(r.Context(), u.Alias); err != nil {
 			log.Error("failed to check alias uniqueness", sl.Err(err))
 			render.JSON(w, r, resp.Error("failed to check alias uniqueness"))
 			return
 		} else if exists {
-			log.Info("alias already exists", slog.String("alias", alias))
+			log.Info("alias already exists", slog.String("alias", u.Alias))
 			render.JSON(w, r, resp.Error("alias already exists"))
 			return
 		}
 
-		id, err := URLSaver.SaveURL(req.URL, alias)
+		id, err := URLSaver.SaveURL(r.Context(), u)
 		if errors.Is(err, storage.ErrURLExists) {
 			log.Info("url already exists", slog.String("url", req.URL))
 			render.JSON(w, r, resp.Error("url already exists"))
@@ -107,14 +134,27 @@ func New(log *slog.Logger, URLSaver URLSaver) http.HandlerFunc {
 		if err != nil {
 			log.Error("failed to add url", sl.Err(err))
 			render.JSON(w, r, resp.Error("failed to add url"))
-			return			
+			return
 		}
 
 		log.Info("url added", slog.Int64("id", id))
+		metrics.LinksCreated.WithLabelValues(metrics.SourceSingle).Inc()
+
+		u.ID = id
+		if u.Clicks == 0 {
+			u.Clicks = storage.DefaultClicks
+		}
+		auditor.Record(r, audit.Event{
+			Action:  audit.ActionLinkCreate,
+			ActorID: user.ID,
+			Actor:   user.Username,
+			Target:  u.Alias,
+			Details: audit.Change{New: audit.LinkOf(u)},
+		})
 
 		render.JSON(w, r, Response{
 			Response: resp.OK(),
-			Alias: alias,
+			Alias:    u.Alias,
 		})
 	}
-}
\ No newline at end of file
+}
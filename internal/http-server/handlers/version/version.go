@@ -0,0 +1,15 @@
+package version
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/lib/buildinfo"
+)
+
+func New() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, buildinfo.Get())
+	}
+}
@@ -2,13 +2,19 @@ package authentication
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 
+	"url-shorter/internal/audit"
 	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/storage"
 )
 
 type Response struct {
@@ -16,7 +22,12 @@ type Response struct {
 }
 
 type UserAuth interface {
-	ValidateUser(username, password string) (bool, error)
+	ValidateUser(ctx context.Context, username, password string) (storage.User, error)
+}
+
+// SessionChecker resolves the bearer tokens issued at login.
+type SessionChecker interface {
+	CheckSession(ctx context.Context, token string) (storage.User, error)
 }
 
 type Request struct {
@@ -26,49 +37,108 @@ type Request struct {
 
 type contextKey string
 
-const usernameKey contextKey = "username"
+const (
+	usernameKey contextKey = "username"
+	userKey     contextKey = "user"
+)
 
-func BasicAuthMiddleware(log *slog.Logger, userAuth UserAuth) func(http.Handler) http.Handler {
+// UserFromContext returns the user authenticated by BasicAuthMiddleware.
+func UserFromContext(ctx context.Context) (storage.User, bool) {
+	user, ok := ctx.Value(userKey).(storage.User)
+	return user, ok
+}
+
+// BasicAuthMiddleware authenticates every request, either with Basic Auth
+// or with "Authorization: Bearer <token>" carrying a session token from
+// /login. Accounts with two-factor authentication can only use sessions,
+// Basic Auth has no way to pass the second factor. Only failures are
+// audited, with Basic Auth each request is a login of its own and
+// recording them all would drown the audit log.
+func BasicAuthMiddleware(log *slog.Logger, userAuth UserAuth, sessions SessionChecker, auditor audit.Auditor) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			const fn = "middleware.authentication.BasicAuthMiddleware"
 
-			log = log.With(
+			log := log.With(
 				slog.String("fn", fn),
 				slog.String("request_id", middleware.GetReqID(r.Context())),
+				sl.Trace(r.Context()),
 			)
 
+			fail := func(username, reason, msg string) {
+				metrics.AuthFailures.WithLabelValues(reason).Inc()
+				auditor.Record(r, audit.Event{
+					Action:  audit.ActionLoginFailed,
+					Actor:   username,
+					Target:  username,
+					Details: map[string]string{"reason": reason},
+				})
+				w.Header().Set("WWW-Authenticate", `Basic realm="url-shorter"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				render.JSON(w, r, resp.Error(msg))
+			}
+
+			if tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				user, err := sessions.CheckSession(r.Context(), tok)
+				if err == nil && user.Disabled {
+					err = storage.ErrUserDisabled
+				}
+				if err != nil {
+					log.Warn("invalid session", sl.Err(err))
+					reason := "invalid_session"
+					if errors.Is(err, storage.ErrUserDisabled) {
+						reason = FailureReason(err)
+					}
+					fail(user.Username, reason, "Unauthorized")
+					return
+				}
+
+				h.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
+				return
+			}
+
 			username, password, ok := r.BasicAuth()
 			if !ok {
 				log.Warn("missing or invalid Authorization header", slog.String("fn", fn))
+				metrics.AuthFailures.WithLabelValues("missing_credentials").Inc()
 				w.Header().Set("WWW-Authenticate", `Basic realm="url-shorter"`)
 				w.WriteHeader(http.StatusUnauthorized)
 				render.JSON(w, r, resp.Error("Unauthorized"))
 				return
 			}
 
-			ok, err := userAuth.ValidateUser(username, password)
+			user, err := userAuth.ValidateUser(r.Context(), username, password)
 			if err != nil {
-				log.Error("%s: %w", fn, err)
-				log.Warn("missing or invalid Authorization header", slog.String("fn", fn))
-				w.Header().Set("WWW-Authenticate", `Basic realm="url-shorter"`)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				log.Warn("invalid credentials", slog.String("username", username), sl.Err(err))
+				fail(username, FailureReason(err), "Unauthorized")
 				return
 			}
 
-			if !ok {
-				log.Error("%s: %w", fn, err)
-				log.Warn("invalid credentials", slog.String("username", username))
-				w.Header().Set("WWW-Authenticate", `Basic realm="url-shorter"`)
-				w.WriteHeader(http.StatusUnauthorized)
-				render.JSON(w, r, resp.Error("Unauthorized"))
+			if user.TOTPEnabled {
+				log.Warn("basic auth for a two-factor account", slog.String("username", username))
+				fail(username, "second_factor_required", "two-factor authentication is enabled, log in at /login and use the bearer token")
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), usernameKey, username)
-			r = r.WithContext(ctx)
-
-			h.ServeHTTP(w, r)
+			h.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
 		})
 	}
 }
+
+func withUser(ctx context.Context, user storage.User) context.Context {
+	ctx = context.WithValue(ctx, usernameKey, user.Username)
+	return context.WithValue(ctx, userKey, user)
+}
+
+// FailureReason names why a login failed, for metrics and the audit log.
+func FailureReason(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		return "unknown_user"
+	case errors.Is(err, storage.ErrWrongPassword):
+		return "invalid_password"
+	case errors.Is(err, storage.ErrUserDisabled):
+		return "user_disabled"
+	}
+	return "error"
+}
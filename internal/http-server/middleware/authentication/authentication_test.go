@@ -0,0 +1,65 @@
+package authentication
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/lib/token"
+	"url-shorter/internal/storage"
+)
+
+var twoFactorUser = storage.User{ID: 1, Username: "amy", Role: storage.RoleAdmin, TOTPEnabled: true}
+
+type stubAuth struct{}
+
+func (stubAuth) ValidateUser(context.Context, string, string) (storage.User, error) {
+	return twoFactorUser, nil
+}
+
+func (stubAuth) CheckSession(_ context.Context, tok string) (storage.User, error) {
+	if tok != "session-token" {
+		return storage.User{}, token.ErrInvalid
+	}
+	return twoFactorUser, nil
+}
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(*http.Request, audit.Event) {}
+
+func TestTwoFactorAccountNeedsSession(t *testing.T) {
+	h := BasicAuthMiddleware(slog.New(slog.NewTextHandler(io.Discard, nil)), stubAuth{}, stubAuth{}, nopAuditor{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, ok := UserFromContext(r.Context()); !ok || user.ID != twoFactorUser.ID {
+				t.Errorf("UserFromContext() = %+v, %v; want amy", user, ok)
+			}
+		}),
+	)
+
+	tests := []struct {
+		name string
+		auth func(r *http.Request)
+		want int
+	}{
+		{"basic auth", func(r *http.Request) { r.SetBasicAuth("amy", "password1") }, http.StatusUnauthorized},
+		{"session", func(r *http.Request) { r.Header.Set("Authorization", "Bearer session-token") }, http.StatusOK},
+		{"unknown session", func(r *http.Request) { r.Header.Set("Authorization", "Bearer forged") }, http.StatusUnauthorized},
+		{"no credentials", func(*http.Request) {}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/account", nil)
+		tt.auth(r)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+
+	"url-shorter/internal/http-server/middleware/authentication"
+	resp "url-shorter/internal/lib/api/response"
+	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/storage"
+)
+
+// RequireRole lets through users whose role is one of roles. It must run
+// after authentication.BasicAuthMiddleware.
+func RequireRole(log *slog.Logger, roles ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			const fn = "middleware.authorization.RequireRole"
+
+			user, ok := authentication.UserFromContext(r.Context())
+			if !ok || !slices.Contains(roles, user.Role) {
+				log.Warn("insufficient role",
+					slog.String("fn", fn),
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+					sl.Trace(r.Context()),
+					slog.String("username", user.Username),
+					slog.String("role", user.Role),
+				)
+				metrics.AuthFailures.WithLabelValues("insufficient_role").Inc()
+				w.WriteHeader(http.StatusForbidden)
+				render.JSON(w, r, resp.Error("Forbidden"))
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdmin lets through admins only.
+func RequireAdmin(log *slog.Logger) func(http.Handler) http.Handler {
+	return RequireRole(log, storage.RoleAdmin)
+}
+
+// RequireWriter lets through the users allowed to change data, that is
+// everyone but read-only users.
+func RequireWriter(log *slog.Logger) func(http.Handler) http.Handler {
+	return RequireRole(log, storage.RoleAdmin, storage.RoleMember)
+}
+
+type OrgMemberGetter interface {
+	GetOrgMember(ctx context.Context, orgName string, userID int64) (storage.Org, storage.OrgMember, error)
+}
+
+type contextKey string
+
+const orgKey contextKey = "org"
+
+type orgAccess struct {
+	org    storage.Org
+	member storage.OrgMember
+}
+
+// OrgFromContext returns the org loaded by RequireOrgRole and the
+// membership of the authenticated user in it.
+func OrgFromContext(ctx context.Context) (storage.Org, storage.OrgMember, bool) {
+	access, ok := ctx.Value(orgKey).(orgAccess)
+	return access.org, access.member, ok
+}
+
+// RequireOrgRole loads the org named by the {org} URL parameter and lets
+// through its members whose org role is one of roles, any member if no
+// roles are given. Users outside the org get the same 404 as for an
+// unknown one, so org names can not be probed. It must run after
+// authentication.BasicAuthMiddleware.
+func RequireOrgRole(log *slog.Logger, getter OrgMemberGetter, roles ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			const fn = "middleware.authorization.RequireOrgRole"
+
+			log := log.With(
+				slog.String("fn", fn),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				sl.Trace(r.Context()),
+			)
+
+			user, _ := authentication.UserFromContext(r.Context())
+			name := chi.URLParam(r, "org")
+
+			// A RequireOrgRole further up the chain already loaded the org.
+			org, member, loaded := OrgFromContext(r.Context())
+
+			var err error
+			if !loaded || org.Name != name {
+				org, member, err = getter.GetOrgMember(r.Context(), name, user.ID)
+			}
+			if errors.Is(err, storage.ErrOrgNotFound) || errors.Is(err, storage.ErrNotOrgMember) {
+				log.Info("org not found for user", slog.String("org", name), slog.String("username", user.Username), sl.Err(err))
+				w.WriteHeader(http.StatusNotFound)
+				render.JSON(w, r, resp.Error("org not found"))
+				return
+			}
+			if err != nil {
+				log.Error("failed to get org membership", sl.Err(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("internal error"))
+				return
+			}
+
+			if len(roles) > 0 && !slices.Contains(roles, member.Role) {
+				log.Warn("insufficient org role",
+					slog.String("org", name),
+					slog.String("username", user.Username),
+					slog.String("role", member.Role),
+				)
+				metrics.AuthFailures.WithLabelValues("insufficient_org_role").Inc()
+				w.WriteHeader(http.StatusForbidden)
+				render.JSON(w, r, resp.Error("Forbidden"))
+				return
+			}
+
+			member.Username = user.Username
+			member.Email = user.Email
+
+			ctx := context.WithValue(r.Context(), orgKey, orgAccess{org: org, member: member})
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireOrgMember lets through every member of the org.
+func RequireOrgMember(log *slog.Logger, getter OrgMemberGetter) func(http.Handler) http.Handler {
+	return RequireOrgRole(log, getter)
+}
+
+// RequireOrgAdmin lets through the owners and admins of the org.
+func RequireOrgAdmin(log *slog.Logger, getter OrgMemberGetter) func(http.Handler) http.Handler {
+	return RequireOrgRole(log, getter, storage.OrgRoleOwner, storage.OrgRoleAdmin)
+}
@@ -0,0 +1,77 @@
+package authorization
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"url-shorter/internal/audit"
+	"url-shorter/internal/http-server/middleware/authentication"
+	"url-shorter/internal/lib/token"
+	"url-shorter/internal/storage"
+)
+
+// stubAuth accepts any password and gives every user the role named by
+// the username.
+type stubAuth struct{}
+
+func (stubAuth) ValidateUser(_ context.Context, username, _ string) (storage.User, error) {
+	return storage.User{ID: 1, Username: username, Role: username}, nil
+}
+
+func (stubAuth) CheckSession(context.Context, string) (storage.User, error) {
+	return storage.User{}, token.ErrInvalid
+}
+
+type nopAuditor struct{}
+
+func (nopAuditor) Record(*http.Request, audit.Event) {}
+
+func TestRequireRole(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	authenticate := authentication.BasicAuthMiddleware(log, stubAuth{}, stubAuth{}, nopAuditor{})
+
+	tests := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		role       string
+		want       int
+	}{
+		{"admin passes RequireAdmin", RequireAdmin(log), storage.RoleAdmin, http.StatusOK},
+		{"member stopped by RequireAdmin", RequireAdmin(log), storage.RoleMember, http.StatusForbidden},
+		{"read-only stopped by RequireAdmin", RequireAdmin(log), storage.RoleReadOnly, http.StatusForbidden},
+		{"admin passes RequireWriter", RequireWriter(log), storage.RoleAdmin, http.StatusOK},
+		{"member passes RequireWriter", RequireWriter(log), storage.RoleMember, http.StatusOK},
+		{"read-only stopped by RequireWriter", RequireWriter(log), storage.RoleReadOnly, http.StatusForbidden},
+		{"unknown role stopped by RequireWriter", RequireWriter(log), "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/url", nil)
+		r.SetBasicAuth(tt.role, "password")
+		w := httptest.NewRecorder()
+		authenticate(tt.middleware(ok)).ServeHTTP(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRequireRoleWithoutUser(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := RequireWriter(log)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("request without a user got through")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/url", nil))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusForbidden)
+	}
+}
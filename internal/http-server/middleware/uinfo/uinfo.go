@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"url-shorter/internal/lib/logger/sl"
 	workerUInfo "url-shorter/internal/worker/uinfo"
 
 	"github.com/go-chi/chi/v5/middleware"
@@ -14,17 +15,17 @@ func GetUserInfo(log *slog.Logger) func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			const fn = "middleware.uinfo.GetUserInfo"
 
-			log = log.With(
+			log := log.With(
 				slog.String("fn", fn),
 				slog.String("request_id", middleware.GetReqID(r.Context())),
+				sl.Trace(r.Context()),
 			)
-			select {
-			case workerUInfo.LogQueue <- workerUInfo.LogData{
+			queued := workerUInfo.Enqueue(workerUInfo.LogData{
 				UA:  r.UserAgent(),
 				R:   r,
 				Log: log,
-			}:
-			default:
+			})
+			if !queued {
 				log.Warn("Очередь логов заполнена, пропускаем запись")
 			}
 
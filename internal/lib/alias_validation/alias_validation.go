@@ -0,0 +1,191 @@
+package alias_validation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	RuleCharset   = "charset"
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleReserved  = "reserved"
+	RuleBlocklist = "blocklist"
+)
+
+var ErrInvalidCharset = errors.New("invalid alias charset")
+
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// ValidationError collects every rule the alias broke, so the client can fix
+// them all at once.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.Message)
+	}
+
+	return "alias is not valid: " + strings.Join(msgs, ", ")
+}
+
+type Config struct {
+	MinLength     int
+	MaxLength     int
+	Charset       string
+	CaseFold      bool
+	Reserved      []string
+	BlocklistPath string
+}
+
+type Policy struct {
+	cfg      Config
+	charset  *regexp.Regexp
+	reserved map[string]struct{}
+
+	mu        sync.RWMutex
+	blocklist []string
+}
+
+func NewPolicy(cfg Config) (*Policy, error) {
+	const fn = "lib.alias_validation.NewPolicy"
+
+	charset, err := regexp.Compile("^[" + cfg.Charset + "]+$")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", fn, ErrInvalidCharset, err)
+	}
+
+	reserved := make(map[string]struct{}, len(cfg.Reserved))
+	for _, word := range cfg.Reserved {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			reserved[word] = struct{}{}
+		}
+	}
+
+	p := &Policy{
+		cfg:      cfg,
+		charset:  charset,
+		reserved: reserved,
+	}
+
+	if err := p.ReloadBlocklist(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return p, nil
+}
+
+// ReloadBlocklist rereads the blocklist file. It is safe to call while
+// requests are being validated.
+func (p *Policy) ReloadBlocklist() error {
+	const fn = "lib.alias_validation.ReloadBlocklist"
+
+	if p.cfg.BlocklistPath == "" {
+		return nil
+	}
+
+	file, err := os.Open(p.cfg.BlocklistPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	defer file.Close()
+
+	var blocklist []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist = append(blocklist, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	p.mu.Lock()
+	p.blocklist = blocklist
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Validate checks alias against the policy and returns it in the form it
+// should be stored in.
+func (p *Policy) Validate(alias string) (string, error) {
+	if p.cfg.CaseFold {
+		alias = strings.ToLower(alias)
+	}
+
+	var violations []Violation
+
+	length := utf8.RuneCountInString(alias)
+	if p.cfg.MinLength > 0 && length < p.cfg.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("alias must have at least %d characters", p.cfg.MinLength),
+		})
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("alias can have at most %d characters", p.cfg.MaxLength),
+		})
+	}
+
+	if !p.charset.MatchString(alias) {
+		violations = append(violations, Violation{
+			Rule:    RuleCharset,
+			Message: fmt.Sprintf("alias may contain only [%s] characters", p.cfg.Charset),
+		})
+	}
+
+	lower := strings.ToLower(alias)
+
+	if _, ok := p.reserved[lower]; ok {
+		violations = append(violations, Violation{
+			Rule:    RuleReserved,
+			Message: "alias is reserved",
+		})
+	}
+
+	if p.isBlocked(lower) {
+		violations = append(violations, Violation{
+			Rule:    RuleBlocklist,
+			Message: "alias contains a blocked word",
+		})
+	}
+
+	if len(violations) > 0 {
+		return "", &ValidationError{Violations: violations}
+	}
+
+	return alias, nil
+}
+
+func (p *Policy) isBlocked(alias string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, word := range p.blocklist {
+		if strings.Contains(alias, word) {
+			return true
+		}
+	}
+
+	return false
+}
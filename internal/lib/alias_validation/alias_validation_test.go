@@ -0,0 +1,93 @@
+package alias_validation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(blocklist, []byte("# comment\nbadword\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(Config{
+		MinLength:     3,
+		MaxLength:     10,
+		Charset:       "a-zA-Z0-9_-",
+		CaseFold:      true,
+		Reserved:      []string{"url", "Register"},
+		BlocklistPath: blocklist,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alias string
+		want  string
+		rules []string
+	}{
+		{alias: "My-Link", want: "my-link"},
+		{alias: "ab", rules: []string{RuleMinLength}},
+		{alias: "abcdefghijk", rules: []string{RuleMaxLength}},
+		{alias: "a/b/c", rules: []string{RuleCharset}},
+		{alias: "аbc", rules: []string{RuleCharset}},
+		{alias: "REGISTER", rules: []string{RuleReserved}},
+		{alias: "xBadWordx", rules: []string{RuleBlocklist}},
+	}
+
+	for _, tt := range tests {
+		got, err := p.Validate(tt.alias)
+		if len(tt.rules) == 0 {
+			if err != nil || got != tt.want {
+				t.Errorf("Validate(%q) = %q, %v; want %q, nil", tt.alias, got, err, tt.want)
+			}
+			continue
+		}
+
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("Validate(%q) error = %v; want ValidationError", tt.alias, err)
+			continue
+		}
+		if len(validationErr.Violations) != len(tt.rules) {
+			t.Errorf("Validate(%q) violations = %v; want %v", tt.alias, validationErr.Violations, tt.rules)
+			continue
+		}
+		for i, rule := range tt.rules {
+			if validationErr.Violations[i].Rule != rule {
+				t.Errorf("Validate(%q) rule = %q; want %q", tt.alias, validationErr.Violations[i].Rule, rule)
+			}
+		}
+	}
+}
+
+func TestPolicyReloadBlocklist(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(blocklist, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(Config{Charset: "a-z", BlocklistPath: blocklist})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Validate("spam"); err != nil {
+		t.Fatalf("Validate before reload: %v", err)
+	}
+
+	if err := os.WriteFile(blocklist, []byte("spam\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ReloadBlocklist(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Validate("spam"); err == nil {
+		t.Fatal("Validate after reload: want error")
+	}
+}
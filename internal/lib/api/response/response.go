@@ -8,8 +8,15 @@ import (
 )
 
 type Response struct {
-	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 const (
@@ -30,6 +37,14 @@ func Error(msg string) Response {
 	}
 }
 
+func FieldErrors(msg string, errs []FieldError) Response {
+	return Response{
+		Status: StatusError,
+		Error:  msg,
+		Errors: errs,
+	}
+}
+
 func ValidationError(errs validator.ValidationErrors) Response {
 	var errMsgs []string
 
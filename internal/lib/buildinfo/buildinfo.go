@@ -0,0 +1,31 @@
+// Package buildinfo holds the build metadata injected at link time:
+//
+//	go build -ldflags "-X url-shorter/internal/lib/buildinfo.Version=v1.2.0 \
+//		-X url-shorter/internal/lib/buildinfo.Commit=$(git rev-parse HEAD) \
+//		-X url-shorter/internal/lib/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//		./cmd/url-shorter
+package buildinfo
+
+import "runtime"
+
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
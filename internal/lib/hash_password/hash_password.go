@@ -1,19 +1,195 @@
+// Package hash_password hashes passwords with bcrypt or argon2id. Hashes
+// describe themselves: bcrypt hashes carry their cost, argon2id hashes use
+// the PHC string format ($argon2id$v=19$m=...,t=...,p=...$salt$key), so
+// hashes made with older parameters keep verifying and can be spotted for
+// an upgrade.
 package hash_password
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-const totalIterations int = 14
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
 
-func GeneratePassword(password string) (string, error) {
-	const fn = "lib.hash_password.generatePassword"
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), totalIterations)
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMismatch         = errors.New("password does not match the hash")
+	ErrMalformedHash    = errors.New("malformed password hash")
+)
+
+// Config selects the algorithm and its parameters. Argon2Memory is in
+// KiB. Keep this struct in sync with config.PasswordHashing.
+type Config struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+// Default is what the service used before hashing became configurable.
+var Default = Config{Algorithm: AlgorithmBcrypt, BcryptCost: 14}
+
+type Hasher struct {
+	cfg Config
+}
+
+func New(cfg Config) (*Hasher, error) {
+	const fn = "lib.hash_password.New"
+
+	switch cfg.Algorithm {
+	case AlgorithmBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("%s: bcrypt cost must be between %d and %d", fn, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgorithmArgon2id:
+		if cfg.Argon2Time == 0 || cfg.Argon2Memory == 0 || cfg.Argon2Threads == 0 {
+			return nil, fmt.Errorf("%s: argon2id time, memory and threads must be positive", fn)
+		}
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", fn, ErrUnknownAlgorithm, cfg.Algorithm)
+	}
+
+	return &Hasher{cfg: cfg}, nil
+}
+
+// Hash hashes password with the configured algorithm.
+func (h *Hasher) Hash(password string) (string, error) {
+	const fn = "lib.hash_password.Hash"
+
+	if h.cfg.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("%s: failed to hash password: %w", fn, err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+
+	p := argon2Params{
+		time:    h.cfg.Argon2Time,
+		memory:  h.cfg.Argon2Memory,
+		threads: h.cfg.Argon2Threads,
+		salt:    salt,
+	}
+	p.key = p.derive(password, argon2KeyLen)
+
+	return p.String(), nil
+}
+
+// Verify checks password against hash, whatever algorithm and
+// parameters it was made with.
+func (h *Hasher) Verify(hash, password string) error {
+	const fn = "lib.hash_password.Verify"
+
+	if !strings.HasPrefix(hash, "$"+AlgorithmArgon2id+"$") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatch
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", fn, ErrMalformedHash, err)
+		}
+		return nil
+	}
+
+	p, err := parseArgon2(hash)
 	if err != nil {
-		return "", fmt.Errorf("%s: failed to hash password: %w", fn, err)
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if subtle.ConstantTimeCompare(p.key, p.derive(password, uint32(len(p.key)))) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or
+// other parameters than the configured ones.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, "$"+AlgorithmArgon2id+"$") {
+		if h.cfg.Algorithm != AlgorithmArgon2id {
+			return true
+		}
+		p, err := parseArgon2(hash)
+		return err != nil ||
+			p.time != h.cfg.Argon2Time ||
+			p.memory != h.cfg.Argon2Memory ||
+			p.threads != h.cfg.Argon2Threads ||
+			len(p.salt) != argon2SaltLen ||
+			len(p.key) != argon2KeyLen
+	}
+
+	if h.cfg.Algorithm != AlgorithmBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cfg.BcryptCost
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (p argon2Params) derive(password string, keyLen uint32) []byte {
+	return argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, keyLen)
+}
+
+func (p argon2Params) String() string {
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id, argon2.Version, p.memory, p.time, p.threads,
+		enc.EncodeToString(p.salt), enc.EncodeToString(p.key))
+}
+
+func parseArgon2(hash string) (argon2Params, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return argon2Params{}, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, ErrMalformedHash
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return argon2Params{}, ErrMalformedHash
+	}
+
+	var err error
+	enc := base64.RawStdEncoding
+	if p.salt, err = enc.DecodeString(parts[4]); err != nil {
+		return argon2Params{}, ErrMalformedHash
+	}
+	if p.key, err = enc.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return argon2Params{}, ErrMalformedHash
 	}
 
-	return string(hash), nil
+	return p, nil
 }
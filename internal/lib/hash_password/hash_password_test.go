@@ -0,0 +1,81 @@
+package hash_password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHasher(t *testing.T) {
+	bcryptLow := Config{Algorithm: AlgorithmBcrypt, BcryptCost: 4}
+	bcryptHigh := Config{Algorithm: AlgorithmBcrypt, BcryptCost: 5}
+	argonLow := Config{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+	argonHigh := Config{Algorithm: AlgorithmArgon2id, Argon2Time: 2, Argon2Memory: 64, Argon2Threads: 1}
+
+	tests := []struct {
+		name   string
+		hashed Config
+		now    Config
+		rehash bool
+	}{
+		{"same bcrypt", bcryptLow, bcryptLow, false},
+		{"bcrypt cost raised", bcryptLow, bcryptHigh, true},
+		{"bcrypt to argon2id", bcryptLow, argonLow, true},
+		{"same argon2id", argonLow, argonLow, false},
+		{"argon2id time raised", argonLow, argonHigh, true},
+		{"argon2id to bcrypt", argonLow, bcryptLow, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, err := New(tt.hashed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, err := old.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h, err := New(tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := h.Verify(hash, "correct horse"); err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+			if err := h.Verify(hash, "wrong horse"); !errors.Is(err, ErrMismatch) {
+				t.Errorf("Verify() of a wrong password error = %v; want %v", err, ErrMismatch)
+			}
+			if got := h.NeedsRehash(hash); got != tt.rehash {
+				t.Errorf("NeedsRehash(%s) = %v; want %v", hash, got, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestArgon2Format(t *testing.T) {
+	h, err := New(Config{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := h.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("Hash() = %s", hash)
+	}
+
+	if err := h.Verify("$argon2id$v=19$m=64$broken", "secret"); !errors.Is(err, ErrMalformedHash) {
+		t.Errorf("Verify() of a malformed hash error = %v; want %v", err, ErrMalformedHash)
+	}
+}
+
+func TestNewUnknownAlgorithm(t *testing.T) {
+	if _, err := New(Config{Algorithm: "md5"}); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("New() error = %v; want %v", err, ErrUnknownAlgorithm)
+	}
+}
@@ -0,0 +1,318 @@
+// Package linkfile reads and writes links as CSV or NDJSON, the formats used
+// by the import and export endpoints.
+package linkfile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown file format")
+	ErrMissingColumn = errors.New("missing required column")
+)
+
+// Record is one link in a file. ClicksLeft is the number of redirects the
+// link has left, zero for a used up link; it and ExpiresAt are nil when the
+// file leaves them empty. Files written before clicks_left have the column
+// as max_clicks, it is read the same. Clicks is only written on export.
+type Record struct {
+	Alias      string     `json:"alias,omitempty"`
+	URL        string     `json:"url"`
+	ClicksLeft *int       `json:"clicks_left,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Clicks     *int64     `json:"clicks,omitempty"`
+}
+
+// RowError is returned by Reader.Read for a malformed row. Reading can go on
+// after it.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ParseFormat picks the format from an explicit name or, when it is empty,
+// from the Content-Type header.
+func ParseFormat(name, contentType string) (Format, error) {
+	if name == "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case "text/csv":
+			return FormatCSV, nil
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			return FormatNDJSON, nil
+		}
+		return "", ErrUnknownFormat
+	}
+
+	switch Format(strings.ToLower(name)) {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatNDJSON, "jsonl":
+		return FormatNDJSON, nil
+	}
+
+	return "", ErrUnknownFormat
+}
+
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+type Reader interface {
+	// Read returns the next record and the line it started on. It returns
+	// io.EOF at the end of input and *RowError for rows that can be skipped.
+	Read() (Record, int, error)
+}
+
+func NewReader(format Format, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatNDJSON:
+		return &ndjsonReader{scanner: newScanner(r)}, nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+type Writer interface {
+	Write(rec Record) error
+	Flush() error
+}
+
+func NewWriter(format Format, w io.Writer, withClicks bool) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, withClicks)
+	case FormatNDJSON:
+		return &ndjsonWriter{w: bufio.NewWriter(w)}, nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+var csvColumns = []string{"alias", "url", "clicks_left", "expires_at", "tags"}
+
+// Tags share a single CSV column, separated by commas.
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	const fn = "lib.linkfile.newCSVReader"
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: read header: %w", fn, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["url"]; !ok {
+		return nil, fmt.Errorf("%s: %w: url", fn, ErrMissingColumn)
+	}
+
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (r *csvReader) Read() (Record, int, error) {
+	fields, err := r.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Record{}, parseErr.StartLine, &RowError{Line: parseErr.StartLine, Err: parseErr.Err}
+		}
+		return Record{}, 0, err
+	}
+	line, _ := r.r.FieldPos(0)
+
+	field := func(name string) string {
+		i, ok := r.columns[name]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+
+	rec := Record{
+		Alias: field("alias"),
+		URL:   field("url"),
+	}
+
+	name := "clicks_left"
+	if _, ok := r.columns[name]; !ok {
+		name = "max_clicks"
+	}
+	if v := field(name); v != "" {
+		clicksLeft, err := strconv.Atoi(v)
+		if err != nil || clicksLeft < 0 {
+			return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid %s %q", name, v)}
+		}
+		rec.ClicksLeft = &clicksLeft
+	}
+
+	if v := field("expires_at"); v != "" {
+		expiresAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Record{}, line, &RowError{Line: line, Err: fmt.Errorf("invalid expires_at %q", v)}
+		}
+		rec.ExpiresAt = &expiresAt
+	}
+
+	if v := field("tags"); v != "" {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				rec.Tags = append(rec.Tags, tag)
+			}
+		}
+	}
+
+	return rec, line, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return scanner
+}
+
+func (r *ndjsonReader) Read() (Record, int, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var row struct {
+			Record
+			MaxClicks *int `json:"max_clicks"`
+		}
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			return Record{}, r.line, &RowError{Line: r.line, Err: err}
+		}
+
+		rec := row.Record
+		if rec.ClicksLeft == nil {
+			rec.ClicksLeft = row.MaxClicks
+		}
+		if rec.ClicksLeft != nil && *rec.ClicksLeft < 0 {
+			return Record{}, r.line, &RowError{Line: r.line, Err: fmt.Errorf("invalid clicks_left %d", *rec.ClicksLeft)}
+		}
+		rec.Clicks = nil
+
+		return rec, r.line, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Record{}, r.line, err
+	}
+
+	return Record{}, r.line, io.EOF
+}
+
+type csvWriter struct {
+	w          *csv.Writer
+	withClicks bool
+}
+
+func newCSVWriter(w io.Writer, withClicks bool) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+
+	header := csvColumns
+	if withClicks {
+		header = append(header[:len(header):len(header)], "clicks")
+	}
+	if err := cw.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &csvWriter{w: cw, withClicks: withClicks}, nil
+}
+
+func (w *csvWriter) Write(rec Record) error {
+	fields := []string{rec.Alias, rec.URL, "", "", strings.Join(rec.Tags, ",")}
+	if rec.ClicksLeft != nil {
+		fields[2] = strconv.Itoa(*rec.ClicksLeft)
+	}
+	if rec.ExpiresAt != nil {
+		fields[3] = rec.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if w.withClicks {
+		var clicks int64
+		if rec.Clicks != nil {
+			clicks = *rec.Clicks
+		}
+		fields = append(fields, strconv.FormatInt(clicks, 10))
+	}
+
+	return w.w.Write(fields)
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type ndjsonWriter struct {
+	w *bufio.Writer
+}
+
+func (w *ndjsonWriter) Write(rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+
+	return w.w.WriteByte('\n')
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,94 @@
+package linkfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	five, none := 5, 0
+	records := []Record{
+		{Alias: "one", URL: "https://example.com/1", ClicksLeft: &five, ExpiresAt: &expiresAt, Tags: []string{"a", "b"}},
+		{Alias: "used", URL: "https://example.com/used", ClicksLeft: &none},
+		{URL: "https://example.com/2"},
+	}
+
+	for _, format := range []Format{FormatCSV, FormatNDJSON} {
+		var buf bytes.Buffer
+
+		w, err := NewWriter(format, &buf, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range records {
+			if err := w.Write(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewReader(format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []Record
+		for {
+			rec, _, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: Read: %v", format, err)
+			}
+			got = append(got, rec)
+		}
+
+		if !reflect.DeepEqual(got, records) {
+			t.Errorf("%s: got %+v; want %+v", format, got, records)
+		}
+	}
+}
+
+func TestCSVRowError(t *testing.T) {
+	r, err := NewReader(FormatCSV, bytes.NewBufferString("url,max_clicks\nhttps://a.com,x\nhttps://b.com,2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, line, err := r.Read()
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || line != 2 {
+		t.Fatalf("Read() line %d, error %v; want RowError on line 2", line, err)
+	}
+
+	rec, line, err := r.Read()
+	if err != nil || line != 3 || rec.ClicksLeft == nil || *rec.ClicksLeft != 2 {
+		t.Fatalf("Read() = %+v, %d, %v; want max_clicks 2 on line 3", rec, line, err)
+	}
+}
+
+func TestNDJSONMaxClicks(t *testing.T) {
+	r, err := NewReader(FormatNDJSON, bytes.NewBufferString(`{"url":"https://a.com","max_clicks":4}`+"\n"+`{"url":"https://b.com","clicks_left":-1}`+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, _, err := r.Read()
+	if err != nil || rec.ClicksLeft == nil || *rec.ClicksLeft != 4 {
+		t.Fatalf("Read() = %+v, %v; want clicks_left 4 from max_clicks", rec, err)
+	}
+
+	_, line, err := r.Read()
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || line != 2 {
+		t.Fatalf("Read() line %d, error %v; want RowError for a negative clicks_left on line 2", line, err)
+	}
+}
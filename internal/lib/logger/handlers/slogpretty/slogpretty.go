@@ -3,9 +3,11 @@ package slogpretty
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	stdLog "log"
 	"log/slog"
+	"runtime"
 
 	"github.com/fatih/color"
 )
@@ -25,6 +27,7 @@ func (opts PrettyHandlerOptions) NewPrettyHandler(
 	out io.Writer,
 ) *PrettyHandler {
 	h := &PrettyHandler{
+		opts:    opts,
 		Handler: slog.NewJSONHandler(out, opts.SlogOpts),
 		l:       stdLog.New(out, "", 0),
 	}
@@ -46,16 +49,21 @@ func (h *PrettyHandler) Handle(_ context.Context, r slog.Record) error {
 		level = color.RedString(level)
 	}
 
-	fields := make(map[string]interface{}, r.NumAttrs())
+	fields := make(map[string]interface{}, r.NumAttrs()+len(h.attrs))
+
+	for _, a := range h.attrs {
+		addField(fields, a)
+	}
 
 	r.Attrs(func(a slog.Attr) bool {
-		fields[a.Key] = a.Value.Any()
+		addField(fields, a)
 
 		return true
 	})
 
-	for _, a := range h.attrs {
-		fields[a.Key] = a.Value.Any()
+	if h.opts.SlogOpts != nil && h.opts.SlogOpts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		fields[slog.SourceKey] = fmt.Sprintf("%s:%d", frame.File, frame.Line)
 	}
 
 	var b []byte
@@ -68,7 +76,7 @@ func (h *PrettyHandler) Handle(_ context.Context, r slog.Record) error {
 		}
 	}
 
-	timeStr := r.Time.Format("[15:05:05.000]")
+	timeStr := r.Time.Format("[15:04:05.000]")
 	msg := color.CyanString(r.Message)
 
 	h.l.Println(
@@ -83,15 +91,37 @@ func (h *PrettyHandler) Handle(_ context.Context, r slog.Record) error {
 
 func (h *PrettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	return &PrettyHandler{
+		opts:    h.opts,
 		Handler: h.Handler,
 		l:       h.l,
-		attrs:   attrs,
+		attrs:   append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...),
 	}
 }
 
 func (h *PrettyHandler) WithGroup(name string) slog.Handler {
 	return &PrettyHandler{
+		opts:    h.opts,
 		Handler: h.Handler.WithGroup(name),
 		l:       h.l,
+		attrs:   h.attrs,
+	}
+}
+
+// addField inlines groups without a key, like sl.Trace, the way the
+// builtin handlers do.
+func addField(fields map[string]interface{}, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+
+	if a.Value.Kind() == slog.KindGroup && a.Key == "" {
+		for _, ga := range a.Value.Group() {
+			addField(fields, ga)
+		}
+		return
 	}
+
+	if a.Key == "" {
+		return
+	}
+
+	fields[a.Key] = a.Value.Any()
 }
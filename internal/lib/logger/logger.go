@@ -0,0 +1,89 @@
+// Package logger builds the application logger from the logging config.
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"url-shorter/internal/lib/logger/handlers/slogpretty"
+	"url-shorter/internal/lib/logger/redact"
+)
+
+const (
+	FormatPretty = "pretty"
+	FormatText   = "text"
+	FormatJSON   = "json"
+
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown log format")
+	ErrUnknownOutput = errors.New("unknown log output")
+)
+
+// Config selects the handler. Level is parsed by slog.Level.UnmarshalText,
+// so "debug", "INFO" or "warn+2" are all fine. FilePath is used by
+// OutputFile. Every handler is wrapped by redact.
+type Config struct {
+	Level     string
+	Format    string
+	Output    string
+	FilePath  string
+	AddSource bool
+	Redact    redact.Options
+}
+
+// Setup builds the logger. Its level is held by the returned LevelVar and
+// can be changed while the logger is in use. close releases the log file
+// and must be called on shutdown.
+func Setup(cfg Config) (log *slog.Logger, level *slog.LevelVar, close func() error, err error) {
+	const fn = "lib.logger.Setup"
+
+	level = new(slog.LevelVar)
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	var out io.Writer
+	close = func() error { return nil }
+
+	switch cfg.Output {
+	case OutputStdout, "":
+		out = os.Stdout
+	case OutputFile:
+		f, err := os.OpenFile(cfg.FilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		out = f
+		close = f.Close
+	default:
+		return nil, nil, nil, fmt.Errorf("%s: %w: %q", fn, ErrUnknownOutput, cfg.Output)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:     level,
+		AddSource: cfg.AddSource,
+	}
+
+	var handler slog.Handler
+
+	switch cfg.Format {
+	case FormatPretty:
+		handler = slogpretty.PrettyHandlerOptions{SlogOpts: opts}.NewPrettyHandler(out)
+	case FormatText:
+		handler = slog.NewTextHandler(out, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		close()
+		return nil, nil, nil, fmt.Errorf("%s: %w: %q", fn, ErrUnknownFormat, cfg.Format)
+	}
+
+	return slog.New(redact.NewHandler(handler, cfg.Redact)), level, close, nil
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	log, level, closeLog, err := Setup(Config{
+		Level:    "info",
+		Format:   FormatJSON,
+		Output:   OutputFile,
+		FilePath: path,
+	})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+
+	log.Debug("hidden")
+	level.Set(slog.LevelDebug)
+	log.Debug("shown")
+
+	if err := closeLog(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "hidden") || !strings.Contains(string(b), "shown") {
+		t.Errorf("log file = %q; want only the record logged after the level change", b)
+	}
+}
+
+func TestSetupFormats(t *testing.T) {
+	for _, format := range []string{FormatPretty, FormatText, FormatJSON} {
+		log, _, closeLog, err := Setup(Config{Level: "warn", Format: format})
+		if err != nil {
+			t.Fatalf("Setup(%q) error = %v", format, err)
+		}
+		if log.Enabled(context.Background(), slog.LevelInfo) {
+			t.Errorf("format %q: info is enabled at level warn", format)
+		}
+		closeLog()
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want error
+	}{
+		{"format", Config{Level: "info", Format: "xml"}, ErrUnknownFormat},
+		{"output", Config{Level: "info", Format: FormatJSON, Output: "syslog"}, ErrUnknownOutput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := Setup(tt.cfg)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Setup() error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, _, _, err := Setup(Config{Level: "loud", Format: FormatJSON}); err == nil {
+		t.Error("Setup() accepted an unknown level")
+	}
+}
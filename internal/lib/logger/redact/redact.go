@@ -0,0 +1,314 @@
+// Package redact masks sensitive values in log records before they reach
+// the handler that writes them.
+package redact
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mask replaces redacted values.
+const Mask = "[REDACTED]"
+
+// Options selects what is masked. Keys are attribute keys, map keys and
+// struct field names (their json name if tagged) whose values are always
+// replaced, compared case-insensitively. Struct fields tagged
+// `log:"redact"` and bearer or basic credentials are replaced whatever
+// the options. With URLs the query values and
+// userinfo passwords of logged URLs are masked, with IPs addresses are
+// cut down to their /24 (IPv4) or /48 (IPv6) network.
+type Options struct {
+	Keys []string
+	URLs bool
+	IPs  bool
+}
+
+// Handler wraps another handler and redacts every attribute, including
+// the ones added with WithAttrs, before passing records on.
+type Handler struct {
+	next slog.Handler
+	r    *redactor
+}
+
+// NewHandler returns next wrapped in a Handler. It wraps even when opts
+// select nothing, the struct tags and credentials are redacted anyway.
+func NewHandler(next slog.Handler, opts Options) slog.Handler {
+	r := &redactor{
+		keys: make(map[string]struct{}, len(opts.Keys)),
+		urls: opts.URLs,
+		ips:  opts.IPs,
+	}
+	for _, k := range opts.Keys {
+		r.keys[strings.ToLower(strings.TrimSpace(k))] = struct{}{}
+	}
+
+	return &Handler{next: next, r: r}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, rec slog.Record) error {
+	redacted := slog.NewRecord(rec.Time, rec.Level, rec.Message, rec.PC)
+
+	rec.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.r.attr(a))
+		return true
+	})
+
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.r.attr(a)
+	}
+
+	return &Handler{next: h.next.WithAttrs(redacted), r: h.r}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), r: h.r}
+}
+
+type redactor struct {
+	keys map[string]struct{}
+	urls bool
+	ips  bool
+}
+
+func (r *redactor) sensitive(key string) bool {
+	_, ok := r.keys[strings.ToLower(key)]
+	return ok
+}
+
+func (r *redactor) attr(a slog.Attr) slog.Attr {
+	if r.sensitive(a.Key) {
+		return slog.String(a.Key, Mask)
+	}
+
+	v := a.Value.Resolve()
+
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.string(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = r.attr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		if fields, ok := r.fields(reflect.ValueOf(v.Any())); ok {
+			return slog.Group(a.Key, fields...)
+		}
+	}
+
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// fields turns a struct, map, slice or array, or a pointer to one, into
+// attributes so that its fields, entries or elements are redacted one by
+// one. Elements are keyed by their index. Types that format themselves,
+// like time.Time or errors, byte slices and empty collections are left
+// alone.
+func (r *redactor) fields(rv reflect.Value) ([]any, bool) {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() || formatsItself(rv) {
+		return nil, false
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		return r.structFields(rv), true
+	case reflect.Map:
+		if rv.Len() == 0 {
+			return nil, false
+		}
+		return r.mapEntries(rv), true
+	case reflect.Slice, reflect.Array:
+		if rv.Len() == 0 || rv.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+		return r.elements(rv), true
+	}
+
+	return nil, false
+}
+
+func (r *redactor) structFields(rv reflect.Value) []any {
+	rt := rv.Type()
+	fields := make([]any, 0, rt.NumField())
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		if f.Tag.Get("log") == "redact" {
+			fields = append(fields, slog.String(name, Mask))
+			continue
+		}
+
+		fv := rv.Field(i)
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Pointer {
+			fields = append(fields, slog.Any(name, nil))
+			continue
+		}
+
+		fields = append(fields, r.attr(slog.Any(name, fv.Interface())))
+	}
+
+	return fields
+}
+
+// mapEntries sorts the entries by key, the way fmt prints maps.
+func (r *redactor) mapEntries(rv reflect.Value) []any {
+	entries := make([]any, 0, rv.Len())
+
+	iter := rv.MapRange()
+	for iter.Next() {
+		entries = append(entries, r.attr(slog.Any(fmt.Sprint(iter.Key().Interface()), iter.Value().Interface())))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].(slog.Attr).Key < entries[j].(slog.Attr).Key
+	})
+
+	return entries
+}
+
+func (r *redactor) elements(rv reflect.Value) []any {
+	elements := make([]any, rv.Len())
+	for i := range elements {
+		elements[i] = r.attr(slog.Any(strconv.Itoa(i), rv.Index(i).Interface()))
+	}
+
+	return elements
+}
+
+func formatsItself(rv reflect.Value) bool {
+	if !rv.CanInterface() {
+		return true
+	}
+
+	switch rv.Interface().(type) {
+	case slog.LogValuer, error, fmt.Stringer, encoding.TextMarshaler, json.Marshaler:
+		return true
+	}
+
+	return false
+}
+
+func (r *redactor) string(s string) string {
+	if scheme, _, ok := strings.Cut(s, " "); ok {
+		switch strings.ToLower(scheme) {
+		case "bearer", "basic":
+			return scheme + " " + Mask
+		}
+	}
+
+	if r.ips {
+		if masked, ok := maskIP(s); ok {
+			return masked
+		}
+	}
+
+	if r.urls {
+		if masked, ok := maskURL(s); ok {
+			return masked
+		}
+	}
+
+	return s
+}
+
+// maskIP handles both bare addresses and host:port.
+func maskIP(s string) (string, bool) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return maskAddr(addr).String(), true
+	}
+
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return netip.AddrPortFrom(maskAddr(ap.Addr()), ap.Port()).String(), true
+	}
+
+	return "", false
+}
+
+func maskAddr(addr netip.Addr) netip.Addr {
+	bits := 48
+	if addr.Is4() || addr.Is4In6() {
+		addr = addr.Unmap()
+		bits = 24
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr
+	}
+
+	return prefix.Addr()
+}
+
+// maskURL keeps the query parameter names, they help debugging and are
+// rarely secret, and masks their values. Passwords in the userinfo are
+// masked the way url.URL.Redacted does it.
+func maskURL(s string) (string, bool) {
+	if !strings.Contains(s, "://") && !strings.HasPrefix(s, "/") {
+		return "", false
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", false
+	}
+
+	_, hasPassword := u.User.Password()
+	if u.RawQuery == "" && !hasPassword {
+		return "", false
+	}
+
+	if u.RawQuery != "" {
+		var params []string
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			if param == "" {
+				continue
+			}
+			name, _, _ := strings.Cut(param, "=")
+			params = append(params, name+"="+Mask)
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+
+	return u.Redacted(), true
+}
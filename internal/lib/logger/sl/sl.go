@@ -1,10 +1,29 @@
 package sl
 
-import "log/slog"
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
 
 func Err(err error) slog.Attr {
 	return slog.Attr{
 		Key: "error",
 		Value: slog.StringValue(err.Error()),
 	}
-}
\ No newline at end of file
+}
+
+// Trace returns the trace and span ids of the span in ctx, inlined into
+// the record. It is empty when ctx carries no span.
+func Trace(ctx context.Context) slog.Attr {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return slog.Attr{}
+	}
+
+	return slog.Group("",
+		slog.String("trace_id", sc.TraceID().String()),
+		slog.String("span_id", sc.SpanID().String()),
+	)
+}
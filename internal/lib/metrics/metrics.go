@@ -0,0 +1,84 @@
+// Package metrics holds the Prometheus collectors of the service. They are
+// registered in the default registry, which /metrics serves.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const Namespace = "url_shorter"
+
+// Redirect outcomes.
+const (
+	RedirectHit       = "hit"
+	RedirectNotFound  = "not_found"
+	RedirectExhausted = "exhausted"
+	RedirectExpired   = "expired"
+	RedirectError     = "error"
+)
+
+// Sources of created links.
+const (
+	SourceSingle = "single"
+	SourceBatch  = "batch"
+	SourceImport = "import"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	Redirects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "redirects_total",
+		Help:      "Short link lookups by outcome.",
+	}, []string{"outcome"})
+
+	LinksCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "links_created_total",
+		Help:      "Created short links by source.",
+	}, []string{"source"})
+
+	AuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "auth_failures_total",
+		Help:      "Rejected authentication attempts by reason.",
+	}, []string{"reason"})
+
+	ClickEventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "click_events_dropped_total",
+		Help:      "Click events dropped because the click queue was full.",
+	})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Storage call latency by method.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	AuditFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "audit_failures_total",
+		Help:      "Audit events that could not be recorded.",
+	})
+
+	PasswordRehashFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "password_rehash_failures_total",
+		Help:      "Logins whose password hash could not be upgraded to the current parameters.",
+	})
+)
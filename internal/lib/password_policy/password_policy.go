@@ -0,0 +1,195 @@
+// Package password_policy decides which passwords users may choose: long
+// enough, not too long for the hash, and not known from a data breach.
+package password_policy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooShort = errors.New("password is too short")
+	ErrTooLong  = errors.New("password is too long")
+	ErrBreached = errors.New("password appears in a known data breach")
+)
+
+// Config of the policy. BreachedListPath is a file in the format of the
+// Pwned Passwords SHA-1 list ordered by hash: one "HASH:COUNT" line per
+// password, sorted, upper or lower case hex. Empty skips the check. Keep
+// this struct in sync with config.PasswordPolicy.
+type Config struct {
+	MinLength        int
+	MaxLength        int
+	BreachedListPath string
+}
+
+// ValidationError tells the user which rule the password broke. It wraps
+// one of ErrTooShort, ErrTooLong and ErrBreached.
+type ValidationError struct {
+	Err     error
+	Message string
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+type Policy struct {
+	cfg Config
+}
+
+// NewPolicy checks that the breached list can be read. The list is not
+// loaded, it is searched on disk for every check.
+func NewPolicy(cfg Config) (*Policy, error) {
+	const fn = "lib.password_policy.NewPolicy"
+
+	if cfg.BreachedListPath != "" {
+		file, err := os.Open(cfg.BreachedListPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		file.Close()
+	}
+
+	return &Policy{cfg: cfg}, nil
+}
+
+// Check returns a *ValidationError if password breaks the policy.
+// MaxLength counts bytes, bcrypt refuses anything past 72.
+func (p *Policy) Check(password string) error {
+	const fn = "lib.password_policy.Check"
+
+	if p.cfg.MinLength > 0 && utf8.RuneCountInString(password) < p.cfg.MinLength {
+		return &ValidationError{
+			Err:     ErrTooShort,
+			Message: fmt.Sprintf("password must have at least %d characters", p.cfg.MinLength),
+		}
+	}
+	if p.cfg.MaxLength > 0 && len(password) > p.cfg.MaxLength {
+		return &ValidationError{
+			Err:     ErrTooLong,
+			Message: fmt.Sprintf("password can have at most %d bytes", p.cfg.MaxLength),
+		}
+	}
+
+	if p.cfg.BreachedListPath == "" {
+		return nil
+	}
+
+	breached, err := p.breached(password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if breached {
+		return &ValidationError{
+			Err:     ErrBreached,
+			Message: "password appears in a known data breach, choose another one",
+		}
+	}
+
+	return nil
+}
+
+// breached looks the SHA-1 of password up the way the k-anonymity range
+// API does: binary search for the first line with the 5 character hash
+// prefix, then compare the suffixes of that range.
+func (p *Policy) breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix := hash[:5]
+
+	file, err := os.Open(p.cfg.BreachedListPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// Binary search for the smallest offset from which the next line has a
+	// hash >= prefix. Every line starting before lo is < prefix, the line
+	// after hi is not.
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := lineAfter(file, mid)
+		if err != nil {
+			return false, err
+		}
+
+		if line != "" && lineHash(line) < prefix {
+			lo = start + int64(len(line)) + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	start, _, err := lineAfter(file, lo)
+	if err != nil {
+		return false, err
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		h := lineHash(scanner.Text())
+		if !strings.HasPrefix(h, prefix) {
+			break
+		}
+		if h == hash {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// lineAfter returns the first full line starting at or after off, and its
+// offset. The line at off is skipped unless off starts it.
+func lineAfter(file *os.File, off int64) (int64, string, error) {
+	start := off
+	if off > 0 {
+		start = off - 1
+	}
+
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+
+	r := bufio.NewReader(file)
+	if off > 0 {
+		skipped, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return start + int64(len(skipped)), "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := r.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, "", err
+	}
+
+	return start, string(bytes.TrimSuffix(line, []byte("\n"))), nil
+}
+
+func lineHash(line string) string {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(hash)
+}
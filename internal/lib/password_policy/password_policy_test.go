@@ -0,0 +1,71 @@
+package password_policy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, hashLine(fmt.Sprintf("leaked%d", i), i+1))
+	}
+	lines = append(lines, hashLine("password1", 2427326))
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(Config{MinLength: 8, MaxLength: 72, BreachedListPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{"short", ErrTooShort},
+		{strings.Repeat("x", 73), ErrTooLong},
+		{"password1", ErrBreached},
+		{"leaked0", ErrTooShort},
+		{"leaked123", ErrBreached},
+		{"leaked499", ErrBreached},
+		{"leaked500", nil},
+		{"correct horse battery", nil},
+	}
+
+	for _, tt := range tests {
+		if err := p.Check(tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%q) error = %v; want %v", tt.password, err, tt.want)
+		}
+	}
+
+	// Every line of the list must be found, the first and the last ones
+	// included.
+	for i := 0; i < 500; i++ {
+		if breached, err := p.breached(fmt.Sprintf("leaked%d", i)); err != nil || !breached {
+			t.Fatalf("breached(leaked%d) = %v, %v; want true, nil", i, breached, err)
+		}
+	}
+}
+
+func TestNewPolicyMissingList(t *testing.T) {
+	if _, err := NewPolicy(Config{BreachedListPath: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("NewPolicy() with a missing list succeeded")
+	}
+}
+
+func hashLine(password string, count int) string {
+	sum := sha1.Sum([]byte(password))
+	return fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), count)
+}
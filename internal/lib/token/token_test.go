@@ -0,0 +1,61 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	s, err := New([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := "hash-1"
+	lookup := func(userID int64) (string, error) {
+		if userID != 42 {
+			t.Fatalf("state looked up for user %d; want 42", userID)
+		}
+		return state, nil
+	}
+
+	tok := s.Sign("reset", 42, state, time.Hour)
+
+	userID, err := s.Verify(tok, "reset", lookup)
+	if err != nil || userID != 42 {
+		t.Fatalf("Verify() = %d, %v; want 42, nil", userID, err)
+	}
+
+	tests := []struct {
+		name    string
+		tok     string
+		purpose string
+		state   string
+		want    error
+	}{
+		{"other purpose", tok, "verify", state, ErrInvalid},
+		{"state changed", tok, "reset", "hash-2", ErrInvalid},
+		{"tampered", tok[:len(tok)-2] + "AA", "reset", state, ErrInvalid},
+		{"garbage", "not-a-token", "reset", state, ErrInvalid},
+		{"expired", s.Sign("reset", 42, state, -time.Second), "reset", state, ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state = tt.state
+			if _, err := s.Verify(tt.tok, tt.purpose, lookup); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+
+	other, err := New([]byte("other secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state = "hash-1"
+	if _, err := other.Verify(tok, "reset", lookup); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() with another secret error = %v; want %v", err, ErrInvalid)
+	}
+}
@@ -0,0 +1,322 @@
+package url_validation
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	RuleScheme    = "scheme"
+	RuleDomain    = "domain"
+	RulePrivateIP = "private_ip"
+	RuleSelf      = "self_reference"
+	RuleMalicious = "malicious_host"
+)
+
+var (
+	ErrSchemeNotAllowed = errors.New("url scheme is not allowed")
+	ErrDomainNotAllowed = errors.New("url domain is not in the allow list")
+	ErrDomainDenied     = errors.New("url domain is denied")
+	ErrPrivateIP        = errors.New("url points to a private or loopback address")
+	ErrSelfReference    = errors.New("url points to the shortener itself")
+	ErrMaliciousHost    = errors.New("url host is known to be malicious")
+)
+
+// PolicyViolation tells which rule of the policy rejected the url.
+type PolicyViolation struct {
+	Rule string
+	Err  error
+}
+
+func (v *PolicyViolation) Error() string {
+	return v.Err.Error()
+}
+
+func (v *PolicyViolation) Unwrap() error {
+	return v.Err
+}
+
+// PolicyConfig configures the destination policy. Domain patterns are
+// matched with path.Match, so "*.example.com" covers every subdomain.
+// The malicious hosts file holds hex sha256 sums of lowercased host names,
+// one per line.
+type PolicyConfig struct {
+	AllowedSchemes     []string
+	AllowDomains       []string
+	DenyDomains        []string
+	BlockPrivateIPs    bool
+	OwnHosts           []string
+	MaliciousHostsPath string
+	SortQuery          bool
+}
+
+type Policy struct {
+	cfg      PolicyConfig
+	schemes  map[string]struct{}
+	ownHosts map[string]struct{}
+
+	mu        sync.RWMutex
+	malicious map[string]struct{}
+}
+
+func NewPolicy(cfg PolicyConfig) (*Policy, error) {
+	const fn = "lib.url_validation.NewPolicy"
+
+	p := &Policy{
+		cfg:      cfg,
+		schemes:  toSet(cfg.AllowedSchemes),
+		ownHosts: toSet(cfg.OwnHosts),
+	}
+
+	if err := p.ReloadMaliciousHosts(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return p, nil
+}
+
+// ReloadMaliciousHosts rereads the malicious hosts file. It is safe to call
+// while urls are being checked.
+func (p *Policy) ReloadMaliciousHosts() error {
+	const fn = "lib.url_validation.ReloadMaliciousHosts"
+
+	if p.cfg.MaliciousHostsPath == "" {
+		return nil
+	}
+
+	file, err := os.Open(p.cfg.MaliciousHostsPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	defer file.Close()
+
+	malicious := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		malicious[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	p.mu.Lock()
+	p.malicious = malicious
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Check reports whether u may be used as a destination of a short link.
+func (p *Policy) Check(u string) error {
+	const fn = "lib.url_validation.Check"
+
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, ErrNotValid)
+	}
+
+	if len(p.schemes) > 0 {
+		if _, ok := p.schemes[strings.ToLower(parsedURL.Scheme)]; !ok {
+			return violation(RuleScheme, ErrSchemeNotAllowed)
+		}
+	}
+
+	host, err := asciiHost(parsedURL.Hostname())
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if _, ok := p.ownHosts[host]; ok {
+		return violation(RuleSelf, ErrSelfReference)
+	}
+
+	if p.cfg.BlockPrivateIPs {
+		if ip := parseIP(host); ip != nil && !isPublicIP(ip) {
+			return violation(RulePrivateIP, ErrPrivateIP)
+		}
+	}
+
+	if matchAny(p.cfg.DenyDomains, host) {
+		return violation(RuleDomain, ErrDomainDenied)
+	}
+
+	if len(p.cfg.AllowDomains) > 0 && !matchAny(p.cfg.AllowDomains, host) {
+		return violation(RuleDomain, ErrDomainNotAllowed)
+	}
+
+	if p.isMalicious(host) {
+		return violation(RuleMalicious, ErrMaliciousHost)
+	}
+
+	return nil
+}
+
+// CheckDomain reports whether the host of u matches one of patterns, the
+// same way AllowDomains does. No patterns allow every host.
+func CheckDomain(u string, patterns []string) error {
+	const fn = "lib.url_validation.CheckDomain"
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, ErrNotValid)
+	}
+
+	host, err := asciiHost(parsedURL.Hostname())
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if !matchAny(patterns, host) {
+		return violation(RuleDomain, ErrDomainNotAllowed)
+	}
+
+	return nil
+}
+
+// Normalize returns the canonical form of u that is stored next to the
+// original url.
+func (p *Policy) Normalize(u string) (string, error) {
+	return Normalize(u, NormalizeOptions{SortQuery: p.cfg.SortQuery})
+}
+
+// isMalicious checks the host and all of its parent domains, so listing
+// "evil.com" also covers "www.evil.com".
+func (p *Policy) isMalicious(host string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.malicious) == 0 {
+		return false
+	}
+
+	for {
+		sum := sha256.Sum256([]byte(host))
+		if _, ok := p.malicious[hex.EncodeToString(sum[:])]; ok {
+			return true
+		}
+
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
+
+func violation(rule string, err error) error {
+	return &PolicyViolation{Rule: rule, Err: err}
+}
+
+// parseIP also understands the shorthand IPv4 forms that inet_aton and
+// browsers accept: one to four dot separated parts, each decimal, octal
+// with a leading 0 or hex with 0x, the last part filling the remaining
+// bytes (http://2130706433/, http://127.1/, http://0177.0.0.1/,
+// http://0x7f.1/).
+func parseIP(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+
+	parts := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if len(parts) > 4 {
+		return nil
+	}
+
+	var addr uint64
+	for i, part := range parts {
+		n, ok := parseIPv4Part(part)
+		if !ok {
+			return nil
+		}
+
+		// The last part covers all bytes not given before it.
+		bits := 8
+		if i == len(parts)-1 {
+			bits = 8 * (4 - i)
+		}
+		if n >= 1<<bits {
+			return nil
+		}
+		addr = addr<<bits | n
+	}
+
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
+
+func parseIPv4Part(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(part) > 1 && (part[:2] == "0x" || part[:2] == "0X"):
+		base, part = 16, part[2:]
+		if part == "" {
+			return 0, true
+		}
+	case len(part) > 1 && part[0] == '0':
+		base, part = 8, part[1:]
+	}
+
+	// ParseUint would also take signs, underscores and other prefixes.
+	for _, c := range strings.ToLower(part) {
+		if !strings.ContainsRune("0123456789abcdef"[:base], c) {
+			return 0, false
+		}
+	}
+
+	n, err := strconv.ParseUint(part, base, 32)
+	return n, err == nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+func matchAny(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v != "" {
+			set[v] = struct{}{}
+		}
+	}
+
+	return set
+}
@@ -0,0 +1,155 @@
+package url_validation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	sum := sha256.Sum256([]byte("evil.example"))
+	malicious := filepath.Join(t.TempDir(), "malicious.txt")
+	if err := os.WriteFile(malicious, []byte(hex.EncodeToString(sum[:])+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(PolicyConfig{
+		AllowedSchemes:     []string{"http", "https"},
+		DenyDomains:        []string{"localhost", "*.blocked.com"},
+		BlockPrivateIPs:    true,
+		OwnHosts:           []string{"sho.rt"},
+		MaliciousHostsPath: malicious,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{url: "https://example.com/path", want: nil},
+		{url: "javascript:alert(1)", want: ErrSchemeNotAllowed},
+		{url: "file:///etc/passwd", want: ErrSchemeNotAllowed},
+		{url: "http://127.0.0.1/", want: ErrPrivateIP},
+		{url: "http://2130706433/", want: ErrPrivateIP},
+		{url: "http://[::1]:8080/", want: ErrPrivateIP},
+		{url: "http://10.1.2.3/", want: ErrPrivateIP},
+		{url: "http://127.1/", want: ErrPrivateIP},
+		{url: "http://0177.0.0.1/", want: ErrPrivateIP},
+		{url: "http://0x7f.1/", want: ErrPrivateIP},
+		{url: "http://10.0x10.1/", want: ErrPrivateIP},
+		{url: "http://100.64.0.1/", want: ErrPrivateIP},
+		{url: "http://100.127.255.254/", want: ErrPrivateIP},
+		{url: "http://100.128.0.1/", want: nil},
+		{url: "http://8.8.8.8/", want: nil},
+		{url: "http://LOCALHOST/", want: ErrDomainDenied},
+		{url: "https://a.b.blocked.com/", want: ErrDomainDenied},
+		{url: "https://sho.rt/abc", want: ErrSelfReference},
+		{url: "https://www.evil.example/", want: ErrMaliciousHost},
+	}
+
+	for _, tt := range tests {
+		err := p.Check(tt.url)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("Check(%q) = %v; want nil", tt.url, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Check(%q) = %v; want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "127.0.0.1", want: "127.0.0.1"},
+		{host: "2130706433", want: "127.0.0.1"},
+		{host: "0x7f000001", want: "127.0.0.1"},
+		{host: "017700000001", want: "127.0.0.1"},
+		{host: "127.1", want: "127.0.0.1"},
+		{host: "127.0.1", want: "127.0.0.1"},
+		{host: "0177.0.0.1", want: "127.0.0.1"},
+		{host: "0x7f.1", want: "127.0.0.1"},
+		{host: "0X7F.0.0.0x1", want: "127.0.0.1"},
+		{host: "192.168.257", want: "192.168.1.1"},
+		{host: "127.0.0.1.", want: "127.0.0.1"},
+		{host: "0", want: "0.0.0.0"},
+		{host: "::1", want: "::1"},
+		{host: "256.1", want: ""},
+		{host: "1.2.3.256", want: ""},
+		{host: "08.1", want: ""},
+		{host: "0x1g.1", want: ""},
+		{host: "+1.2", want: ""},
+		{host: "1_0.1", want: ""},
+		{host: "1..2", want: ""},
+		{host: "1.2.3.4.5", want: ""},
+		{host: "4294967296", want: ""},
+		{host: "example.com", want: ""},
+	}
+
+	for _, tt := range tests {
+		ip := parseIP(tt.host)
+		got := ""
+		if ip != nil {
+			got = ip.String()
+		}
+		if got != tt.want {
+			t.Errorf("parseIP(%q) = %q; want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAllowDomains(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{AllowDomains: []string{"example.com", "*.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Check("https://docs.example.com/"); err != nil {
+		t.Errorf("Check allowed domain: %v", err)
+	}
+	if err := p.Check("https://example.org/"); !errors.Is(err, ErrDomainNotAllowed) {
+		t.Errorf("Check other domain = %v; want %v", err, ErrDomainNotAllowed)
+	}
+}
+
+func TestCheckDomain(t *testing.T) {
+	patterns := []string{"example.com", "*.Example.com"}
+
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{url: "https://example.com/", want: nil},
+		{url: "https://docs.EXAMPLE.com/a", want: nil},
+		{url: "https://example.org/", want: ErrDomainNotAllowed},
+		{url: "https://notexample.com/", want: ErrDomainNotAllowed},
+		{url: "https:///path", want: ErrNotValid},
+	}
+
+	for _, tt := range tests {
+		err := CheckDomain(tt.url, patterns)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("CheckDomain(%q) = %v; want nil", tt.url, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("CheckDomain(%q) = %v; want %v", tt.url, err, tt.want)
+		}
+	}
+
+	if err := CheckDomain("https://anything.net/", nil); err != nil {
+		t.Errorf("CheckDomain() without patterns = %v; want nil", err)
+	}
+}
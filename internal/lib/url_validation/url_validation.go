@@ -2,10 +2,12 @@ package url_validation
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"net/url"
-	"regexp"
 	"strings"
-	"fmt"
+
+	"golang.org/x/net/idna"
 )
 
 var (
@@ -14,26 +16,187 @@ var (
 	ErrEmpty         = errors.New("url is empty")
 )
 
+// NormalizeOptions controls the optional steps of Normalize.
+type NormalizeOptions struct {
+	SortQuery bool
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// IsValidURL accepts absolute urls with a host. Percent-encoding, fragments,
+// IPv6 literals and internationalized domain names are allowed.
 func IsValidURL(u string) error {
 	const fn = "lib.url_validation.IsValidURL"
 
-	if strings.Contains(u, " ") {
+	if u == "" {
+		return fmt.Errorf("%s: %w", fn, ErrEmpty)
+	}
+
+	if strings.ContainsAny(u, " \t\r\n") {
 		return fmt.Errorf("%s: %w", fn, ErrContainsSpace)
 	}
 
-	re := regexp.MustCompile(`[<>#%"{}|\^~\[]`)
-	if re.MatchString(u) {
-		return fmt.Errorf("%s: %w", fn, ErrNotValid)
+	if _, _, err := parse(u); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
 	}
 
-	parsedURL, err := url.ParseRequestURI(u)
+	return nil
+}
+
+// Normalize returns the canonical form of u: lowercased scheme and host,
+// punycode host, default port dropped, percent-encoding normalized and,
+// optionally, query parameters sorted by key.
+func Normalize(u string, opts NormalizeOptions) (string, error) {
+	const fn = "lib.url_validation.Normalize"
+
+	parsedURL, host, err := parse(u)
 	if err != nil {
-		return fmt.Errorf("%s: %w", fn, ErrNotValid)
+		return "", fmt.Errorf("%s: %w", fn, err)
 	}
 
-	if parsedURL.Scheme == "" {
-		return fmt.Errorf("%s: %w", fn, ErrEmpty)
+	scheme := strings.ToLower(parsedURL.Scheme)
+
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + ip.String() + "]"
 	}
 
-	return nil
+	if port := parsedURL.Port(); port != "" && port != defaultPorts[scheme] {
+		host = host + ":" + port
+	}
+
+	escapedPath := normalizeEscapes(parsedURL.EscapedPath())
+	if escapedPath == "" && (scheme == "http" || scheme == "https") {
+		escapedPath = "/"
+	}
+
+	rawQuery := parsedURL.RawQuery
+	if opts.SortQuery {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", fn, ErrNotValid)
+		}
+		rawQuery = query.Encode()
+	} else {
+		rawQuery = normalizeEscapes(rawQuery)
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	if parsedURL.User != nil {
+		b.WriteString(parsedURL.User.String())
+		b.WriteString("@")
+	}
+	b.WriteString(host)
+	b.WriteString(escapedPath)
+	if rawQuery != "" {
+		b.WriteString("?")
+		b.WriteString(rawQuery)
+	}
+	if parsedURL.Fragment != "" {
+		b.WriteString("#")
+		b.WriteString(normalizeEscapes(parsedURL.EscapedFragment()))
+	}
+
+	return b.String(), nil
+}
+
+// parse checks u and returns it parsed together with its ASCII, lowercased
+// host name (without brackets and port).
+func parse(u string) (*url.URL, string, error) {
+	if strings.ContainsAny(u, "<>\"{}|\\^`") {
+		return nil, "", ErrNotValid
+	}
+
+	parsedURL, err := url.Parse(u)
+	if err != nil {
+		return nil, "", ErrNotValid
+	}
+
+	if parsedURL.Scheme == "" || parsedURL.Opaque != "" {
+		return nil, "", ErrNotValid
+	}
+
+	host, err := asciiHost(parsedURL.Hostname())
+	if err != nil {
+		return nil, "", err
+	}
+
+	return parsedURL, host, nil
+}
+
+func asciiHost(hostname string) (string, error) {
+	hostname = strings.TrimSuffix(hostname, ".")
+	if hostname == "" {
+		return "", ErrNotValid
+	}
+
+	if ip := net.ParseIP(hostname); ip != nil {
+		return strings.ToLower(hostname), nil
+	}
+	if strings.Contains(hostname, ":") {
+		return "", ErrNotValid
+	}
+
+	host, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return "", ErrNotValid
+	}
+
+	return strings.ToLower(host), nil
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters and
+// uppercases the hex digits of the remaining escapes (RFC 3986, 6.2.2).
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' ||
+		'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
 }
@@ -0,0 +1,66 @@
+package url_validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsValidURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{url: "https://example.com/a%20b?q=1#section", want: nil},
+		{url: "https://example.com/~user/", want: nil},
+		{url: "http://[2001:db8::1]:8080/path", want: nil},
+		{url: "https://пример.рф/путь", want: nil},
+		{url: "", want: ErrEmpty},
+		{url: "https://example.com/a b", want: ErrContainsSpace},
+		{url: "https://example.com/<script>", want: ErrNotValid},
+		{url: "https://example.com/%zz", want: ErrNotValid},
+		{url: "example.com/path", want: ErrNotValid},
+		{url: "mailto:user@example.com", want: ErrNotValid},
+		{url: "http://[::1/", want: ErrNotValid},
+	}
+
+	for _, tt := range tests {
+		err := IsValidURL(tt.url)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("IsValidURL(%q) = %v; want nil", tt.url, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("IsValidURL(%q) = %v; want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		url       string
+		sortQuery bool
+		want      string
+	}{
+		{url: "HTTP://Example.COM:80", want: "http://example.com/"},
+		{url: "https://example.com:443/a?b=1", want: "https://example.com/a?b=1"},
+		{url: "https://example.com:8443/", want: "https://example.com:8443/"},
+		{url: "https://пример.рф/", want: "https://xn--e1afmkfd.xn--p1ai/"},
+		{url: "http://[2001:DB8:0::1]:80/", want: "http://[2001:db8::1]/"},
+		{url: "https://example.com/%7euser/%2f%e2%82%ac", want: "https://example.com/~user/%2F%E2%82%AC"},
+		{url: "https://example.com/?b=2&a=1&a=0#Top", sortQuery: true, want: "https://example.com/?a=1&a=0&b=2#Top"},
+		{url: "https://example.com/?b=2&a=1", want: "https://example.com/?b=2&a=1"},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.url, NormalizeOptions{SortQuery: tt.sortQuery})
+		if err != nil {
+			t.Errorf("Normalize(%q) error = %v", tt.url, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q; want %q", tt.url, got, tt.want)
+		}
+	}
+}
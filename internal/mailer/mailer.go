@@ -0,0 +1,183 @@
+// Package mailer sends the emails of the account flows. SMTP delivers
+// them for real, File and Log keep them local for development and tests.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TransportSMTP = "smtp"
+	TransportFile = "file"
+	TransportLog  = "log"
+)
+
+var (
+	ErrNoTransport      = errors.New("mail transport is not set")
+	ErrUnknownTransport = errors.New("unknown mail transport")
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type Config struct {
+	Transport string
+	From      string
+	FilePath  string
+	SMTP      SMTPConfig
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// New returns the mailer for cfg.Transport.
+func New(log *slog.Logger, cfg Config) (Mailer, error) {
+	const fn = "mailer.New"
+
+	switch cfg.Transport {
+	case TransportSMTP:
+		return NewSMTP(cfg.From, cfg.SMTP), nil
+	case TransportFile:
+		return NewFile(cfg.From, cfg.FilePath), nil
+	case TransportLog:
+		return NewLog(log, cfg.From), nil
+	case "":
+		return nil, fmt.Errorf("%s: %w", fn, ErrNoTransport)
+	}
+
+	return nil, fmt.Errorf("%s: %w: %q", fn, ErrUnknownTransport, cfg.Transport)
+}
+
+// SMTP sends through a relay. net/smtp upgrades to TLS with STARTTLS when
+// the server offers it and refuses to send credentials in the clear.
+type SMTP struct {
+	from string
+	cfg  SMTPConfig
+}
+
+func NewSMTP(from string, cfg SMTPConfig) *SMTP {
+	return &SMTP{from: from, cfg: cfg}
+}
+
+func (m *SMTP) Send(ctx context.Context, msg Message) error {
+	const fn = "mailer.SMTP.Send"
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+
+	// smtp.SendMail takes no context, the send is abandoned instead.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.from, []string{msg.To}, format(m.from, msg))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", fn, ctx.Err())
+	}
+}
+
+// File appends every message to a file, separated by blank lines.
+type File struct {
+	from string
+	path string
+	mu   sync.Mutex
+}
+
+func NewFile(from, path string) *File {
+	return &File{from: from, path: path}
+}
+
+func (m *File) Send(_ context.Context, msg Message) error {
+	const fn = "mailer.File.Send"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(format(m.from, msg), "\r\n\r\n"...)); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// Log writes every message to the log. Links in the body carry tokens,
+// do not use it where others read the logs.
+type Log struct {
+	log  *slog.Logger
+	from string
+}
+
+func NewLog(log *slog.Logger, from string) *Log {
+	return &Log{log: log, from: from}
+}
+
+func (m *Log) Send(_ context.Context, msg Message) error {
+	m.log.Info("mail sent",
+		slog.String("fn", "mailer.Log.Send"),
+		slog.String("from", m.from),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+	return nil
+}
+
+// format renders msg as an RFC 5322 message.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+
+	header := func(name, value string) {
+		// Header values come from users, line breaks would inject headers.
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", msg.Subject)
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+
+	m, err := New(slog.Default(), Config{Transport: TransportFile, From: "noreply@sho.rt", FilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subject := range []string{"first", "second\r\nBcc: evil@example.com"} {
+		err := m.Send(context.Background(), Message{To: "amy@example.com", Subject: subject, Body: "line 1\nline 2"})
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+
+	for _, want := range []string{"From: noreply@sho.rt\r\n", "Subject: first\r\n", "line 1\r\nline 2", "Subject: secondBcc: evil@example.com\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("mail file does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "\r\nBcc:") {
+		t.Errorf("header injected into the message:\n%s", got)
+	}
+}
+
+func TestNewUnknownTransport(t *testing.T) {
+	if _, err := New(slog.Default(), Config{Transport: "pigeon"}); !errors.Is(err, ErrUnknownTransport) {
+		t.Errorf("New() error = %v; want %v", err, ErrUnknownTransport)
+	}
+}
+
+func TestNewNoTransport(t *testing.T) {
+	if _, err := New(slog.Default(), Config{}); !errors.Is(err, ErrNoTransport) {
+		t.Errorf("New() error = %v; want %v", err, ErrNoTransport)
+	}
+}
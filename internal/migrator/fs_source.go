@@ -0,0 +1,91 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/golang-migrate/migrate/source"
+)
+
+// fsSource is a migrate source driver over an fs.FS, so the embedded
+// migrations can be used without touching the disk.
+type fsSource struct {
+	fsys       fs.FS
+	migrations *source.Migrations
+}
+
+func newFSSource(fsys fs.FS) (*fsSource, error) {
+	const fn = "migrator.newFSSource"
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	migrations := source.NewMigrations()
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		m, err := source.Parse(e.Name())
+		if err != nil {
+			// not a migration file
+			continue
+		}
+
+		if !migrations.Append(m) {
+			return nil, fmt.Errorf("%s: duplicate migration file %s", fn, e.Name())
+		}
+	}
+
+	return &fsSource{fsys: fsys, migrations: migrations}, nil
+}
+
+func (s *fsSource) Open(url string) (source.Driver, error) {
+	return nil, errors.New("fs source can not be opened by url")
+}
+
+func (s *fsSource) Close() error {
+	return nil
+}
+
+func (s *fsSource) First() (uint, error) {
+	if v, ok := s.migrations.First(); ok {
+		return v, nil
+	}
+	return 0, os.ErrNotExist
+}
+
+func (s *fsSource) Prev(version uint) (uint, error) {
+	if v, ok := s.migrations.Prev(version); ok {
+		return v, nil
+	}
+	return 0, os.ErrNotExist
+}
+
+func (s *fsSource) Next(version uint) (uint, error) {
+	if v, ok := s.migrations.Next(version); ok {
+		return v, nil
+	}
+	return 0, os.ErrNotExist
+}
+
+func (s *fsSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	if m, ok := s.migrations.Up(version); ok {
+		f, err := s.fsys.Open(m.Raw)
+		return f, m.Identifier, err
+	}
+	return nil, "", os.ErrNotExist
+}
+
+func (s *fsSource) ReadDown(version uint) (io.ReadCloser, string, error) {
+	if m, ok := s.migrations.Down(version); ok {
+		f, err := s.fsys.Open(m.Raw)
+		return f, m.Identifier, err
+	}
+	return nil, "", os.ErrNotExist
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package migrator
+
+import "os"
+
+// flock is not available here, concurrent instances are not guarded.
+func tryLock(f *os.File, shared bool) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
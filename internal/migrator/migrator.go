@@ -0,0 +1,298 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate"
+	_ "github.com/golang-migrate/migrate/database/sqlite3"
+	"github.com/golang-migrate/migrate/source"
+	_ "github.com/golang-migrate/migrate/source/file"
+
+	"url-shorter/migrations"
+)
+
+var (
+	ErrNoChange       = migrate.ErrNoChange
+	ErrDirty          = errors.New("schema is dirty, fix it and force the version")
+	ErrSchemaTooNew   = errors.New("schema is newer than this binary understands")
+	ErrSchemaOutdated = errors.New("schema has pending migrations")
+	ErrLockTimeout    = errors.New("timeout waiting for migration lock")
+)
+
+type Migrator struct {
+	m *migrate.Migrate
+	// openSource opens a second reader of the same migrations for Status
+	// and Latest, migrate.Migrate does not expose its own.
+	openSource func() (source.Driver, error)
+}
+
+// MigrationStatus describes one migration found in the source.
+type MigrationStatus struct {
+	Version uint   `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+// New opens the migrations found at sourceURL (e.g. "file://./migrations")
+// for the SQLite database at storagePath.
+func New(sourceURL, storagePath string) (*Migrator, error) {
+	const fn = "migrator.New"
+
+	m, err := migrate.New(sourceURL, "sqlite3://"+storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return &Migrator{
+		m: m,
+		openSource: func() (source.Driver, error) {
+			return source.Open(sourceURL)
+		},
+	}, nil
+}
+
+// NewEmbedded uses the migrations compiled into the binary.
+func NewEmbedded(storagePath string) (*Migrator, error) {
+	return NewFromFS(migrations.FS, storagePath)
+}
+
+func NewFromFS(fsys fs.FS, storagePath string) (*Migrator, error) {
+	const fn = "migrator.NewFromFS"
+
+	src, err := newFSSource(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("embed", src, "sqlite3://"+storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return &Migrator{
+		m: m,
+		openSource: func() (source.Driver, error) {
+			return newFSSource(fsys)
+		},
+	}, nil
+}
+
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+// Up applies n pending migrations, all of them when n is 0.
+func (m *Migrator) Up(n int) error {
+	if n == 0 {
+		return m.m.Up()
+	}
+	return m.m.Steps(n)
+}
+
+// Down rolls back the last n migrations.
+func (m *Migrator) Down(n int) error {
+	const fn = "migrator.Down"
+
+	if n < 1 {
+		return fmt.Errorf("%s: invalid number of migrations %d", fn, n)
+	}
+	return m.m.Steps(-n)
+}
+
+// DownAll rolls back every applied migration, dropping all tables.
+func (m *Migrator) DownAll() error {
+	return m.m.Down()
+}
+
+// Goto migrates up or down to version v.
+func (m *Migrator) Goto(v uint) error {
+	return m.m.Migrate(v)
+}
+
+// Force sets the version without running migrations and clears the dirty
+// flag; -1 means no migration applied.
+func (m *Migrator) Force(v int) error {
+	return m.m.Force(v)
+}
+
+// Version returns the applied version, 0 when nothing is applied yet.
+func (m *Migrator) Version() (uint, bool, error) {
+	v, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return v, dirty, err
+}
+
+// Status lists every migration of the source and whether it is applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	const fn = "migrator.Status"
+
+	current, _, err := m.Version()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	src, err := m.openSource()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	defer src.Close()
+
+	var statuses []MigrationStatus
+
+	v, err := src.First()
+	for err == nil {
+		r, name, readErr := src.ReadUp(v)
+		if readErr != nil {
+			return nil, fmt.Errorf("%s: %w", fn, readErr)
+		}
+		r.Close()
+
+		statuses = append(statuses, MigrationStatus{
+			Version: v,
+			Name:    name,
+			Applied: v <= current,
+		})
+
+		v, err = src.Next(v)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return statuses, nil
+}
+
+// Latest returns the newest version known to the source.
+func (m *Migrator) Latest() (uint, error) {
+	const fn = "migrator.Latest"
+
+	statuses, err := m.Status()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if len(statuses) == 0 {
+		return 0, nil
+	}
+
+	return statuses[len(statuses)-1].Version, nil
+}
+
+// EmbeddedLatest returns the newest version of the migrations compiled
+// into the binary, the schema version this build expects.
+func EmbeddedLatest() (uint, error) {
+	const fn = "migrator.EmbeddedLatest"
+
+	src, err := newFSSource(migrations.FS)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	v, err := src.First()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	for err == nil {
+		var next uint
+		next, err = src.Next(v)
+		if err == nil {
+			v = next
+		}
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return v, nil
+}
+
+// Check compares the applied version with the source. It returns
+// ErrDirty, ErrSchemaTooNew or ErrSchemaOutdated when they do not match.
+func (m *Migrator) Check() error {
+	const fn = "migrator.Check"
+
+	current, dirty, err := m.Version()
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if dirty {
+		return fmt.Errorf("%s: version %d: %w", fn, current, ErrDirty)
+	}
+
+	latest, err := m.Latest()
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	switch {
+	case current > latest:
+		return fmt.Errorf("%s: version %d, latest known %d: %w", fn, current, latest, ErrSchemaTooNew)
+	case current < latest:
+		return fmt.Errorf("%s: version %d, latest known %d: %w", fn, current, latest, ErrSchemaOutdated)
+	}
+
+	return nil
+}
+
+// Lock takes an exclusive lock on path so that only one process migrates
+// the database at a time. It waits up to timeout for other holders.
+func Lock(path string, timeout time.Duration) (unlock func() error, err error) {
+	const fn = "migrator.Lock"
+
+	unlock, err = lockFile(path, timeout, false)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return unlock, nil
+}
+
+// LockShared takes a shared lock on path. Any number of shared holders
+// coexist, while Lock on the same path waits until all of them are gone.
+func LockShared(path string, timeout time.Duration) (unlock func() error, err error) {
+	const fn = "migrator.LockShared"
+
+	unlock, err = lockFile(path, timeout, true)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return unlock, nil
+}
+
+func lockFile(path string, timeout time.Duration, shared bool) (unlock func() error, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLock(f, shared)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return func() error {
+		defer f.Close()
+		return unlockFile(f)
+	}, nil
+}
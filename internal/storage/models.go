@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Roles a user can have. Members manage their own links, read-only users
+// can only look at them, admins manage everything.
+const (
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "read-only"
+)
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleMember, RoleReadOnly:
+		return true
+	}
+	return false
+}
+
+// User is an account. EmailVerified tells whether the user proved to own
+// Email, it is reset whenever the email changes. TOTPEnabled users log in
+// with a second factor.
+type User struct {
+	ID            int64
+	Username      string
+	Email         string
+	EmailVerified bool
+	TOTPEnabled   bool
+	Role          string
+	DedupURLs     bool
+	Disabled      bool
+	CreatedAt     time.Time
+}
+
+// UserUpdate holds the user fields to change; nil fields are left as is.
+// A new Email is not verified.
+type UserUpdate struct {
+	Username  *string
+	Email     *string
+	DedupURLs *bool
+}
+
+// DefaultClicks mirrors the default of the url.clicks column.
+const DefaultClicks = 3
+
+// NoClicksLeft saves a link whose redirects are used up, as zero Clicks
+// already means DefaultClicks.
+const NoClicksLeft = -1
+
+// URL is a short link owned by a user or, when OrgID is set, by an org.
+// Clicks is the number of redirects left; zero means DefaultClicks when
+// saving. A zero ExpiresAt never expires. ClickCount is only filled when
+// explicitly requested.
+type URL struct {
+	ID            int64
+	Alias         string
+	URL           string
+	NormalizedURL string
+	UserID        int64
+	OrgID         int64
+	Clicks        int
+	ExpiresAt     time.Time
+	Tags          []string
+	ClickCount    int64
+}
+
+// Click is a recorded redirect of a link.
+type Click struct {
+	URLID     int64
+	Alias     string
+	IP        string
+	UserAgent string
+	Country   string
+	Device    string
+	Browser   string
+	Referrer  string
+	CreatedAt time.Time
+}
+
+// URLUpdate holds the link fields to change; nil fields are left as is.
+// NormalizedURL must be set together with URL.
+type URLUpdate struct {
+	URL           *string
+	NormalizedURL *string
+	Clicks        *int
+	ExpiresAt     *time.Time
+	Tags          *[]string
+}
+
+// ClickStats sums up the redirects of a link. ByDay covers the last days
+// with at least one click, oldest first.
+type ClickStats struct {
+	Total       int64
+	LastClickAt time.Time
+	ByDay       []DayCount
+	Countries   []Count
+	Referrers   []Count
+}
+
+type DayCount struct {
+	Day    string
+	Clicks int64
+}
+
+type Count struct {
+	Value  string
+	Clicks int64
+}
+
+// SaveResult is the outcome of saving one link of a batch.
+type SaveResult struct {
+	ID  int64
+	Err error
+}
+
+// URLFilter narrows ListURLs. Query matches aliases and destinations as a
+// substring; zero fields do not filter.
+// WithClickCount fills URL.ClickCount.
+type URLFilter struct {
+	UserID         int64
+	OrgID          int64
+	Query          string
+	Limit          int
+	WithClickCount bool
+}
+
+// Roles inside an org. Every member works with the links of the org,
+// admins also manage members, invites and the policy, owners can
+// additionally appoint owners and delete the org.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// ValidOrgRole reports whether role is one of the known org roles.
+func ValidOrgRole(role string) bool {
+	switch role {
+	case OrgRoleOwner, OrgRoleAdmin, OrgRoleMember:
+		return true
+	}
+	return false
+}
+
+// Org is a shared workspace of links.
+type Org struct {
+	ID        int64
+	Name      string
+	Policy    OrgPolicy
+	CreatedAt time.Time
+}
+
+// OrgPolicy applies to every link of the org. ClickBudget is the default
+// and the maximum number of redirects, LinkTTL the default and the
+// maximum lifetime, AllowedDomains the destinations links may point to,
+// matched like url_validation domain patterns. Zero values do not limit.
+type OrgPolicy struct {
+	ClickBudget    int
+	LinkTTL        time.Duration
+	AllowedDomains []string
+}
+
+type OrgMember struct {
+	OrgID     int64
+	UserID    int64
+	Username  string
+	Email     string
+	Role      string
+	CreatedAt time.Time
+}
+
+// OrgMembership is an org seen from one of its members.
+type OrgMembership struct {
+	Org  Org
+	Role string
+}
+
+// OrgInvite lets the user with Email join the org with Role. It is
+// redeemed once, before ExpiresAt.
+type OrgInvite struct {
+	ID         int64
+	OrgID      int64
+	Email      string
+	Role       string
+	InvitedBy  int64
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	AcceptedAt time.Time
+}
+
+type Stats struct {
+	Users         int64
+	DisabledUsers int64
+	URLs          int64
+	ExpiredURLs   int64
+	ExhaustedURLs int64
+	Clicks        int64
+}
+
+// AuditEntry is one record of the audit log. Details holds the action
+// specific data as JSON, e.g. the old and new values of a changed link.
+// Hash covers PrevHash and every other field but ID, chaining each entry
+// to the one before it.
+type AuditEntry struct {
+	ID         int64
+	CreatedAt  time.Time
+	ActorID    int64
+	Actor      string
+	Action     string
+	Target     string
+	RemoteAddr string
+	RequestID  string
+	Details    json.RawMessage
+	PrevHash   string
+	Hash       string
+}
+
+// ComputeHash returns the hash the entry must carry given its PrevHash.
+func (e AuditEntry) ComputeHash() string {
+	// A struct keeps the field order, and so the hash, stable.
+	b, _ := json.Marshal(struct {
+		PrevHash   string `json:"prev_hash"`
+		CreatedAt  string `json:"created_at"`
+		ActorID    int64  `json:"actor_id"`
+		Actor      string `json:"actor"`
+		Action     string `json:"action"`
+		Target     string `json:"target"`
+		RemoteAddr string `json:"remote_addr"`
+		RequestID  string `json:"request_id"`
+		Details    string `json:"details"`
+	}{
+		PrevHash:   e.PrevHash,
+		CreatedAt:  e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ActorID:    e.ActorID,
+		Actor:      e.Actor,
+		Action:     e.Action,
+		Target:     e.Target,
+		RemoteAddr: e.RemoteAddr,
+		RequestID:  e.RequestID,
+		Details:    string(e.Details),
+	})
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter narrows ListAudit; zero fields do not filter. Entries come
+// oldest first, AfterID pages through them.
+type AuditFilter struct {
+	Action  string
+	ActorID int64
+	Actor   string
+	Target  string
+	Since   time.Time
+	Until   time.Time
+	AfterID int64
+	Limit   int
+}
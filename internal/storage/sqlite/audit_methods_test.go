@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"url-shorter/internal/storage"
+)
+
+func appendEntries(t *testing.T, s *Storage, actions ...string) {
+	t.Helper()
+
+	for _, action := range actions {
+		_, err := s.AppendAudit(context.Background(), storage.AuditEntry{
+			Actor:   "amy",
+			Action:  action,
+			Target:  "alias",
+			Details: []byte(`{"new":{"url":"https://example.com"}}`),
+		})
+		if err != nil {
+			t.Fatalf("AppendAudit() error = %v", err)
+		}
+	}
+}
+
+func TestAuditChain(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	appendEntries(t, s, "link.create", "link.delete", "link.create")
+
+	checked, head, err := s.VerifyAudit(ctx)
+	if err != nil {
+		t.Fatalf("VerifyAudit() error = %v", err)
+	}
+	if checked != 3 || head == "" {
+		t.Errorf("VerifyAudit() = %d, %q; want 3 entries and a head hash", checked, head)
+	}
+
+	var got []string
+	err = s.ListAudit(ctx, storage.AuditFilter{Action: "link.create", AfterID: 1}, func(e storage.AuditEntry) error {
+		got = append(got, e.Action)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("ListAudit() returned %d entries; want 1", len(got))
+	}
+
+	if _, err := s.db.Exec("UPDATE audit_log SET target = 'other' WHERE id = 2"); err == nil {
+		t.Error("audit_log accepted an UPDATE")
+	}
+}
+
+func TestAuditTampering(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"changed", "UPDATE audit_log SET details = '{}' WHERE id = 2"},
+		{"removed", "DELETE FROM audit_log WHERE id = 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, "")
+			appendEntries(t, s, "a", "b", "c")
+
+			// Someone with write access to the file can drop the triggers,
+			// the hash chain must still give them away.
+			for _, q := range []string{"DROP TRIGGER audit_log_no_update", "DROP TRIGGER audit_log_no_delete", tt.query} {
+				if _, err := s.db.Exec(q); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, _, err := s.VerifyAudit(context.Background())
+			if !errors.Is(err, storage.ErrAuditTampered) {
+				t.Errorf("VerifyAudit() error = %v; want %v", err, storage.ErrAuditTampered)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+)
+
+// Backup writes a consistent copy of the database to path with VACUUM INTO.
+// It runs online, readers and writers are not blocked for its duration.
+// The file at path must not exist.
+func (s *Storage) Backup(ctx context.Context, path string) error {
+	const fn = "storage.sqlite.Backup"
+
+	ctx, done := startOp(ctx, fn, "VACUUM", s.opts.BulkTimeout)
+	defer done()
+
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
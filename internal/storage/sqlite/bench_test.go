@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"url-shorter/internal/storage"
+)
+
+// go test -run=^$ -bench=. -benchmem ./internal/storage/sqlite
+// The Unprepared variants run the same queries the way the storage did
+// before statements were prepared once, to show the difference.
+
+// seedURLs stores n links with aliases "a0".."a<n-1>" that never run out
+// of clicks during the benchmark.
+func seedURLs(b *testing.B, s *Storage, n int) {
+	b.Helper()
+
+	urls := make([]storage.URL, n)
+	for i := range urls {
+		urls[i] = storage.URL{
+			Alias:  "a" + strconv.Itoa(i),
+			URL:    "https://example.com/" + strconv.Itoa(i),
+			Clicks: 1 << 30,
+		}
+	}
+
+	if _, err := s.SaveURLs(context.Background(), urls); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkGetURL(b *testing.B) {
+	const links = 1000
+
+	ctx := context.Background()
+
+	b.Run("Prepared", func(b *testing.B) {
+		s := newTestStorage(b, "")
+		seedURLs(b, s, links)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := s.GetURL(ctx, "a"+strconv.Itoa(i%links)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Unprepared", func(b *testing.B) {
+		s := newTestStorage(b, "")
+		seedURLs(b, s, links)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			tx, err := s.db.BeginTx(ctx, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			stmt, err := tx.PrepareContext(ctx, `
+				UPDATE url
+				SET clicks = clicks - 1
+				WHERE alias = ? AND clicks > 0 AND (expires_at IS NULL OR expires_at > ?)
+				RETURNING url`)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var u string
+			if err := stmt.QueryRowContext(ctx, "a"+strconv.Itoa(i%links), time.Now().UTC()).Scan(&u); err != nil {
+				b.Fatal(err)
+			}
+			stmt.Close()
+
+			if err := tx.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("PreparedParallel", func(b *testing.B) {
+		s := newTestStorage(b, "")
+		seedURLs(b, s, links)
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				_, err := s.GetURL(ctx, "a"+strconv.Itoa(i%links))
+				if err != nil && !errors.Is(err, storage.ErrURLNotFound) {
+					b.Error(err)
+					return
+				}
+				i++
+			}
+		})
+	})
+}
+
+func BenchmarkSaveURL(b *testing.B) {
+	ctx := context.Background()
+
+	newURL := func(i int) storage.URL {
+		return storage.URL{
+			Alias: "s" + strconv.Itoa(i),
+			URL:   "https://example.com/" + strconv.Itoa(i),
+		}
+	}
+
+	b.Run("Prepared", func(b *testing.B) {
+		s := newTestStorage(b, "")
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := s.SaveURL(ctx, newURL(i)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Unprepared", func(b *testing.B) {
+		s := newTestStorage(b, "")
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			stmt, err := s.db.PrepareContext(ctx, insertURLQuery)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := stmt.ExecContext(ctx, insertURLArgs(newURL(i))...); err != nil {
+				b.Fatal(err)
+			}
+			stmt.Close()
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+func (s *Storage) Ping(ctx context.Context) error {
+	const fn = "storage.sqlite.Ping"
+
+	ctx, done := startOp(ctx, fn, "PING", s.opts.ReadTimeout)
+	defer done()
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// SchemaVersion reads the version recorded by the migrator, zero when no
+// migration has been applied.
+func (s *Storage) SchemaVersion(ctx context.Context) (version uint, dirty bool, err error) {
+	const fn = "storage.sqlite.SchemaVersion"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	err = s.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return version, dirty, nil
+}
@@ -0,0 +1,442 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"url-shorter/internal/storage"
+)
+
+const orgColumns = "org.id, org.name, org.click_budget, org.link_ttl, org.allowed_domains, org.created_at"
+
+// scanOrg reads orgColumns followed by any extra columns.
+func scanOrg(row rowScanner, extra ...any) (storage.Org, error) {
+	var (
+		org     storage.Org
+		ttl     int64
+		domains string
+	)
+
+	dest := append([]any{&org.ID, &org.Name, &org.Policy.ClickBudget, &ttl, &domains, &org.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return storage.Org{}, err
+	}
+	org.Policy.LinkTTL = time.Duration(ttl) * time.Second
+	// Domains are stored like tags, patterns can not contain commas.
+	org.Policy.AllowedDomains = splitTags(domains)
+
+	return org, nil
+}
+
+// CreateOrg creates the org with the user as its only owner.
+func (s *Storage) CreateOrg(ctx context.Context, name string, ownerID int64) (storage.Org, error) {
+	const fn = "storage.sqlite.CreateOrg"
+
+	ctx, done := startOp(ctx, fn, "INSERT", s.opts.WriteTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Org{}, fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	org := storage.Org{Name: name, CreatedAt: time.Now().UTC()}
+
+	err = tx.QueryRowContext(ctx, "INSERT INTO org(name, created_at) VALUES(?, ?) RETURNING id", name, org.CreatedAt).Scan(&org.ID)
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return storage.Org{}, fmt.Errorf("%s: %w", fn, storage.ErrOrgExists)
+		}
+		return storage.Org{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO org_member(org_id, user_id, role, created_at) VALUES(?, ?, ?, ?)",
+		org.ID, ownerID, storage.OrgRoleOwner, org.CreatedAt)
+	if err != nil {
+		return storage.Org{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.Org{}, fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return org, nil
+}
+
+// GetOrgMember returns the org and the membership of the user in it. An
+// unknown org gives ErrOrgNotFound, an org the user is not part of
+// ErrNotOrgMember.
+func (s *Storage) GetOrgMember(ctx context.Context, orgName string, userID int64) (storage.Org, storage.OrgMember, error) {
+	const fn = "storage.sqlite.GetOrgMember"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var (
+		role      sql.NullString
+		createdAt sql.NullTime
+	)
+
+	org, err := scanOrg(s.db.QueryRowContext(ctx, `
+		SELECT `+orgColumns+`, m.role, m.created_at
+		FROM org LEFT JOIN org_member m ON m.org_id = org.id AND m.user_id = ?
+		WHERE org.name = ?`, userID, orgName), &role, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Org{}, storage.OrgMember{}, fmt.Errorf("%s: %w", fn, storage.ErrOrgNotFound)
+	}
+	if err != nil {
+		return storage.Org{}, storage.OrgMember{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if !role.Valid {
+		return org, storage.OrgMember{}, fmt.Errorf("%s: %w", fn, storage.ErrNotOrgMember)
+	}
+
+	return org, storage.OrgMember{
+		OrgID:     org.ID,
+		UserID:    userID,
+		Role:      role.String,
+		CreatedAt: createdAt.Time,
+	}, nil
+}
+
+// ListUserOrgs returns the orgs the user is a member of, by name.
+func (s *Storage) ListUserOrgs(ctx context.Context, userID int64) ([]storage.OrgMembership, error) {
+	const fn = "storage.sqlite.ListUserOrgs"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+orgColumns+`, m.role
+		FROM org JOIN org_member m ON m.org_id = org.id
+		WHERE m.user_id = ?
+		ORDER BY org.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	defer rows.Close()
+
+	var orgs []storage.OrgMembership
+	for rows.Next() {
+		var m storage.OrgMembership
+
+		m.Org, err = scanOrg(rows, &m.Role)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		orgs = append(orgs, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return orgs, nil
+}
+
+func (s *Storage) UpdateOrgPolicy(ctx context.Context, orgID int64, policy storage.OrgPolicy) error {
+	const fn = "storage.sqlite.UpdateOrgPolicy"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE org SET click_budget = ?, link_ttl = ?, allowed_domains = ? WHERE id = ?",
+		policy.ClickBudget, int64(policy.LinkTTL/time.Second), joinTags(policy.AllowedDomains), orgID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return affectedOrNotFound(fn, res, storage.ErrOrgNotFound)
+}
+
+// DeleteOrg removes the org together with its members, invites and links.
+func (s *Storage) DeleteOrg(ctx context.Context, orgID int64) error {
+	const fn = "storage.sqlite.DeleteOrg"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.BulkTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM org WHERE id = ?", orgID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return affectedOrNotFound(fn, res, storage.ErrOrgNotFound)
+}
+
+// ListOrgMembers returns the members of the org, by username.
+func (s *Storage) ListOrgMembers(ctx context.Context, orgID int64) ([]storage.OrgMember, error) {
+	const fn = "storage.sqlite.ListOrgMembers"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.org_id, m.user_id, u.username, u.email, m.role, m.created_at
+		FROM org_member m JOIN user u ON u.id = m.user_id
+		WHERE m.org_id = ?
+		ORDER BY u.username`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	defer rows.Close()
+
+	var members []storage.OrgMember
+	for rows.Next() {
+		var m storage.OrgMember
+		if err := rows.Scan(&m.OrgID, &m.UserID, &m.Username, &m.Email, &m.Role, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		members = append(members, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return members, nil
+}
+
+// keepsOwner is the condition under which a member may stop being an
+// owner: they are not one, or the org has another. Being a single
+// statement it holds even against concurrent changes.
+const keepsOwner = `(role != 'owner' OR (SELECT COUNT(*) FROM org_member o WHERE o.org_id = org_member.org_id AND o.role = 'owner') > 1)`
+
+// SetOrgMemberRole changes the role of the member. The last owner can not
+// be demoted.
+func (s *Storage) SetOrgMemberRole(ctx context.Context, orgID, userID int64, role string) error {
+	const fn = "storage.sqlite.SetOrgMemberRole"
+
+	if !storage.ValidOrgRole(role) {
+		return fmt.Errorf("%s: %w", fn, storage.ErrInvalidOrgRole)
+	}
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE org_member SET role = ? WHERE org_id = ? AND user_id = ? AND (? = 'owner' OR "+keepsOwner+")",
+		role, orgID, userID, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return s.memberChanged(ctx, fn, res, orgID, userID)
+}
+
+// RemoveOrgMember takes the user out of the org. The last owner can not
+// leave.
+func (s *Storage) RemoveOrgMember(ctx context.Context, orgID, userID int64) error {
+	const fn = "storage.sqlite.RemoveOrgMember"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM org_member WHERE org_id = ? AND user_id = ? AND "+keepsOwner,
+		orgID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return s.memberChanged(ctx, fn, res, orgID, userID)
+}
+
+// memberChanged tells why a statement guarded by keepsOwner changed
+// nothing.
+func (s *Storage) memberChanged(ctx context.Context, fn string, res sql.Result, orgID, userID int64) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var count int
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM org_member WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%s: %w", fn, storage.ErrNotOrgMember)
+	}
+
+	return fmt.Errorf("%s: %w", fn, storage.ErrLastOwner)
+}
+
+// CreateOrgInvite stores the invite. Only the hash of token is kept, it
+// can not be shown again.
+func (s *Storage) CreateOrgInvite(ctx context.Context, inv storage.OrgInvite, token string) (storage.OrgInvite, error) {
+	const fn = "storage.sqlite.CreateOrgInvite"
+
+	ctx, done := startOp(ctx, fn, "INSERT", s.opts.WriteTimeout)
+	defer done()
+
+	inv.CreatedAt = time.Now().UTC()
+	inv.ExpiresAt = inv.ExpiresAt.UTC()
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO org_invite(org_id, email, role, token_hash, invited_by, created_at, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		inv.OrgID, inv.Email, inv.Role, hashToken(token), nullInt64(inv.InvitedBy), inv.CreatedAt, inv.ExpiresAt,
+	).Scan(&inv.ID)
+	if err != nil {
+		return storage.OrgInvite{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return inv, nil
+}
+
+const inviteColumns = "id, org_id, email, role, COALESCE(invited_by, 0), created_at, expires_at, accepted_at"
+
+func scanInvite(row rowScanner) (storage.OrgInvite, error) {
+	var (
+		inv        storage.OrgInvite
+		acceptedAt sql.NullTime
+	)
+
+	err := row.Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt, &acceptedAt)
+	if err != nil {
+		return storage.OrgInvite{}, err
+	}
+	inv.AcceptedAt = acceptedAt.Time
+
+	return inv, nil
+}
+
+// ListOrgInvites returns the invites of the org that can still be
+// accepted, newest first.
+func (s *Storage) ListOrgInvites(ctx context.Context, orgID int64) ([]storage.OrgInvite, error) {
+	const fn = "storage.sqlite.ListOrgInvites"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+inviteColumns+` FROM org_invite
+		WHERE org_id = ? AND accepted_at IS NULL AND expires_at > ?
+		ORDER BY id DESC`, orgID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	defer rows.Close()
+
+	var invites []storage.OrgInvite
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		invites = append(invites, inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return invites, nil
+}
+
+// RevokeOrgInvite deletes an invite that has not been accepted yet.
+func (s *Storage) RevokeOrgInvite(ctx context.Context, orgID, inviteID int64) error {
+	const fn = "storage.sqlite.RevokeOrgInvite"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM org_invite WHERE id = ? AND org_id = ? AND accepted_at IS NULL", inviteID, orgID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return affectedOrNotFound(fn, res, storage.ErrInviteNotFound)
+}
+
+// AcceptOrgInvite redeems the invite the token belongs to and adds the
+// user to its org. The invite must be addressed to the user's email. A
+// user who already is a member gets ErrMemberExists together with the org
+// and the invite stays open.
+func (s *Storage) AcceptOrgInvite(ctx context.Context, token string, user storage.User) (storage.Org, storage.OrgInvite, error) {
+	const fn = "storage.sqlite.AcceptOrgInvite"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.Org{}, storage.OrgInvite{}, fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	// Marking the invite accepted in the same statement that finds it
+	// keeps two concurrent requests from both redeeming it.
+	inv, err := scanInvite(tx.QueryRowContext(ctx, `
+		UPDATE org_invite SET accepted_at = ?, accepted_by = ?
+		WHERE token_hash = ? AND accepted_at IS NULL AND expires_at > ? AND lower(email) = lower(?)
+		RETURNING `+inviteColumns,
+		now, user.ID, hashToken(token), now, user.Email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Org{}, storage.OrgInvite{}, fmt.Errorf("%s: %w", fn, storage.ErrInviteNotFound)
+	}
+	if err != nil {
+		return storage.Org{}, storage.OrgInvite{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO org_member(org_id, user_id, role, created_at) VALUES(?, ?, ?, ?)
+		ON CONFLICT(org_id, user_id) DO NOTHING`,
+		inv.OrgID, user.ID, inv.Role, now)
+	if err != nil {
+		return storage.Org{}, storage.OrgInvite{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return storage.Org{}, storage.OrgInvite{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	org, err := scanOrg(tx.QueryRowContext(ctx, "SELECT "+orgColumns+" FROM org WHERE id = ?", inv.OrgID))
+	if err != nil {
+		return storage.Org{}, storage.OrgInvite{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	// Rolled back, the invite is not spent on a membership that exists.
+	if affected == 0 {
+		return org, inv, fmt.Errorf("%s: %w", fn, storage.ErrMemberExists)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.Org{}, storage.OrgInvite{}, fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return org, inv, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func affectedOrNotFound(fn string, res sql.Result, notFound error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", fn, notFound)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"url-shorter/internal/storage"
+)
+
+func newTestOrg(t *testing.T, s *Storage) (storage.Org, storage.User, storage.User) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	var users []storage.User
+	for _, name := range []string{"owner", "member"} {
+		if _, err := s.SaveUser(ctx, name, name+"@example.com", "password1"); err != nil {
+			t.Fatal(err)
+		}
+		user, err := s.GetUser(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+
+	org, err := s.CreateOrg(ctx, "sales", users[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return org, users[0], users[1]
+}
+
+func TestOrgInvite(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+	org, owner, member := newTestOrg(t, s)
+
+	invite := func(email, token string, expiresAt time.Time) {
+		t.Helper()
+		_, err := s.CreateOrgInvite(ctx, storage.OrgInvite{
+			OrgID:     org.ID,
+			Email:     email,
+			Role:      storage.OrgRoleMember,
+			InvitedBy: owner.ID,
+			ExpiresAt: expiresAt,
+		}, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invite("MEMBER@example.com", "valid", time.Now().Add(time.Hour))
+	invite("member@example.com", "expired", time.Now().Add(-time.Hour))
+	invite("someone@example.com", "other", time.Now().Add(time.Hour))
+
+	for _, token := range []string{"expired", "other", "unknown"} {
+		if _, _, err := s.AcceptOrgInvite(ctx, token, member); !errors.Is(err, storage.ErrInviteNotFound) {
+			t.Errorf("AcceptOrgInvite(%q) error = %v; want %v", token, err, storage.ErrInviteNotFound)
+		}
+	}
+
+	got, inv, err := s.AcceptOrgInvite(ctx, "valid", member)
+	if err != nil {
+		t.Fatalf("AcceptOrgInvite() error = %v", err)
+	}
+	if got.ID != org.ID || inv.Role != storage.OrgRoleMember {
+		t.Errorf("AcceptOrgInvite() = org %d, role %q; want org %d, role member", got.ID, inv.Role, org.ID)
+	}
+
+	if _, _, err := s.AcceptOrgInvite(ctx, "valid", member); !errors.Is(err, storage.ErrInviteNotFound) {
+		t.Errorf("second AcceptOrgInvite() error = %v; want %v", err, storage.ErrInviteNotFound)
+	}
+
+	invite("member@example.com", "again", time.Now().Add(time.Hour))
+	if _, _, err := s.AcceptOrgInvite(ctx, "again", member); !errors.Is(err, storage.ErrMemberExists) {
+		t.Errorf("AcceptOrgInvite() by a member error = %v; want %v", err, storage.ErrMemberExists)
+	}
+
+	if _, m, err := s.GetOrgMember(ctx, "sales", member.ID); err != nil || m.Role != storage.OrgRoleMember {
+		t.Errorf("GetOrgMember() = %q, %v; want member", m.Role, err)
+	}
+
+	pending, err := s.ListOrgInvites(ctx, org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Email != "member@example.com" || pending[1].Email != "someone@example.com" {
+		t.Errorf("ListOrgInvites() = %+v; want the unspent invite for member@example.com and the one for someone@example.com", pending)
+	}
+}
+
+func TestOrgLastOwner(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+	org, owner, member := newTestOrg(t, s)
+
+	if err := s.RemoveOrgMember(ctx, org.ID, owner.ID); !errors.Is(err, storage.ErrLastOwner) {
+		t.Errorf("RemoveOrgMember() of the last owner error = %v; want %v", err, storage.ErrLastOwner)
+	}
+	if err := s.SetOrgMemberRole(ctx, org.ID, owner.ID, storage.OrgRoleAdmin); !errors.Is(err, storage.ErrLastOwner) {
+		t.Errorf("SetOrgMemberRole() of the last owner error = %v; want %v", err, storage.ErrLastOwner)
+	}
+	if err := s.SetOrgMemberRole(ctx, org.ID, member.ID, storage.OrgRoleAdmin); !errors.Is(err, storage.ErrNotOrgMember) {
+		t.Errorf("SetOrgMemberRole() of a non-member error = %v; want %v", err, storage.ErrNotOrgMember)
+	}
+
+	if _, err := s.db.Exec("INSERT INTO org_member(org_id, user_id, role, created_at) VALUES(?, ?, 'owner', ?)", org.ID, member.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RemoveOrgMember(ctx, org.ID, owner.ID); err != nil {
+		t.Errorf("RemoveOrgMember() with another owner error = %v", err)
+	}
+	if _, _, err := s.GetOrgMember(ctx, "sales", owner.ID); !errors.Is(err, storage.ErrNotOrgMember) {
+		t.Errorf("GetOrgMember() of a removed member error = %v; want %v", err, storage.ErrNotOrgMember)
+	}
+}
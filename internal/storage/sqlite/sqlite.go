@@ -1,34 +1,203 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"url-shorter/internal/lib/hash_password"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/lib/password_policy"
+	"url-shorter/internal/lib/tracing"
+	"url-shorter/internal/storage"
 )
 
 type Storage struct {
-	db *sql.DB
+	db    *sql.DB
+	opts  Options
+	stmts *statements
+
+	// auditMu serializes AppendAudit, every entry must chain to the
+	// previous one.
+	auditMu sync.Mutex
+
+	hasher *hash_password.Hasher
+	policy *password_policy.Policy
+}
+
+// Options are the pragmas set on every connection, the pool limits and the
+// query timeouts. Empty pragmas keep the SQLite defaults, zero limits the
+// database/sql ones and zero timeouts leave only the caller's context.
+//
+// Read covers single lookups, Write single changes (a redirect is one, it
+// spends a click) and Bulk batches, imports, exports and purges.
+type Options struct {
+	JournalMode     string
+	BusyTimeout     time.Duration
+	Synchronous     string
+	ForeignKeys     bool
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	BulkTimeout     time.Duration
+}
+
+// dsn passes the pragmas as go-sqlite3 connection parameters, so that
+// every connection of the pool gets them, not just the first one.
+func (o Options) dsn(dbPath string) string {
+	params := url.Values{}
+	if o.JournalMode != "" {
+		params.Set("_journal_mode", o.JournalMode)
+	}
+	if o.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(o.BusyTimeout.Milliseconds(), 10))
+	}
+	if o.Synchronous != "" {
+		params.Set("_synchronous", o.Synchronous)
+	}
+	if o.ForeignKeys {
+		params.Set("_foreign_keys", "1")
+	}
+
+	if len(params) == 0 {
+		return dbPath
+	}
+	return dbPath + "?" + params.Encode()
 }
 
-func NewStorage(dbPath string) (*Storage, error) {
+// NewStorage opens the database at dbPath and pings it, so a bad path or
+// pragma fails at startup rather than on the first request.
+func NewStorage(dbPath string, opts Options) (*Storage, error) {
 	const fn = "storage.sqlite.NewStorage"
 
-	// Определяем директорию корня проекта
-	rootDir, err := filepath.Abs(filepath.Join("..", "..")) // Поднимаемся из cmd/url-shorter к корню
+	db, err := sql.Open("sqlite3", opts.dsn(dbPath))
 	if err != nil {
-		return nil, fmt.Errorf("%s: failed to resolve root directory: %w", fn, err)
+		return nil, fmt.Errorf("%s: %w", fn, err)
 	}
-	fmt.Println("Root directory:", rootDir)
 
-	// Создаём абсолютный путь для базы данных
-	absPath := filepath.Join(rootDir, dbPath)
-	fmt.Println("Absolute database path:", absPath)
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
 
-	db, err := sql.Open("sqlite3", absPath)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: ping %s: %w", fn, dbPath, err)
+	}
+
+	stmts, err := prepareStatements(context.Background(), db)
 	if err != nil {
+		db.Close()
 		return nil, fmt.Errorf("%s: %w", fn, err)
 	}
 
-	return &Storage{db: db}, nil
+	hasher, err := hash_password.New(hash_password.Default)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return &Storage{db: db, opts: opts, stmts: stmts, hasher: hasher}, nil
+}
+
+// SetPasswordHasher replaces hash_password.Default for new hashes. Older
+// hashes keep verifying and are upgraded on the next successful login.
+// Call it before the storage is used.
+func (s *Storage) SetPasswordHasher(h *hash_password.Hasher) {
+	s.hasher = h
+}
+
+// SetPasswordPolicy makes SaveUser and SetPassword refuse passwords that
+// break p. Without a policy any password is accepted. Call it before the
+// storage is used.
+func (s *Storage) SetPasswordPolicy(p *password_policy.Policy) {
+	s.policy = p
 }
 
+// Close releases the prepared statements and closes the database.
+func (s *Storage) Close() error {
+	const fn = "storage.sqlite.Close"
+
+	if err := errors.Join(s.stmts.close(), s.db.Close()); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// startOp bounds a storage call by its timeout, runs it in a child span
+// named after the method and records its latency. operation is the SQL
+// statement kind, e.g. SELECT.
+func startOp(ctx context.Context, fn, operation string, timeout time.Duration) (context.Context, func()) {
+	method := strings.TrimPrefix(fn, "storage.sqlite.")
+
+	ctx, span := tracing.Tracer().Start(ctx, "sqlite."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBOperationName(operation),
+		),
+	)
+
+	ctx, cancel := withTimeout(ctx, timeout)
+	start := time.Now()
+
+	return ctx, func() {
+		cancel()
+		span.End()
+		metrics.DBQueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// nullInt64 stores zero ids as NULL.
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+// nullTime stores zero times as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+func clicksOrDefault(clicks int) int {
+	switch clicks {
+	case 0:
+		return storage.DefaultClicks
+	case storage.NoClicksLeft:
+		return 0
+	}
+	return clicks
+}
+
+// Tags are stored comma separated; the handlers do not allow commas in them.
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
@@ -0,0 +1,44 @@
+// Package sqlitetest opens migrated SQLite storages for tests of the
+// packages built on top of the storage.
+package sqlitetest
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shorter/internal/migrator"
+	"url-shorter/internal/storage/sqlite"
+)
+
+// New migrates the database at path, a temporary one when path is empty,
+// and opens it for a test. The storage is closed on cleanup.
+func New(tb testing.TB, path string) *sqlite.Storage {
+	tb.Helper()
+
+	if path == "" {
+		path = filepath.Join(tb.TempDir(), "test.db")
+	}
+
+	m, err := migrator.NewEmbedded(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := m.Up(0); err != nil {
+		tb.Fatal(err)
+	}
+	m.Close()
+
+	s, err := sqlite.NewStorage(path, sqlite.Options{
+		JournalMode: "WAL",
+		BusyTimeout: 5 * time.Second,
+		Synchronous: "NORMAL",
+		ForeignKeys: true,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Close() })
+
+	return s
+}
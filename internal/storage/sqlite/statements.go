@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// statements are prepared once in NewStorage and shared by all requests;
+// *sql.Stmt is safe for concurrent use. Inside a transaction they are
+// bound with tx.StmtContext.
+type statements struct {
+	insertURL         *sql.Stmt
+	getURL            *sql.Stmt
+	urlState          *sql.Stmt
+	deleteURL         *sql.Stmt
+	aliasExists       *sql.Stmt
+	aliasByNormalized *sql.Stmt
+	deleteUserURL     *sql.Stmt
+	insertUser        *sql.Stmt
+	getUserPassword   *sql.Stmt
+	insertClick       *sql.Stmt
+}
+
+func prepareStatements(ctx context.Context, db *sql.DB) (*statements, error) {
+	const fn = "storage.sqlite.prepareStatements"
+
+	var st statements
+
+	queries := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&st.insertURL, insertURLQuery},
+		{&st.getURL, `
+			UPDATE url
+			SET clicks = clicks - 1
+			WHERE alias = ? AND clicks > 0 AND (expires_at IS NULL OR expires_at > ?)
+			RETURNING url`},
+		{&st.urlState, "SELECT clicks, expires_at FROM url WHERE alias = ?"},
+		{&st.deleteURL, "DELETE FROM url WHERE id = ? AND (? = 0 OR user_id = ?) RETURNING " + urlColumns},
+		{&st.aliasExists, "SELECT COUNT(*) FROM url WHERE alias = ?"},
+		{&st.aliasByNormalized, `
+			SELECT alias FROM url
+			WHERE user_id = ? AND normalized_url = ? AND clicks > 0 AND (expires_at IS NULL OR expires_at > ?)
+			ORDER BY id LIMIT 1`},
+		{&st.deleteUserURL, "DELETE FROM url WHERE alias = ? AND user_id = ? RETURNING " + urlColumns},
+		{&st.insertUser, `
+			INSERT INTO user(username, email, password, created_at, role)
+			SELECT ?, ?, ?, ?, CASE WHEN EXISTS (SELECT 1 FROM user) THEN 'member' ELSE 'admin' END`},
+		{&st.getUserPassword, "SELECT " + userColumns + ", password FROM user WHERE username = ?"},
+		{&st.insertClick, `
+			INSERT INTO click_details(url_id, ip, user_agent, country, device, browser, referrer, created_at)
+			SELECT id, ?, ?, ?, ?, ?, ?, ? FROM url WHERE alias = ?`},
+	}
+
+	for _, q := range queries {
+		stmt, err := db.PrepareContext(ctx, q.query)
+		if err != nil {
+			st.close()
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		*q.stmt = stmt
+	}
+
+	return &st, nil
+}
+
+func (st *statements) close() error {
+	var errs []error
+	for _, stmt := range []*sql.Stmt{
+		st.insertURL,
+		st.getURL,
+		st.urlState,
+		st.deleteURL,
+		st.aliasExists,
+		st.aliasByNormalized,
+		st.deleteUserURL,
+		st.insertUser,
+		st.getUserPassword,
+		st.insertClick,
+	} {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,191 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"url-shorter/internal/storage"
+)
+
+func (s *Storage) Stats(ctx context.Context) (storage.Stats, error) {
+	const fn = "storage.sqlite.Stats"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var stats storage.Stats
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM user),
+			(SELECT COUNT(*) FROM user WHERE disabled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM url),
+			(SELECT COUNT(*) FROM url WHERE expires_at IS NOT NULL AND expires_at <= ?),
+			(SELECT COUNT(*) FROM url WHERE clicks <= 0),
+			(SELECT COUNT(*) FROM click_details)`,
+		time.Now().UTC(),
+	).Scan(
+		&stats.Users,
+		&stats.DisabledUsers,
+		&stats.URLs,
+		&stats.ExpiredURLs,
+		&stats.ExhaustedURLs,
+		&stats.Clicks,
+	)
+	if err != nil {
+		return storage.Stats{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return stats, nil
+}
+
+// SaveClick records a redirect of the link click.Alias. Clicks of a link
+// deleted in the meantime are dropped with ErrURLNotFound.
+func (s *Storage) SaveClick(ctx context.Context, click storage.Click) error {
+	const fn = "storage.sqlite.SaveClick"
+
+	ctx, done := startOp(ctx, fn, "INSERT", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.stmts.insertClick.ExecContext(ctx,
+		click.IP, click.UserAgent, click.Country, click.Device, click.Browser, click.Referrer,
+		click.CreatedAt.UTC(), click.Alias,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return affectedOrNotFound(fn, res, storage.ErrURLNotFound)
+}
+
+// statsDays is how far back URLClickStats counts clicks per day.
+const statsDays = 30
+
+// topValues is how many countries and referrers URLClickStats reports.
+const topValues = 5
+
+// URLClickStats sums up the recorded redirects of the link.
+func (s *Storage) URLClickStats(ctx context.Context, urlID int64) (storage.ClickStats, error) {
+	const fn = "storage.sqlite.URLClickStats"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var (
+		stats     storage.ClickStats
+		lastClick sql.NullString
+	)
+
+	// MAX over a TIMESTAMP column comes back as text, the driver only
+	// converts plain column values.
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*), MAX(created_at) FROM click_details WHERE url_id = ?", urlID).Scan(&stats.Total, &lastClick)
+	if err != nil {
+		return storage.ClickStats{}, fmt.Errorf("%s: %w", fn, err)
+	}
+	if lastClick.Valid {
+		stats.LastClickAt, _ = parseTimestamp(lastClick.String)
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -statsDays)
+
+	err = s.collect(ctx, `
+		SELECT strftime('%Y-%m-%d', substr(created_at, 1, 19)), COUNT(*) FROM click_details
+		WHERE url_id = ? AND created_at >= ?
+		GROUP BY 1 ORDER BY 1`, []any{urlID, since}, func(value string, clicks int64) {
+		stats.ByDay = append(stats.ByDay, storage.DayCount{Day: value, Clicks: clicks})
+	})
+	if err != nil {
+		return storage.ClickStats{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	for column, dest := range map[string]*[]storage.Count{"country": &stats.Countries, "referrer": &stats.Referrers} {
+		err = s.collect(ctx, `
+			SELECT `+column+`, COUNT(*) FROM click_details
+			WHERE url_id = ? AND COALESCE(`+column+`, '') != ''
+			GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT ?`, []any{urlID, topValues}, func(value string, clicks int64) {
+			*dest = append(*dest, storage.Count{Value: value, Clicks: clicks})
+		})
+		if err != nil {
+			return storage.ClickStats{}, fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+
+	return stats, nil
+}
+
+// ListUserClicks streams the recorded clicks of the user's links, oldest
+// first.
+func (s *Storage) ListUserClicks(ctx context.Context, userID int64, yield func(storage.Click) error) error {
+	const fn = "storage.sqlite.ListUserClicks"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.BulkTimeout)
+	defer done()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.url_id, url.alias, COALESCE(c.ip, ''), COALESCE(c.user_agent, ''), COALESCE(c.country, ''),
+			COALESCE(c.device, ''), COALESCE(c.browser, ''), COALESCE(c.referrer, ''), c.created_at
+		FROM click_details c JOIN url ON url.id = c.url_id
+		WHERE url.user_id = ?
+		ORDER BY c.id`, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			c         storage.Click
+			createdAt sql.NullTime
+		)
+		err := rows.Scan(&c.URLID, &c.Alias, &c.IP, &c.UserAgent, &c.Country, &c.Device, &c.Browser, &c.Referrer, &createdAt)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		c.CreatedAt = createdAt.Time
+
+		if err := yield(c); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// collect runs a query returning value and count pairs.
+func (s *Storage) collect(ctx context.Context, query string, args []any, add func(value string, clicks int64)) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			value  string
+			clicks int64
+		)
+		if err := rows.Scan(&value, &clicks); err != nil {
+			return err
+		}
+		add(value, clicks)
+	}
+
+	return rows.Err()
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown timestamp format: %q", s)
+}
@@ -0,0 +1,53 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"url-shorter/internal/storage"
+)
+
+func TestRedirectClickStats(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	id, err := s.SaveURL(ctx, storage.URL{Alias: "hit", URL: "https://example.com", Clicks: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetURL(ctx, "hit"); err != nil {
+		t.Fatal(err)
+	}
+	err = s.SaveClick(ctx, storage.Click{
+		Alias:     "hit",
+		IP:        "203.0.113.7",
+		Device:    "Computer",
+		Browser:   "Firefox",
+		Referrer:  "https://ref.example",
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SaveClick(ctx, storage.Click{Alias: "gone", CreatedAt: time.Now()}); !errors.Is(err, storage.ErrURLNotFound) {
+		t.Errorf("SaveClick() of an unknown alias error = %v; want %v", err, storage.ErrURLNotFound)
+	}
+
+	stats, err := s.URLClickStats(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 1 || stats.LastClickAt.IsZero() {
+		t.Errorf("URLClickStats() total = %d, last click %v; want 1 recent click", stats.Total, stats.LastClickAt)
+	}
+	if len(stats.ByDay) != 1 || stats.ByDay[0].Clicks != 1 {
+		t.Errorf("URLClickStats() by day = %+v; want one day with 1 click", stats.ByDay)
+	}
+	if len(stats.Referrers) != 1 || stats.Referrers[0].Value != "https://ref.example" {
+		t.Errorf("URLClickStats() referrers = %+v; want https://ref.example", stats.Referrers)
+	}
+}
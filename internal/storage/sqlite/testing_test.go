@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shorter/internal/migrator"
+)
+
+// newTestStorage migrates the database at path, a temporary one when path
+// is empty, and opens it for a test or benchmark. The storage is closed
+// on cleanup. Tests outside the package use sqlitetest.New, which cannot
+// be imported from here.
+func newTestStorage(tb testing.TB, path string) *Storage {
+	tb.Helper()
+
+	if path == "" {
+		path = filepath.Join(tb.TempDir(), "test.db")
+	}
+
+	m, err := migrator.NewEmbedded(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := m.Up(0); err != nil {
+		tb.Fatal(err)
+	}
+	m.Close()
+
+	s, err := NewStorage(path, Options{
+		JournalMode: "WAL",
+		BusyTimeout: 5 * time.Second,
+		Synchronous: "NORMAL",
+		ForeignKeys: true,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Close() })
+
+	return s
+}
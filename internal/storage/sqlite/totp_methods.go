@@ -0,0 +1,216 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"url-shorter/internal/storage"
+)
+
+// SetTOTPSecret starts an enrollment, replacing the secret of an earlier
+// one that was never confirmed.
+func (s *Storage) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	const fn = "storage.sqlite.SetTOTPSecret"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE user SET totp_secret = ?, totp_last_step = NULL
+		WHERE id = ? AND totp_enabled_at IS NULL`, secret, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return affectedOrNotFound(fn, res, storage.ErrTOTPEnabled)
+}
+
+// TOTPSecret returns the secret of the user, whether the enrollment is
+// confirmed or not.
+func (s *Storage) TOTPSecret(ctx context.Context, userID int64) (string, error) {
+	const fn = "storage.sqlite.TOTPSecret"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var secret sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT totp_secret FROM user WHERE id = ?", userID).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s: %w", fn, storage.ErrUserNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+	if !secret.Valid {
+		return "", fmt.Errorf("%s: %w", fn, storage.ErrTOTPNotEnrolled)
+	}
+
+	return secret.String, nil
+}
+
+// EnableTOTP confirms the enrollment with the step of the code the user
+// entered and stores the hashes of their recovery codes.
+func (s *Storage) EnableTOTP(ctx context.Context, userID, step int64, recoveryCodes []string) error {
+	const fn = "storage.sqlite.EnableTOTP"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE user SET totp_enabled_at = ?, totp_last_step = ?
+		WHERE id = ? AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`,
+		time.Now().UTC(), step, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := affectedOrNotFound(fn, res, storage.ErrTOTPEnabled); err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates the recovery codes of the user in
+// favour of new ones.
+func (s *Storage) ReplaceRecoveryCodes(ctx context.Context, userID int64, codes []string) error {
+	const fn = "storage.sqlite.ReplaceRecoveryCodes"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codes); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, codes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		_, err := tx.ExecContext(ctx, "INSERT INTO recovery_code (user_id, code_hash) VALUES (?, ?)", userID, hashToken(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DisableTOTP turns two-factor authentication off and drops the secret
+// and the recovery codes.
+func (s *Storage) DisableTOTP(ctx context.Context, userID int64) error {
+	const fn = "storage.sqlite.DisableTOTP"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE user SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = ? AND totp_enabled_at IS NOT NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := affectedOrNotFound(fn, res, storage.ErrTOTPNotEnrolled); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the code of step was used. Codes of that step
+// or earlier ones are refused from then on, so an intercepted code can
+// not be replayed.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	const fn = "storage.sqlite.UseTOTPStep"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE user SET totp_last_step = ?
+		WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)`, step, userID, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return affectedOrNotFound(fn, res, storage.ErrTOTPCodeUsed)
+}
+
+// UseRecoveryCode spends one of the user's recovery codes.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	const fn = "storage.sqlite.UseRecoveryCode"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE recovery_code SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		time.Now().UTC(), userID, hashToken(code))
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return affectedOrNotFound(fn, res, storage.ErrRecoveryCodeNotFound)
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has.
+func (s *Storage) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	const fn = "storage.sqlite.CountRecoveryCodes"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_code WHERE user_id = ? AND used_at IS NULL", userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return n, nil
+}
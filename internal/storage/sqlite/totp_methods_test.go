@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"url-shorter/internal/storage"
+)
+
+func TestTOTPEnrollment(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	id, err := s.SaveUser(ctx, "amy", "amy@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.TOTPSecret(ctx, id); !errors.Is(err, storage.ErrTOTPNotEnrolled) {
+		t.Fatalf("TOTPSecret() before enrollment error = %v; want %v", err, storage.ErrTOTPNotEnrolled)
+	}
+
+	if err := s.SetTOTPSecret(ctx, id, "SECRET"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableTOTP(ctx, id, 100, []string{"code-1", "code-2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.TOTPEnabled {
+		t.Error("TOTP is not enabled")
+	}
+
+	if err := s.SetTOTPSecret(ctx, id, "OTHER"); !errors.Is(err, storage.ErrTOTPEnabled) {
+		t.Errorf("SetTOTPSecret() when enabled error = %v; want %v", err, storage.ErrTOTPEnabled)
+	}
+
+	for step, want := range map[int64]error{100: storage.ErrTOTPCodeUsed, 99: storage.ErrTOTPCodeUsed, 101: nil} {
+		if err := s.UseTOTPStep(ctx, id, step); !errors.Is(err, want) {
+			t.Errorf("UseTOTPStep(%d) error = %v; want %v", step, err, want)
+		}
+	}
+
+	if err := s.UseRecoveryCode(ctx, id, "code-1"); err != nil {
+		t.Fatalf("UseRecoveryCode() error = %v", err)
+	}
+	if err := s.UseRecoveryCode(ctx, id, "code-1"); !errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+		t.Errorf("UseRecoveryCode() twice error = %v; want %v", err, storage.ErrRecoveryCodeNotFound)
+	}
+	if n, err := s.CountRecoveryCodes(ctx, id); err != nil || n != 1 {
+		t.Errorf("CountRecoveryCodes() = %d, %v; want 1, nil", n, err)
+	}
+
+	if err := s.DisableTOTP(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UseRecoveryCode(ctx, id, "code-2"); !errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+		t.Errorf("UseRecoveryCode() after disabling error = %v; want %v", err, storage.ErrRecoveryCodeNotFound)
+	}
+}
@@ -1,24 +1,42 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 
 	"url-shorter/internal/storage"
 )
 
-func (s *Storage) SaveURL(urlToSave string, alias string) (int64, error) {
-	const fn = "storage.sqlite.SaveURL"
+const insertURLQuery = `
+	INSERT INTO url(url, normalized_url, alias, user_id, org_id, clicks, expires_at, tags)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
 
-	stmt, err := s.db.Prepare("INSERT INTO url(url, alias) VALUES(?, ?)")
-	if err != nil {
-		return 0, fmt.Errorf("%s: %w", fn, err)
+func insertURLArgs(u storage.URL) []any {
+	return []any{
+		u.URL,
+		u.NormalizedURL,
+		u.Alias,
+		nullInt64(u.UserID),
+		nullInt64(u.OrgID),
+		clicksOrDefault(u.Clicks),
+		nullTime(u.ExpiresAt),
+		joinTags(u.Tags),
 	}
+}
+
+func (s *Storage) SaveURL(ctx context.Context, u storage.URL) (int64, error) {
+	const fn = "storage.sqlite.SaveURL"
+
+	ctx, done := startOp(ctx, fn, "INSERT", s.opts.WriteTimeout)
+	defer done()
 
-	res, err := stmt.Exec(urlToSave, alias)
+	res, err := s.stmts.insertURL.ExecContext(ctx, insertURLArgs(u)...)
 	if err != nil {
 		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
 			return 0, fmt.Errorf("%s: %w", fn, storage.ErrURLExists)
@@ -35,52 +53,452 @@ func (s *Storage) SaveURL(urlToSave string, alias string) (int64, error) {
 
 }
 
-func (s *Storage) GetURL(alias string) (string, error) {
+func (s *Storage) GetURL(ctx context.Context, alias string) (string, error) {
 	const fn = "storage.sqlite.GetURL"
 
-	tx, err := s.db.Begin()
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	// A single UPDATE ... RETURNING is atomic, spending the click and
+	// reading the url need no transaction around them.
+	var resURL string
+	err := s.stmts.getURL.QueryRowContext(ctx, alias, time.Now().UTC()).Scan(&resURL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", s.unavailableReason(ctx, alias)
+		}
+		return "", fmt.Errorf("%s: query failed: %w", fn, err)
+	}
+
+	return resURL, nil
+}
+
+// unavailableReason tells why GetURL found no usable link for alias.
+func (s *Storage) unavailableReason(ctx context.Context, alias string) error {
+	const fn = "storage.sqlite.unavailableReason"
+
+	var (
+		clicks    int
+		expiresAt sql.NullTime
+	)
+
+	err := s.stmts.urlState.QueryRowContext(ctx, alias).Scan(&clicks, &expiresAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return storage.ErrURLNotFound
+	case err != nil:
+		return fmt.Errorf("%s: %w", fn, err)
+	case expiresAt.Valid && !expiresAt.Time.After(time.Now()):
+		return fmt.Errorf("%w: %w", storage.ErrURLNotFound, storage.ErrURLExpired)
+	case clicks <= 0:
+		return fmt.Errorf("%w: %w", storage.ErrURLNotFound, storage.ErrURLExhausted)
+	}
+
+	// The link became usable again between the two queries.
+	return storage.ErrURLNotFound
+}
+
+// DeleteURL removes the link and returns it as it was. A non-zero ownerID
+// only lets that user's links go, others are reported as not found.
+func (s *Storage) DeleteURL(ctx context.Context, id int, ownerID int64) (storage.URL, error) {
+	const fn = "storage.sqlite.DeleteURL"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.WriteTimeout)
+	defer done()
+
+	u, err := scanURL(s.stmts.deleteURL.QueryRowContext(ctx, id, ownerID, ownerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, storage.ErrURLNotFound)
+	}
+	if err != nil {
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return u, nil
+}
+
+// TransferURL hands the link over to another user and returns it as it
+// was before. An org link becomes a personal link of the user.
+func (s *Storage) TransferURL(ctx context.Context, alias string, userID int64) (storage.URL, error) {
+	const fn = "storage.sqlite.TransferURL"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.URL{}, fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	old, err := scanURL(tx.QueryRowContext(ctx, "SELECT "+urlColumns+" FROM url WHERE alias = ?", alias))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, storage.ErrURLNotFound)
+	}
+	if err != nil {
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE url SET user_id = ?, org_id = NULL WHERE id = ?", userID, old.ID)
+	if err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+			return storage.URL{}, fmt.Errorf("%s: %w", fn, storage.ErrUserNotFound)
+		}
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.URL{}, fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return old, nil
+}
+
+// GetOrgURL returns the link of the org without spending a click.
+func (s *Storage) GetOrgURL(ctx context.Context, orgID int64, alias string) (storage.URL, error) {
+	const fn = "storage.sqlite.GetOrgURL"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	u, err := scanURL(s.db.QueryRowContext(ctx, "SELECT "+urlColumns+" FROM url WHERE alias = ? AND org_id = ?", alias, orgID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, storage.ErrURLNotFound)
+	}
+	if err != nil {
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return u, nil
+}
+
+// DeleteOrgURL removes the link of the org and returns it as it was.
+func (s *Storage) DeleteOrgURL(ctx context.Context, orgID int64, alias string) (storage.URL, error) {
+	const fn = "storage.sqlite.DeleteOrgURL"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.WriteTimeout)
+	defer done()
+
+	u, err := scanURL(s.db.QueryRowContext(ctx, "DELETE FROM url WHERE alias = ? AND org_id = ? RETURNING "+urlColumns, alias, orgID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, storage.ErrURLNotFound)
+	}
+	if err != nil {
+		return storage.URL{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return u, nil
+}
+
+// UpdateOrgURL changes the link of the org and returns it as it was
+// before and after.
+func (s *Storage) UpdateOrgURL(ctx context.Context, orgID int64, alias string, upd storage.URLUpdate) (storage.URL, storage.URL, error) {
+	const fn = "storage.sqlite.UpdateOrgURL"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storage.URL{}, storage.URL{}, fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	old, err := scanURL(tx.QueryRowContext(ctx, "SELECT "+urlColumns+" FROM url WHERE alias = ? AND org_id = ?", alias, orgID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.URL{}, storage.URL{}, fmt.Errorf("%s: %w", fn, storage.ErrURLNotFound)
+	}
+	if err != nil {
+		return storage.URL{}, storage.URL{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	u := old
+	if upd.URL != nil {
+		u.URL = *upd.URL
+	}
+	if upd.NormalizedURL != nil {
+		u.NormalizedURL = *upd.NormalizedURL
+	}
+	if upd.Clicks != nil {
+		u.Clicks = *upd.Clicks
+	}
+	if upd.ExpiresAt != nil {
+		u.ExpiresAt = upd.ExpiresAt.UTC()
+	}
+	if upd.Tags != nil {
+		u.Tags = *upd.Tags
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE url SET url = ?, normalized_url = ?, clicks = ?, expires_at = ?, tags = ? WHERE id = ?",
+		u.URL, u.NormalizedURL, u.Clicks, nullTime(u.ExpiresAt), joinTags(u.Tags), u.ID)
+	if err != nil {
+		return storage.URL{}, storage.URL{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storage.URL{}, storage.URL{}, fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return old, u, nil
+}
+
+func (s *Storage) IsAliasExists(ctx context.Context, alias string) (bool, error) {
+	const fn = "storage.sqlite.IsAliasExists"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var count int
+	err := s.stmts.aliasExists.QueryRowContext(ctx, alias).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, storage.ErrURLNotFound
+	}
+
 	if err != nil {
-		return "", fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+		return false, fmt.Errorf("%s: execute statement: %w", fn, err)
 	}
 
-	stmt, err := tx.Prepare(`
-        UPDATE url
-        SET clicks = clicks - 1
-        WHERE alias = ? AND clicks > 0
-        RETURNING url;
-    `)
+	return count > 0, nil
+}
+
+// GetAliasByNormalizedURL returns the oldest alias the user created for the
+// normalized url that still redirects, used up and expired links are
+// skipped.
+func (s *Storage) GetAliasByNormalizedURL(ctx context.Context, userID int64, normalizedURL string) (string, error) {
+	const fn = "storage.sqlite.GetAliasByNormalizedURL"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var alias string
+	err := s.stmts.aliasByNormalized.QueryRowContext(ctx, userID, normalizedURL, time.Now().UTC()).Scan(&alias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.ErrURLNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: execute statement: %w", fn, err)
+	}
+
+	return alias, nil
+}
+
+// SaveURLs inserts urls in a single transaction. A failing link does not
+// abort the others; its error is reported in the matching result.
+func (s *Storage) SaveURLs(ctx context.Context, urls []storage.URL) ([]storage.SaveResult, error) {
+	const fn = "storage.sqlite.SaveURLs"
+
+	ctx, done := startOp(ctx, fn, "INSERT", s.opts.BulkTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		tx.Rollback()
-		return "", fmt.Errorf("%s: failed to prepare statement: %w", fn, err)
+		return nil, fmt.Errorf("%s: failed to start transaction: %w", fn, err)
 	}
+	defer tx.Rollback()
+
+	stmt := tx.StmtContext(ctx, s.stmts.insertURL)
 	defer stmt.Close()
 
-	var resURL string
-	err = stmt.QueryRow(alias).Scan(&resURL)
+	results := make([]storage.SaveResult, len(urls))
+	for i, u := range urls {
+		res, err := stmt.ExecContext(ctx, insertURLArgs(u)...)
+		if err != nil {
+			if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+				results[i].Err = storage.ErrURLExists
+				continue
+			}
+			results[i].Err = fmt.Errorf("%s: %w", fn, err)
+			continue
+		}
+
+		results[i].ID, err = res.LastInsertId()
+		if err != nil {
+			results[i].Err = fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return results, nil
+}
+
+// DeleteURLsByAlias deletes the user's links with the given aliases in a
+// single transaction and returns them, a zero URL for aliases that did not
+// exist.
+func (s *Storage) DeleteURLsByAlias(ctx context.Context, userID int64, aliases []string) ([]storage.URL, error) {
+	const fn = "storage.sqlite.DeleteURLsByAlias"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.BulkTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		tx.Rollback()
+		return nil, fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	stmt := tx.StmtContext(ctx, s.stmts.deleteUserURL)
+	defer stmt.Close()
+
+	deleted := make([]storage.URL, len(aliases))
+	for i, alias := range aliases {
+		u, err := scanURL(stmt.QueryRowContext(ctx, alias, userID))
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", storage.ErrURLNotFound
+			continue
 		}
-		return "", fmt.Errorf("%s: query failed: %w", fn, err)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		deleted[i] = u
 	}
 
 	if err := tx.Commit(); err != nil {
-		return "", fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+		return nil, fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
 	}
 
-	return resURL, nil
+	return deleted, nil
 }
 
-func (s *Storage) DeleteURL(id int) error {
-	const fn = "storage.sqlite.DeleteURL"
+const urlColumns = "id, alias, url, COALESCE(normalized_url, ''), COALESCE(user_id, 0), COALESCE(org_id, 0), clicks, expires_at, tags"
+
+// scanURL reads urlColumns followed by any extra columns.
+func scanURL(row rowScanner, extra ...any) (storage.URL, error) {
+	var (
+		u         storage.URL
+		expiresAt sql.NullTime
+		tags      string
+	)
 
-	stmt, err := s.db.Prepare("DELETE FROM url WHERE id = ?")
+	dest := append([]any{&u.ID, &u.Alias, &u.URL, &u.NormalizedURL, &u.UserID, &u.OrgID, &u.Clicks, &expiresAt, &tags}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return storage.URL{}, err
+	}
+	u.ExpiresAt = expiresAt.Time
+	u.Tags = splitTags(tags)
+
+	return u, nil
+}
+
+// ListUserURLs calls yield for every link of the user, oldest first, without
+// loading them all into memory. Click totals are counted only when
+// withClickCount is set.
+func (s *Storage) ListUserURLs(ctx context.Context, userID int64, withClickCount bool, yield func(storage.URL) error) error {
+	const fn = "storage.sqlite.ListUserURLs"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.BulkTimeout)
+	defer done()
+
+	clickCount := "0"
+	if withClickCount {
+		clickCount = "(SELECT COUNT(*) FROM click_details c WHERE c.url_id = url.id)"
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+urlColumns+", "+clickCount+" FROM url WHERE user_id = ? ORDER BY id", userID)
 	if err != nil {
-		return fmt.Errorf("%s: prepare statement: %w", fn, err)
+		return fmt.Errorf("%s: %w", fn, err)
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var clicks int64
 
-	res, err := stmt.Exec(id)
+		u, err := scanURL(rows, &clicks)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		u.ClickCount = clicks
+
+		if err := yield(u); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// ListURLs returns links of every user and org, newest first.
+func (s *Storage) ListURLs(ctx context.Context, filter storage.URLFilter) ([]storage.URL, error) {
+	const fn = "storage.sqlite.ListURLs"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var (
+		where []string
+		args  []any
+	)
+
+	if filter.UserID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+
+	if filter.OrgID != 0 {
+		where = append(where, "org_id = ?")
+		args = append(args, filter.OrgID)
+	}
+
+	if filter.Query != "" {
+		where = append(where, "(alias LIKE ? ESCAPE '\\' OR url LIKE ? ESCAPE '\\')")
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	clickCount := "0"
+	if filter.WithClickCount {
+		clickCount = "(SELECT COUNT(*) FROM click_details c WHERE c.url_id = url.id)"
+	}
+
+	query := "SELECT " + urlColumns + ", " + clickCount + " FROM url"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	defer rows.Close()
+
+	var urls []storage.URL
+	for rows.Next() {
+		var clicks int64
+
+		u, err := scanURL(rows, &clicks)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		u.ClickCount = clicks
+
+		urls = append(urls, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return urls, nil
+}
+
+func (s *Storage) DeleteURLByAlias(ctx context.Context, alias string) error {
+	const fn = "storage.sqlite.DeleteURLByAlias"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.WriteTimeout)
+	defer done()
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM url WHERE alias = ?", alias)
 	if err != nil {
 		return fmt.Errorf("%s: %w", fn, err)
 	}
@@ -97,23 +515,27 @@ func (s *Storage) DeleteURL(id int) error {
 	return nil
 }
 
-func (s *Storage) IsAliasExists(alias string) (bool, error) {
-	const fn = "storage.sqlite.IsAliasExists"
+// PurgeExpiredURLs deletes links past their expiry and returns how many
+// were removed.
+func (s *Storage) PurgeExpiredURLs(ctx context.Context) (int64, error) {
+	const fn = "storage.sqlite.PurgeExpiredURLs"
 
-	stmt, err := s.db.Prepare("SELECT COUNT(*) FROM url WHERE alias = ?")
-	if err != nil {
-		return false, fmt.Errorf("%s: prepare statement: %w", fn, err)
-	}
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.BulkTimeout)
+	defer done()
 
-	var count int
-	err = stmt.QueryRow(alias).Scan(&count)
-	if errors.Is(err, sql.ErrNoRows) {
-		return false, storage.ErrURLNotFound
+	res, err := s.db.ExecContext(ctx, "DELETE FROM url WHERE expires_at IS NOT NULL AND expires_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
 	}
 
+	affected, err := res.RowsAffected()
 	if err != nil {
-		return false, fmt.Errorf("%s: execute statement: %w", fn, err)
+		return 0, fmt.Errorf("%s: %w", fn, err)
 	}
 
-	return count > 0, nil
+	return affected, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
 }
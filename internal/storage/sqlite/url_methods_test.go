@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"url-shorter/internal/storage"
+)
+
+func TestSaveURLClicks(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	results, err := s.SaveURLs(ctx, []storage.URL{
+		{Alias: "fresh", URL: "https://example.com/fresh"},
+		{Alias: "used", URL: "https://example.com/used", Clicks: storage.NoClicksLeft},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+
+	var clicks int
+	if err := s.db.QueryRow("SELECT clicks FROM url WHERE alias = 'fresh'").Scan(&clicks); err != nil || clicks != storage.DefaultClicks {
+		t.Errorf("fresh link has %d clicks left, %v; want %d", clicks, err, storage.DefaultClicks)
+	}
+
+	if _, err := s.GetURL(ctx, "used"); !errors.Is(err, storage.ErrURLExhausted) {
+		t.Errorf("GetURL() of a used up link error = %v; want %v", err, storage.ErrURLExhausted)
+	}
+}
+
+func TestDeleteURLsByAlias(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	owner, err := s.SaveUser(ctx, "owner", "owner@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveURL(ctx, storage.URL{Alias: "mine", URL: "https://example.com", UserID: owner}); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := s.DeleteURLsByAlias(ctx, owner, []string{"mine", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted[0].Alias != "mine" || deleted[0].URL != "https://example.com" || deleted[0].ID == 0 {
+		t.Errorf("DeleteURLsByAlias() deleted %+v; want the link mine", deleted[0])
+	}
+	if deleted[1].ID != 0 {
+		t.Errorf("DeleteURLsByAlias() deleted %+v for a missing alias; want a zero URL", deleted[1])
+	}
+}
+
+func TestGetAliasByNormalizedURL(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	owner, err := s.SaveUser(ctx, "owner", "owner@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range []storage.URL{
+		{Alias: "expired", ExpiresAt: time.Now().Add(-time.Hour)},
+		{Alias: "used", Clicks: storage.NoClicksLeft},
+		{Alias: "live"},
+		{Alias: "newer"},
+	} {
+		u.URL, u.NormalizedURL, u.UserID = "https://example.com", "https://example.com/", owner
+		if _, err := s.SaveURL(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if alias, err := s.GetAliasByNormalizedURL(ctx, owner, "https://example.com/"); err != nil || alias != "live" {
+		t.Errorf("GetAliasByNormalizedURL() = %q, %v; want the oldest live link", alias, err)
+	}
+	if _, err := s.GetAliasByNormalizedURL(ctx, owner, "https://example.org/"); !errors.Is(err, storage.ErrURLNotFound) {
+		t.Errorf("GetAliasByNormalizedURL() of an unknown url error = %v; want %v", err, storage.ErrURLNotFound)
+	}
+}
@@ -1,6 +1,7 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -8,37 +9,29 @@ import (
 	"time"
 
 	"github.com/mattn/go-sqlite3"
-	"golang.org/x/crypto/bcrypt"
 
 	"url-shorter/internal/lib/hash_password"
+	"url-shorter/internal/lib/metrics"
 	"url-shorter/internal/storage"
 )
 
-func (s *Storage) SaveUser(username, email, password string) (int64, error) {
+// SaveUser stores a new member; the very first user becomes an admin.
+func (s *Storage) SaveUser(ctx context.Context, username, email, password string) (int64, error) {
 	const fn = "storage.sqlite.SaveUser"
 
-	stmt, err := s.db.Prepare("INSERT INTO user(username, email, password, created_at) VALUES(?, ?, ?, ?)")
+	hashPassword, err := s.hashPassword(password)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", fn, err)
 	}
 
-	hashPassword, err := hash_password.GeneratePassword(password)
-	if err != nil {
-		return 0, fmt.Errorf("%s: %w", fn, err)
-	}
+	ctx, done := startOp(ctx, fn, "INSERT", s.opts.WriteTimeout)
+	defer done()
 
 	createdAt := time.Now().UTC()
-	res, err := stmt.Exec(username, email, hashPassword, createdAt)
-	if err != nil {
-		if sqliteErr, ok := err.(sqlite3.Error); ok {
-			if sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-				if strings.Contains(err.Error(), "username") {
-					return 0, fmt.Errorf("%s: username уже существует: %w", fn, storage.ErrUsernamelExists)
-				}
-				if strings.Contains(err.Error(), "email") {
-					return 0, fmt.Errorf("%s: email уже существует: %w", fn, storage.ErrEmailExists)
-				}
-			}
+	res, err := s.stmts.insertUser.ExecContext(ctx, username, email, hashPassword, createdAt)
+	if err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return 0, fmt.Errorf("%s: %w", fn, conflict)
 		}
 		return 0, fmt.Errorf("%s: %w", fn, err)
 	}
@@ -51,27 +44,414 @@ func (s *Storage) SaveUser(username, email, password string) (int64, error) {
 	return id, nil
 }
 
-func (s *Storage) ValidateUser(username, password string) (bool, error) {
+// userConflict returns ErrUsernamelExists or ErrEmailExists for a
+// unique constraint violation on the user table, nil otherwise.
+func userConflict(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return nil
+	}
+
+	switch {
+	case strings.Contains(err.Error(), "username"):
+		return fmt.Errorf("username уже существует: %w", storage.ErrUsernamelExists)
+	case strings.Contains(err.Error(), "email"):
+		return fmt.Errorf("email уже существует: %w", storage.ErrEmailExists)
+	}
+
+	return nil
+}
+
+const userColumns = "id, username, email, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, role, dedup_urls, disabled_at IS NOT NULL, created_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser reads userColumns followed by any extra columns.
+func scanUser(row rowScanner, extra ...any) (storage.User, error) {
+	var (
+		user      storage.User
+		createdAt sql.NullTime
+	)
+
+	dest := append([]any{&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.TOTPEnabled, &user.Role, &user.DedupURLs, &user.Disabled, &createdAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return storage.User{}, err
+	}
+	user.CreatedAt = createdAt.Time
+
+	return user, nil
+}
+
+func (s *Storage) ValidateUser(ctx context.Context, username, password string) (storage.User, error) {
 	const fn = "storage.sqlite.ValidateUser"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
 	var hashPassword string
 
-	stmt, err := s.db.Prepare("SELECT password FROM user WHERE username = ?")
-	if err != nil {
-		return false, fmt.Errorf("%s: %w", fn, err)
-	}
-	err = stmt.QueryRow(username).Scan(&hashPassword)
+	user, err := scanUser(s.stmts.getUserPassword.QueryRowContext(ctx, username), &hashPassword)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return false, storage.ErrUserNotFound
+			return storage.User{}, storage.ErrUserNotFound
 		}
-		return false, fmt.Errorf("%s: %w", fn, err)
+		return storage.User{}, fmt.Errorf("%s: %w", fn, err)
 	}
 
 	// Сравниваем переданный пароль с хэшированным значением
-	err = bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password))
+	err = s.hasher.Verify(hashPassword, password)
+	if errors.Is(err, hash_password.ErrMismatch) {
+		return storage.User{}, storage.ErrWrongPassword // Пароль неверный
+	}
+	if err != nil {
+		return storage.User{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if user.Disabled {
+		return storage.User{}, storage.ErrUserDisabled
+	}
+
+	if s.hasher.NeedsRehash(hashPassword) {
+		// Failing to upgrade the hash does not fail the login, the next
+		// one tries again. The metric shows when it keeps failing.
+		if err := s.rehashPassword(ctx, user.ID, hashPassword, password); err != nil {
+			metrics.PasswordRehashFailures.Inc()
+		}
+	}
+
+	return user, nil // Валидация успешна
+}
+
+// rehashPassword replaces oldHash with a hash made with the current
+// parameters, unless the password was changed in the meantime. It runs
+// with its own timeout, hashing may have used up the one of the login.
+func (s *Storage) rehashPassword(ctx context.Context, id int64, oldHash, password string) error {
+	const fn = "storage.sqlite.rehashPassword"
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	ctx, done := startOp(context.WithoutCancel(ctx), fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	_, err = s.db.ExecContext(ctx, "UPDATE user SET password = ? WHERE id = ? AND password = ?", hash, id, oldHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// hashPassword checks password against the policy and hashes it.
+func (s *Storage) hashPassword(password string) (string, error) {
+	if s.policy != nil {
+		if err := s.policy.Check(password); err != nil {
+			return "", fmt.Errorf("%w: %w", storage.ErrInvalidPassword, err)
+		}
+	}
+
+	return s.hasher.Hash(password)
+}
+
+func (s *Storage) UpdateUser(ctx context.Context, id int64, upd storage.UserUpdate) error {
+	const fn = "storage.sqlite.UpdateUser"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	var (
+		sets []string
+		args []any
+	)
+
+	if upd.Username != nil {
+		sets = append(sets, "username = ?")
+		args = append(args, *upd.Username)
+	}
+
+	if upd.Email != nil {
+		// SET expressions see the old row, the verification survives only
+		// if the email stays the same.
+		sets = append(sets, "email = ?", "email_verified_at = CASE WHEN email = ? THEN email_verified_at END")
+		args = append(args, *upd.Email, *upd.Email)
+	}
+
+	if upd.DedupURLs != nil {
+		sets = append(sets, "dedup_urls = ?")
+		args = append(args, *upd.DedupURLs)
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	args = append(args, id)
+
+	err := s.execUserUpdate(ctx, fn, "UPDATE user SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...)
+	if conflict := userConflict(err); conflict != nil {
+		return fmt.Errorf("%s: %w", fn, conflict)
+	}
+
+	return err
+}
+
+func (s *Storage) ListUsers(ctx context.Context) ([]storage.User, error) {
+	const fn = "storage.sqlite.ListUsers"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns+" FROM user ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	defer rows.Close()
+
+	var users []storage.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return users, nil
+}
+
+// GetUser looks a user up by username.
+func (s *Storage) GetUser(ctx context.Context, username string) (storage.User, error) {
+	const fn = "storage.sqlite.GetUser"
+
+	return s.getUser(ctx, fn, "username = ?", username)
+}
+
+func (s *Storage) GetUserByID(ctx context.Context, id int64) (storage.User, error) {
+	const fn = "storage.sqlite.GetUserByID"
+
+	return s.getUser(ctx, fn, "id = ?", id)
+}
+
+// GetUserByEmail looks a user up by email, ignoring case.
+func (s *Storage) GetUserByEmail(ctx context.Context, email string) (storage.User, error) {
+	const fn = "storage.sqlite.GetUserByEmail"
+
+	return s.getUser(ctx, fn, "lower(email) = lower(?)", email)
+}
+
+func (s *Storage) getUser(ctx context.Context, fn, where string, arg any) (storage.User, error) {
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	user, err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM user WHERE "+where, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.User{}, fmt.Errorf("%s: %w", fn, storage.ErrUserNotFound)
+	}
 	if err != nil {
-		return false, storage.ErrInvalidPassword // Пароль неверный
+		return storage.User{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return user, nil
+}
+
+// PasswordHash returns the stored hash of the user's password. Password
+// reset tokens are bound to it.
+func (s *Storage) PasswordHash(ctx context.Context, id int64) (string, error) {
+	const fn = "storage.sqlite.PasswordHash"
+
+	ctx, done := startOp(ctx, fn, "SELECT", s.opts.ReadTimeout)
+	defer done()
+
+	var hash string
+	err := s.db.QueryRowContext(ctx, "SELECT password FROM user WHERE id = ?", id).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s: %w", fn, storage.ErrUserNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return hash, nil
+}
+
+// MarkEmailVerified records that the user owns email. Nothing changes if
+// the user switched to another email in the meantime.
+func (s *Storage) MarkEmailVerified(ctx context.Context, id int64, email string) error {
+	const fn = "storage.sqlite.MarkEmailVerified"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	return s.execUserUpdate(ctx, fn, "UPDATE user SET email_verified_at = ? WHERE id = ? AND email = ?", time.Now().UTC(), id, email)
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, username, role string) error {
+	const fn = "storage.sqlite.SetUserRole"
+
+	if !storage.ValidRole(role) {
+		return fmt.Errorf("%s: %w: %q", fn, storage.ErrInvalidRole, role)
+	}
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	return s.execUserUpdate(ctx, fn, "UPDATE user SET role = ? WHERE username = ?", role, username)
+}
+
+// SetUserDisabled disables or re-enables a user. Disabled users can not
+// authenticate.
+func (s *Storage) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	const fn = "storage.sqlite.SetUserDisabled"
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	var disabledAt sql.NullTime
+	if disabled {
+		disabledAt = nullTime(time.Now())
+	}
+
+	return s.execUserUpdate(ctx, fn, "UPDATE user SET disabled_at = ? WHERE username = ?", disabledAt, username)
+}
+
+func (s *Storage) SetPassword(ctx context.Context, username, password string) error {
+	const fn = "storage.sqlite.SetPassword"
+
+	hashPassword, err := s.hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	ctx, done := startOp(ctx, fn, "UPDATE", s.opts.WriteTimeout)
+	defer done()
+
+	return s.execUserUpdate(ctx, fn, "UPDATE user SET password = ? WHERE username = ?", hashPassword, username)
+}
+
+// DeleteUser removes the user; their links stay and lose the owner.
+func (s *Storage) DeleteUser(ctx context.Context, username string) error {
+	const fn = "storage.sqlite.DeleteUser"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.WriteTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE url SET user_id = NULL WHERE user_id = (SELECT id FROM user WHERE username = ?)", username)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM user WHERE username = ?", username)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", fn, storage.ErrUserNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return nil
+}
+
+// DeleteAccount removes the user at their own request. Their links go to
+// the user transferTo, or are deleted together with their clicks when it
+// is zero. It returns how many links were moved or deleted and refuses
+// with ErrLastOwner while the user is the only owner of an org.
+func (s *Storage) DeleteAccount(ctx context.Context, id, transferTo int64) (int64, error) {
+	const fn = "storage.sqlite.DeleteAccount"
+
+	ctx, done := startOp(ctx, fn, "DELETE", s.opts.BulkTimeout)
+	defer done()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to start transaction: %w", fn, err)
+	}
+	defer tx.Rollback()
+
+	var soleOwner bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM org_member m
+			WHERE m.user_id = ? AND m.role = ?
+			AND NOT EXISTS (
+				SELECT 1 FROM org_member o
+				WHERE o.org_id = m.org_id AND o.role = ? AND o.user_id != m.user_id
+			)
+		)`, id, storage.OrgRoleOwner, storage.OrgRoleOwner).Scan(&soleOwner)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+	if soleOwner {
+		return 0, fmt.Errorf("%s: %w", fn, storage.ErrLastOwner)
+	}
+
+	var res sql.Result
+	if transferTo != 0 {
+		res, err = tx.ExecContext(ctx, "UPDATE url SET user_id = ? WHERE user_id = ?", transferTo, id)
+	} else {
+		res, err = tx.ExecContext(ctx, "DELETE FROM url WHERE user_id = ?", id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	links, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	res, err = tx.ExecContext(ctx, "DELETE FROM user WHERE id = ?", id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn, err)
+	}
+	if err := affectedOrNotFound(fn, res, storage.ErrUserNotFound); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: failed to commit transaction: %w", fn, err)
+	}
+
+	return links, nil
+}
+
+// execUserUpdate runs a statement that must affect exactly one user.
+func (s *Storage) execUserUpdate(ctx context.Context, fn, query string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", fn, storage.ErrUserNotFound)
 	}
 
-	return true, nil // Валидация успешна
+	return nil
 }
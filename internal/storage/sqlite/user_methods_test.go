@@ -0,0 +1,322 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"url-shorter/internal/lib/hash_password"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/lib/password_policy"
+	"url-shorter/internal/storage"
+)
+
+func TestFirstUserIsAdmin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	for _, name := range []string{"first", "second"} {
+		if _, err := s.SaveUser(ctx, name, name+"@example.com", "password1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{"first": storage.RoleAdmin, "second": storage.RoleMember} {
+		user, err := s.GetUser(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != want {
+			t.Errorf("%s has role %q; want %q", name, user.Role, want)
+		}
+	}
+
+	if err := s.SetUserRole(ctx, "second", "owner"); !errors.Is(err, storage.ErrInvalidRole) {
+		t.Errorf("SetUserRole() error = %v; want %v", err, storage.ErrInvalidRole)
+	}
+}
+
+func TestDeleteURLOwner(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	owner, err := s.SaveUser(ctx, "owner", "owner@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.SaveUser(ctx, "other", "other@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := s.SaveURL(ctx, storage.URL{Alias: "mine", URL: "https://example.com", UserID: owner})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.DeleteURL(ctx, int(id), other); !errors.Is(err, storage.ErrURLNotFound) {
+		t.Fatalf("DeleteURL() by another user error = %v; want %v", err, storage.ErrURLNotFound)
+	}
+
+	deleted, err := s.DeleteURL(ctx, int(id), owner)
+	if err != nil {
+		t.Fatalf("DeleteURL() by the owner error = %v", err)
+	}
+	if deleted.Alias != "mine" {
+		t.Errorf("DeleteURL() returned alias %q; want mine", deleted.Alias)
+	}
+}
+
+func TestMarkEmailVerified(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	id, err := s.SaveUser(ctx, "amy", "amy@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MarkEmailVerified(ctx, id, "old@example.com"); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("MarkEmailVerified() for another email error = %v; want %v", err, storage.ErrUserNotFound)
+	}
+	if err := s.MarkEmailVerified(ctx, id, "amy@example.com"); err != nil {
+		t.Fatalf("MarkEmailVerified() error = %v", err)
+	}
+
+	user, err := s.GetUserByEmail(ctx, "AMY@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailVerified {
+		t.Error("email is not verified")
+	}
+}
+
+func TestValidateUserRehash(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	bcryptHasher, err := hash_password.New(hash_password.Config{Algorithm: hash_password.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPasswordHasher(bcryptHasher)
+
+	id, err := s.SaveUser(ctx, "amy", "amy@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argonHasher, err := hash_password.New(hash_password.Config{
+		Algorithm:     hash_password.AlgorithmArgon2id,
+		Argon2Time:    1,
+		Argon2Memory:  64,
+		Argon2Threads: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPasswordHasher(argonHasher)
+
+	if _, err := s.ValidateUser(ctx, "amy", "wrong-password"); !errors.Is(err, storage.ErrWrongPassword) {
+		t.Fatalf("ValidateUser() with a wrong password error = %v; want %v", err, storage.ErrWrongPassword)
+	}
+	if hash, _ := s.PasswordHash(ctx, id); !strings.HasPrefix(hash, "$2a$04$") {
+		t.Fatalf("hash upgraded after a failed login: %s", hash)
+	}
+
+	if _, err := s.ValidateUser(ctx, "amy", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := s.PasswordHash(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		t.Errorf("hash not upgraded: %s", hash)
+	}
+
+	if _, err := s.ValidateUser(ctx, "amy", "password1"); err != nil {
+		t.Errorf("ValidateUser() with the upgraded hash error = %v", err)
+	}
+}
+
+func TestValidateUserRehashFailure(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	bcryptHasher, err := hash_password.New(hash_password.Config{Algorithm: hash_password.AlgorithmBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPasswordHasher(bcryptHasher)
+
+	if _, err := s.SaveUser(ctx, "amy", "amy@example.com", "password1"); err != nil {
+		t.Fatal(err)
+	}
+
+	costlier, err := hash_password.New(hash_password.Config{Algorithm: hash_password.AlgorithmBcrypt, BcryptCost: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPasswordHasher(costlier)
+
+	if _, err := s.db.Exec(`CREATE TRIGGER no_rehash BEFORE UPDATE OF password ON user BEGIN SELECT RAISE(ABORT, 'read only'); END`); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := func() float64 {
+		var m dto.Metric
+		if err := metrics.PasswordRehashFailures.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetCounter().GetValue()
+	}
+
+	before := failures()
+	if _, err := s.ValidateUser(ctx, "amy", "password1"); err != nil {
+		t.Fatalf("ValidateUser() error = %v; a failed rehash must not fail the login", err)
+	}
+	if got := failures() - before; got != 1 {
+		t.Errorf("rehash failures counted = %v; want 1", got)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	policy, err := password_policy.NewPolicy(password_policy.Config{MinLength: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetPasswordPolicy(policy)
+
+	_, err = s.SaveUser(ctx, "amy", "amy@example.com", "password1")
+	if !errors.Is(err, storage.ErrInvalidPassword) || !errors.Is(err, password_policy.ErrTooShort) {
+		t.Fatalf("SaveUser() with a short password error = %v; want %v", err, storage.ErrInvalidPassword)
+	}
+
+	if _, err := s.SaveUser(ctx, "amy", "amy@example.com", "long enough"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPassword(ctx, "amy", "short"); !errors.Is(err, storage.ErrInvalidPassword) {
+		t.Errorf("SetPassword() with a short password error = %v; want %v", err, storage.ErrInvalidPassword)
+	}
+}
+
+func TestUpdateUserEmail(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+
+	id, err := s.SaveUser(ctx, "amy", "amy@example.com", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveUser(ctx, "bob", "bob@example.com", "password1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkEmailVerified(ctx, id, "amy@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	taken := "bob@example.com"
+	if err := s.UpdateUser(ctx, id, storage.UserUpdate{Email: &taken}); !errors.Is(err, storage.ErrEmailExists) {
+		t.Errorf("UpdateUser() to a taken email error = %v; want %v", err, storage.ErrEmailExists)
+	}
+	takenName := "bob"
+	if err := s.UpdateUser(ctx, id, storage.UserUpdate{Username: &takenName}); !errors.Is(err, storage.ErrUsernamelExists) {
+		t.Errorf("UpdateUser() to a taken username error = %v; want %v", err, storage.ErrUsernamelExists)
+	}
+
+	same := "amy@example.com"
+	if err := s.UpdateUser(ctx, id, storage.UserUpdate{Email: &same}); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := s.GetUserByID(ctx, id); !user.EmailVerified {
+		t.Error("an unchanged email lost its verification")
+	}
+
+	email, name := "amy@example.org", "amy2"
+	if err := s.UpdateUser(ctx, id, storage.UserUpdate{Username: &name, Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != name || user.Email != email {
+		t.Errorf("user is %s <%s>; want %s <%s>", user.Username, user.Email, name, email)
+	}
+	if user.EmailVerified {
+		t.Error("a new email is verified")
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, "")
+	org, owner, member := newTestOrg(t, s)
+
+	for _, alias := range []string{"one", "two"} {
+		if _, err := s.SaveURL(ctx, storage.URL{Alias: alias, URL: "https://example.com/" + alias, UserID: member.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetURL(ctx, alias); err != nil {
+			t.Fatal(err)
+		}
+		err := s.SaveClick(ctx, storage.Click{Alias: alias, IP: "127.0.0.1", Browser: "Firefox", CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var clicks []storage.Click
+	err := s.ListUserClicks(ctx, member.ID, func(c storage.Click) error {
+		clicks = append(clicks, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clicks) != 2 || clicks[0].Alias != "one" || clicks[0].Browser != "Firefox" || clicks[0].CreatedAt.IsZero() {
+		t.Errorf("ListUserClicks() = %+v; want a click on one and two", clicks)
+	}
+
+	if _, err := s.DeleteAccount(ctx, owner.ID, 0); !errors.Is(err, storage.ErrLastOwner) {
+		t.Errorf("DeleteAccount() of the last owner of %s error = %v; want %v", org.Name, err, storage.ErrLastOwner)
+	}
+
+	moved, err := s.DeleteAccount(ctx, member.ID, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2 {
+		t.Errorf("DeleteAccount() moved %d links; want 2", moved)
+	}
+	var userID int64
+	if err := s.db.QueryRow("SELECT user_id FROM url WHERE alias = 'one'").Scan(&userID); err != nil || userID != owner.ID {
+		t.Errorf("link one belongs to %d, %v; want %d", userID, err, owner.ID)
+	}
+	if _, err := s.GetUserByID(ctx, member.ID); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Errorf("GetUserByID() of a deleted user error = %v; want %v", err, storage.ErrUserNotFound)
+	}
+
+	if err := s.DeleteOrg(ctx, org.ID); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := s.DeleteAccount(ctx, owner.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteAccount() deleted %d links; want 2", deleted)
+	}
+	if _, err := s.GetURL(ctx, "two"); !errors.Is(err, storage.ErrURLNotFound) {
+		t.Errorf("GetURL() of a deleted link error = %v; want %v", err, storage.ErrURLNotFound)
+	}
+}
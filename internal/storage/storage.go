@@ -5,15 +5,43 @@ import "errors"
 var (
 	ErrURLNotFound = errors.New("url not found")
 	ErrURLExists   = errors.New("url exists")
+	// ErrURLExhausted and ErrURLExpired come wrapped together with
+	// ErrURLNotFound, callers that only check for it keep working.
+	ErrURLExhausted = errors.New("url has no clicks left")
+	ErrURLExpired   = errors.New("url has expired")
 
 	ErrUserExists = errors.New("user exists")
 
 	ErrInvalidUsername = errors.New("invalid username")
 	ErrUsernamelExists = errors.New("username email")
 	ErrUserNotFound    = errors.New("user not found")
+	ErrUserDisabled    = errors.New("user is disabled")
+	ErrInvalidRole     = errors.New("invalid role")
 
 	ErrInvalidEmail = errors.New("invalid email format")
 	ErrEmailExists  = errors.New("exists email")
 
+	// ErrInvalidPassword comes wrapped together with the
+	// *password_policy.ValidationError saying which rule was broken.
 	ErrInvalidPassword = errors.New("password does not meet security requirements")
+	ErrWrongPassword   = errors.New("wrong password")
+
+	ErrOrgExists      = errors.New("org exists")
+	ErrOrgNotFound    = errors.New("org not found")
+	ErrInvalidOrgRole = errors.New("invalid org role")
+	ErrNotOrgMember   = errors.New("user is not a member of the org")
+	ErrMemberExists   = errors.New("user is already a member of the org")
+	ErrLastOwner      = errors.New("org must keep at least one owner")
+	// ErrInviteNotFound covers unknown, expired, used and revoked invites
+	// as well as invites for another email, the caller learns nothing
+	// about which one it was.
+	ErrInviteNotFound = errors.New("invite not found")
+
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled = errors.New("two-factor authentication is not set up")
+	ErrTOTPCodeUsed    = errors.New("two-factor code has already been used")
+	// ErrRecoveryCodeNotFound covers unknown and already used codes.
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+
+	ErrAuditTampered = errors.New("audit log chain is broken")
 )
@@ -0,0 +1,270 @@
+// Package twofactor manages TOTP second factors: enrollment with an
+// authenticator app, one-time recovery codes and checking the codes
+// entered at login.
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"url-shorter/internal/lib/totp"
+	"url-shorter/internal/storage"
+)
+
+// Methods a second factor can be checked with.
+const (
+	MethodTOTP         = "totp"
+	MethodRecoveryCode = "recovery_code"
+)
+
+var (
+	// ErrNotEligible is returned when enrolling a user that is neither an
+	// admin nor a member of an org.
+	ErrNotEligible = errors.New("two-factor authentication is not available for this account")
+	// ErrInvalidCode covers wrong, stale and already used codes.
+	ErrInvalidCode = errors.New("invalid two-factor code")
+)
+
+type Store interface {
+	SetTOTPSecret(ctx context.Context, userID int64, secret string) error
+	TOTPSecret(ctx context.Context, userID int64) (string, error)
+	EnableTOTP(ctx context.Context, userID, step int64, recoveryCodes []string) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	UseTOTPStep(ctx context.Context, userID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, code string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codes []string) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+	ListUserOrgs(ctx context.Context, userID int64) ([]storage.OrgMembership, error)
+}
+
+type Config struct {
+	// Issuer names the service in authenticator apps.
+	Issuer        string
+	RecoveryCodes int
+}
+
+type Service struct {
+	store Store
+	cfg   Config
+}
+
+func New(store Store, cfg Config) *Service {
+	return &Service{store: store, cfg: cfg}
+}
+
+// Enrollment is what the user needs to add the account to an
+// authenticator app. QR is a PNG of URI.
+type Enrollment struct {
+	Secret string
+	URI    string
+	QR     []byte
+}
+
+// Status tells whether the user has two-factor authentication on and how
+// many recovery codes are left.
+type Status struct {
+	Enabled           bool
+	RecoveryCodesLeft int
+}
+
+// Enroll generates a new secret for the user. It takes effect once
+// confirmed with a code from the app.
+func (s *Service) Enroll(ctx context.Context, user storage.User) (Enrollment, error) {
+	const fn = "twofactor.Enroll"
+
+	if err := s.checkEligible(ctx, user); err != nil {
+		return Enrollment{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := s.store.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		return Enrollment{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	uri := totp.URI(s.cfg.Issuer, user.Username, secret)
+
+	qr, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return Enrollment{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return Enrollment{Secret: secret, URI: uri, QR: qr}, nil
+}
+
+// Confirm enables two-factor authentication if code matches the enrolled
+// secret and returns the recovery codes. They are only stored hashed,
+// this is the one time the user gets to see them.
+func (s *Service) Confirm(ctx context.Context, user storage.User, code string) ([]string, error) {
+	const fn = "twofactor.Confirm"
+
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("%s: %w", fn, storage.ErrTOTPEnabled)
+	}
+
+	secret, err := s.store.TOTPSecret(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	step, ok := totp.Validate(secret, normalize(code), time.Now())
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", fn, ErrInvalidCode)
+	}
+
+	codes, err := s.recoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := s.store.EnableTOTP(ctx, user.ID, step, codes); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return codes, nil
+}
+
+// Check verifies a code from the authenticator app or one of the
+// recovery codes and returns which one it was. Either works only once.
+func (s *Service) Check(ctx context.Context, user storage.User, code string) (string, error) {
+	const fn = "twofactor.Check"
+
+	if !user.TOTPEnabled {
+		return "", fmt.Errorf("%s: %w", fn, storage.ErrTOTPNotEnrolled)
+	}
+
+	code = normalize(code)
+
+	if len(code) != totp.Digits {
+		err := s.store.UseRecoveryCode(ctx, user.ID, code)
+		if errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+			return "", fmt.Errorf("%s: %w", fn, ErrInvalidCode)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", fn, err)
+		}
+		return MethodRecoveryCode, nil
+	}
+
+	secret, err := s.store.TOTPSecret(ctx, user.ID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return "", fmt.Errorf("%s: %w", fn, ErrInvalidCode)
+	}
+
+	err = s.store.UseTOTPStep(ctx, user.ID, step)
+	if errors.Is(err, storage.ErrTOTPCodeUsed) {
+		return "", fmt.Errorf("%s: %w", fn, ErrInvalidCode)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return MethodTOTP, nil
+}
+
+// Disable turns two-factor authentication off after checking code.
+func (s *Service) Disable(ctx context.Context, user storage.User, code string) error {
+	const fn = "twofactor.Disable"
+
+	if _, err := s.Check(ctx, user, code); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := s.store.DisableTOTP(ctx, user.ID); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking
+// code, e.g. when the user ran out of them.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, user storage.User, code string) ([]string, error) {
+	const fn = "twofactor.RegenerateRecoveryCodes"
+
+	if _, err := s.Check(ctx, user, code); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	codes, err := s.recoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	if err := s.store.ReplaceRecoveryCodes(ctx, user.ID, codes); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return codes, nil
+}
+
+func (s *Service) Status(ctx context.Context, user storage.User) (Status, error) {
+	const fn = "twofactor.Status"
+
+	if !user.TOTPEnabled {
+		return Status{}, nil
+	}
+
+	n, err := s.store.CountRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return Status{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return Status{Enabled: true, RecoveryCodesLeft: n}, nil
+}
+
+// checkEligible limits two-factor authentication to admins and org
+// members, the accounts that can act on more than their own links.
+func (s *Service) checkEligible(ctx context.Context, user storage.User) error {
+	if user.Role == storage.RoleAdmin {
+		return nil
+	}
+
+	orgs, err := s.store.ListUserOrgs(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if len(orgs) == 0 {
+		return ErrNotEligible
+	}
+
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// recoveryCodes returns codes like "k3x9q-7mz2p", 50 random bits each.
+func (s *Service) recoveryCodes() ([]string, error) {
+	codes := make([]string, s.cfg.RecoveryCodes)
+
+	b := make([]byte, 7)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
+
+// normalize forgives the spaces and capitals people type codes with.
+func normalize(code string) string {
+	return strings.ToLower(strings.Join(strings.Fields(code), ""))
+}
@@ -2,6 +2,7 @@ package uinfo
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -10,16 +11,83 @@ import (
 	"time"
 
 	"url-shorter/internal/lib/logger/sl"
+	"url-shorter/internal/lib/metrics"
+	"url-shorter/internal/lib/tracing"
+	"url-shorter/internal/storage"
 
 	"github.com/avct/uasurfer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var LogQueue = make(chan LogData, 100)
 
+var queueDepth = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Namespace: metrics.Namespace,
+	Name:      "click_queue_depth",
+	Help:      "Click events waiting in the queue.",
+}, func() float64 {
+	return float64(len(LogQueue))
+})
+
+// LogData is a queued request. Requests with a Click are redirects and
+// are saved through Saver; the others go to the user_info.log file.
 type LogData struct {
 	UA  string
 	R   *http.Request
 	Log *slog.Logger
+
+	Click *storage.Click
+	Saver ClickSaver
+}
+
+// ClickSaver stores a redirect in the click history.
+type ClickSaver interface {
+	SaveClick(ctx context.Context, click storage.Click) error
+}
+
+// Recorder queues the redirects of links for the click history.
+type Recorder struct {
+	log   *slog.Logger
+	saver ClickSaver
+}
+
+func NewRecorder(log *slog.Logger, saver ClickSaver) *Recorder {
+	return &Recorder{log: log, saver: saver}
+}
+
+// RecordClick queues a redirect of alias. It does not wait for the save,
+// a full queue drops the click.
+func (rec *Recorder) RecordClick(r *http.Request, alias string) {
+	data := LogData{
+		UA:  r.UserAgent(),
+		R:   r,
+		Log: rec.log,
+		Click: &storage.Click{
+			Alias:     alias,
+			IP:        getIP(r),
+			UserAgent: r.UserAgent(),
+			Referrer:  r.Referer(),
+			CreatedAt: time.Now(),
+		},
+		Saver: rec.saver,
+	}
+
+	if !Enqueue(data) {
+		rec.log.Warn("click queue is full, dropping the click", slog.String("alias", alias))
+	}
+}
+
+// Enqueue queues data unless the queue is full.
+func Enqueue(data LogData) bool {
+	select {
+	case LogQueue <- data:
+		return true
+	default:
+		metrics.ClickEventsDropped.Inc()
+		return false
+	}
 }
 
 type ParsedUserInfo struct {
@@ -32,13 +100,50 @@ type ParsedUserInfo struct {
 	Platform       string
 }
 
+// Saturated reports whether the queue is full and new clicks are being
+// dropped.
+func Saturated() bool {
+	return len(LogQueue) == cap(LogQueue)
+}
+
 func init() {
 	go worker()
 }
 
 func worker() {
 	for data := range LogQueue {
-		writeLog(data.UA, data.R, data.Log)
+		record(data)
+	}
+}
+
+// record runs in its own trace, the request is long gone by now; the span
+// links back to the request that produced the click.
+func record(data LogData) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "click.record",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(data.R.Context())),
+	)
+	defer span.End()
+
+	if data.Click != nil {
+		saveClick(ctx, *data.Click, data.Saver, data.Log)
+		return
+	}
+
+	writeLog(data.UA, data.R, data.Log)
+}
+
+func saveClick(ctx context.Context, click storage.Click, saver ClickSaver, log *slog.Logger) {
+	const fn = "worker.uinfo.saveClick"
+	log = log.With(slog.String("fn", fn))
+
+	userAgent := uasurfer.Parse(click.UserAgent)
+	click.Device = strings.TrimPrefix(userAgent.DeviceType.String(), "Device")
+	click.Browser = strings.TrimPrefix(userAgent.Browser.Name.String(), "Browser")
+
+	if err := saver.SaveClick(ctx, click); err != nil {
+		log.Error("failed to save click", slog.String("alias", click.Alias), sl.Err(err))
 	}
 }
 
@@ -0,0 +1,47 @@
+package uinfo
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"url-shorter/internal/storage"
+)
+
+type saverFunc func(ctx context.Context, click storage.Click) error
+
+func (f saverFunc) SaveClick(ctx context.Context, click storage.Click) error {
+	return f(ctx, click)
+}
+
+func TestRecordClick(t *testing.T) {
+	saved := make(chan storage.Click, 1)
+	rec := NewRecorder(slog.New(slog.NewTextHandler(io.Discard, nil)), saverFunc(func(_ context.Context, click storage.Click) error {
+		saved <- click
+		return nil
+	}))
+
+	r := httptest.NewRequest("GET", "/url/hit", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0")
+	r.Header.Set("Referer", "https://ref.example")
+	r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+	rec.RecordClick(r, "hit")
+
+	select {
+	case click := <-saved:
+		want := storage.Click{Alias: "hit", IP: "203.0.113.7", Device: "Computer", Browser: "Firefox", Referrer: "https://ref.example"}
+		if click.Alias != want.Alias || click.IP != want.IP || click.Device != want.Device ||
+			click.Browser != want.Browser || click.Referrer != want.Referrer {
+			t.Errorf("saved click = %+v; want %+v", click, want)
+		}
+		if click.CreatedAt.IsZero() {
+			t.Error("saved click has no time")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("click was not saved")
+	}
+}
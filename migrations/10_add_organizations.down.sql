@@ -0,0 +1,27 @@
+DROP INDEX IF EXISTS idx_url_org;
+
+-- Org links have no other owner, they go with their orgs.
+DELETE FROM url WHERE org_id IS NOT NULL;
+
+-- SQLite can not drop a column that is part of a foreign key, so the table
+-- is rebuilt without org_id.
+CREATE TABLE url_down (
+    id INTEGER PRIMARY KEY,
+    alias TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    clicks INTEGER DEFAULT 3,
+    normalized_url TEXT,
+    user_id INTEGER REFERENCES user(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP,
+    tags TEXT NOT NULL DEFAULT '');
+INSERT INTO url_down(id, alias, url, clicks, normalized_url, user_id, expires_at, tags)
+    SELECT id, alias, url, clicks, normalized_url, user_id, expires_at, tags FROM url;
+DROP TABLE url;
+ALTER TABLE url_down RENAME TO url;
+CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
+CREATE INDEX IF NOT EXISTS idx_url_user_normalized ON url(user_id, normalized_url);
+CREATE INDEX IF NOT EXISTS idx_url_expires_at ON url(expires_at);
+
+DROP TABLE org_invite;
+DROP TABLE org_member;
+DROP TABLE org;
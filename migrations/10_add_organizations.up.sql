@@ -0,0 +1,41 @@
+CREATE TABLE org (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    -- Default policy for the links of the org, zero values do not limit.
+    click_budget INTEGER NOT NULL DEFAULT 0,
+    link_ttl INTEGER NOT NULL DEFAULT 0,
+    allowed_domains TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE org_member (
+    org_id INTEGER NOT NULL REFERENCES org(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES user(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_org_member_user ON org_member(user_id);
+
+-- Only the sha256 of an invite token is kept, the token itself is shown
+-- once to whoever created the invite.
+CREATE TABLE org_invite (
+    id INTEGER PRIMARY KEY,
+    org_id INTEGER NOT NULL REFERENCES org(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('admin', 'member')),
+    token_hash TEXT NOT NULL UNIQUE,
+    invited_by INTEGER REFERENCES user(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    accepted_by INTEGER REFERENCES user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_org_invite_org ON org_invite(org_id);
+
+-- A link belongs to its org when org_id is set, user_id is then NULL.
+ALTER TABLE url ADD COLUMN org_id INTEGER REFERENCES org(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_url_org ON url(org_id);
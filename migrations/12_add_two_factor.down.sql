@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recovery_code;
+
+ALTER TABLE user DROP COLUMN totp_last_step;
+ALTER TABLE user DROP COLUMN totp_enabled_at;
+ALTER TABLE user DROP COLUMN totp_secret;
@@ -0,0 +1,15 @@
+-- totp_secret is set on enrollment, totp_enabled_at once the user proved
+-- their authenticator works. totp_last_step keeps a code from being used
+-- twice.
+ALTER TABLE user ADD COLUMN totp_secret TEXT;
+ALTER TABLE user ADD COLUMN totp_enabled_at TIMESTAMP;
+ALTER TABLE user ADD COLUMN totp_last_step INTEGER;
+
+-- Only the sha256 of a recovery code is kept, the codes are shown once.
+CREATE TABLE recovery_code (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES user(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
@@ -1 +1,2 @@
-DROP TABLE IF EXISTS url;
\ No newline at end of file
+DROP INDEX IF EXISTS idx_alias;
+DROP TABLE IF EXISTS url;
@@ -1 +1 @@
-DROP TABLE IF EXISTS url;
\ No newline at end of file
+DROP TABLE IF EXISTS user;
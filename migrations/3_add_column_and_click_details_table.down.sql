@@ -1,2 +1,2 @@
 DROP TABLE IF EXISTS click_details;
-ALTER TABLE url DROP COLUMN IF EXISTS clicks;
\ No newline at end of file
+ALTER TABLE url DROP COLUMN clicks;
@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS idx_url_user_normalized;
+
+ALTER TABLE user DROP COLUMN dedup_urls;
+
+-- SQLite can not drop a column that is part of a foreign key, so the table
+-- is rebuilt without user_id.
+CREATE TABLE url_down (
+    id INTEGER PRIMARY KEY,
+    alias TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    clicks INTEGER DEFAULT 3,
+    normalized_url TEXT);
+INSERT INTO url_down(id, alias, url, clicks, normalized_url)
+    SELECT id, alias, url, clicks, normalized_url FROM url;
+DROP TABLE url;
+ALTER TABLE url_down RENAME TO url;
+CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);
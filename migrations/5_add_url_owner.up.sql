@@ -0,0 +1,4 @@
+ALTER TABLE url ADD COLUMN user_id INTEGER REFERENCES user(id) ON DELETE SET NULL;
+ALTER TABLE user ADD COLUMN dedup_urls BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_url_user_normalized ON url(user_id, normalized_url);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_url_expires_at;
+
+ALTER TABLE url DROP COLUMN tags;
+ALTER TABLE url DROP COLUMN expires_at;
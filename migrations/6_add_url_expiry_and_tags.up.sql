@@ -0,0 +1,4 @@
+ALTER TABLE url ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE url ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_url_expires_at ON url(expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE user ADD COLUMN role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member', 'read-only'));
+
+-- Existing installations get their oldest account as the first admin.
+UPDATE user SET role = 'admin' WHERE id = (SELECT MIN(id) FROM user);